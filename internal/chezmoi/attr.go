@@ -72,6 +72,7 @@ type FileAttr struct {
 	Order      ScriptOrder
 	Private    bool
 	ReadOnly   bool
+	SOPS       bool
 	Template   bool
 }
 
@@ -163,6 +164,7 @@ func parseFileAttr(sourceName, encryptedSuffix string) FileAttr {
 		order          = ScriptOrderDuring
 		private        = false
 		readOnly       = false
+		sops           = false
 		template       = false
 	)
 	switch {
@@ -170,6 +172,7 @@ func parseFileAttr(sourceName, encryptedSuffix string) FileAttr {
 		sourceFileType = SourceFileTypeCreate
 		name = name[len(createPrefix):]
 		name, encrypted = strings.CutPrefix(name, encryptedPrefix)
+		name, sops = strings.CutPrefix(name, sopsPrefix)
 		name, private = strings.CutPrefix(name, privatePrefix)
 		name, readOnly = strings.CutPrefix(name, readOnlyPrefix)
 		name, empty = strings.CutPrefix(name, emptyPrefix)
@@ -210,6 +213,7 @@ func parseFileAttr(sourceName, encryptedSuffix string) FileAttr {
 		name, executable = strings.CutPrefix(name, executablePrefix)
 	default:
 		name, encrypted = strings.CutPrefix(name, encryptedPrefix)
+		name, sops = strings.CutPrefix(name, sopsPrefix)
 		name, private = strings.CutPrefix(name, privatePrefix)
 		name, readOnly = strings.CutPrefix(name, readOnlyPrefix)
 		name, empty = strings.CutPrefix(name, emptyPrefix)
@@ -242,6 +246,7 @@ func parseFileAttr(sourceName, encryptedSuffix string) FileAttr {
 		Order:      order,
 		Private:    private,
 		ReadOnly:   readOnly,
+		SOPS:       sops,
 		Template:   template,
 	}
 }
@@ -258,6 +263,7 @@ func (fa FileAttr) LogValue() slog.Value {
 		slog.Int("Order", int(fa.Order)),
 		slog.Bool("Private", fa.Private),
 		slog.Bool("ReadOnly", fa.ReadOnly),
+		slog.Bool("SOPS", fa.SOPS),
 		slog.Bool("Template", fa.Template),
 	)
 }
@@ -271,6 +277,9 @@ func (fa FileAttr) SourceName(encryptedSuffix string) string {
 		if fa.Encrypted {
 			sourceName += encryptedPrefix
 		}
+		if fa.SOPS {
+			sourceName += sopsPrefix
+		}
 		if fa.Private {
 			sourceName += privatePrefix
 		}
@@ -287,6 +296,9 @@ func (fa FileAttr) SourceName(encryptedSuffix string) string {
 		if fa.Encrypted {
 			sourceName += encryptedPrefix
 		}
+		if fa.SOPS {
+			sourceName += sopsPrefix
+		}
 		if fa.Private {
 			sourceName += privatePrefix
 		}
@@ -103,6 +103,7 @@ func TestFileAttr(t *testing.T) {
 		Executable []bool
 		Private    []bool
 		ReadOnly   []bool
+		SOPS       []bool
 		Template   []bool
 	}{
 		Type:       SourceFileTypeCreate,
@@ -112,6 +113,7 @@ func TestFileAttr(t *testing.T) {
 		Executable: []bool{false, true},
 		Private:    []bool{false, true},
 		ReadOnly:   []bool{false, true},
+		SOPS:       []bool{false, true},
 		Template:   []bool{false, true},
 	}))
 	assert.NoError(t, combinator.Generate(&fileAttrs, struct {
@@ -122,6 +124,7 @@ func TestFileAttr(t *testing.T) {
 		Executable []bool
 		Private    []bool
 		ReadOnly   []bool
+		SOPS       []bool
 		Template   []bool
 	}{
 		Type:       SourceFileTypeFile,
@@ -131,6 +134,7 @@ func TestFileAttr(t *testing.T) {
 		Executable: []bool{false, true},
 		Private:    []bool{false, true},
 		ReadOnly:   []bool{false, true},
+		SOPS:       []bool{false, true},
 		Template:   []bool{false, true},
 	}))
 	assert.NoError(t, combinator.Generate(&fileAttrs, struct {
@@ -0,0 +1,353 @@
+package chezmoi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/twpayne/chezmoi/internal/chezmoierrors"
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+)
+
+// A Backup is a snapshot of a target taken before it was overwritten or
+// removed.
+type Backup struct {
+	ID             string         `json:"id"                       yaml:"id"`
+	Time           time.Time      `json:"time"                     yaml:"time"`
+	TargetAbsPath  AbsPath        `json:"target"                   yaml:"target"`
+	Type           EntryStateType `json:"type"                     yaml:"type"`
+	Mode           fs.FileMode    `json:"mode"                     yaml:"mode"`
+	ContentsSHA256 HexBytes       `json:"contentsSHA256,omitempty" yaml:"contentsSHA256,omitempty"` //nolint:tagliatelle
+	Linkname       string         `json:"linkname,omitempty"       yaml:"linkname,omitempty"`
+}
+
+// A BackupStore stores backups. The contents of backed up files are stored in
+// a directory, named by their SHA256 sums, so identical contents are only
+// stored once. The metadata of each backup is stored in a persistent state.
+type BackupStore struct {
+	system          System
+	persistentState PersistentState
+	dirAbsPath      AbsPath
+	time            time.Time
+}
+
+// PruneBackupsOptions are options to BackupStore.Prune.
+type PruneBackupsOptions struct {
+	MaxAge   time.Duration
+	MaxCount int
+	Now      time.Time
+}
+
+// NewBackupStore returns a new BackupStore that stores contents in dirAbsPath
+// in system and metadata in persistentState. All backups made by the returned
+// BackupStore have the same time.
+func NewBackupStore(system System, persistentState PersistentState, dirAbsPath AbsPath) *BackupStore {
+	return &BackupStore{
+		system:          system,
+		persistentState: persistentState,
+		dirAbsPath:      dirAbsPath,
+		time:            time.Now().UTC(),
+	}
+}
+
+// Backup backs up absPath in system. If absPath is a directory then all its
+// children are also backed up. If absPath does not exist then Backup does
+// nothing.
+func (s *BackupStore) Backup(system System, absPath AbsPath) error {
+	switch fileInfo, err := system.Lstat(absPath); {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case !fileInfo.IsDir():
+		return s.backupEntry(system, absPath, fileInfo)
+	}
+	return Walk(system, absPath, func(absPath AbsPath, fileInfo fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return s.backupEntry(system, absPath, fileInfo)
+	})
+}
+
+// Backups returns all backups, oldest first.
+func (s *BackupStore) Backups() ([]*Backup, error) {
+	var backups []*Backup
+	if err := s.persistentState.ForEach(BackupStateBucket, func(k, v []byte) error {
+		var backup Backup
+		if err := stateFormat.Unmarshal(v, &backup); err != nil {
+			return err
+		}
+		backups = append(backups, &backup)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(backups, compareBackups)
+	return backups, nil
+}
+
+// Contents returns the contents of backup.
+func (s *BackupStore) Contents(backup *Backup) ([]byte, error) {
+	if backup.Type != EntryStateTypeFile {
+		return nil, fmt.Errorf("%s: not a file", backup.ID)
+	}
+	switch contents, err := s.ReadContents(backup.ContentsSHA256); {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("%s: %s: contents no longer available", backup.ID, backup.TargetAbsPath)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", backup.ID, err)
+	default:
+		return contents, nil
+	}
+}
+
+// Get returns the backup with id.
+func (s *BackupStore) Get(id string) (*Backup, error) {
+	var backup Backup
+	switch ok, err := PersistentStateGet(s.persistentState, BackupStateBucket, []byte(id), &backup); {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, fmt.Errorf("%s: backup not found", id)
+	default:
+		return &backup, nil
+	}
+}
+
+// Latest returns the most recent backup of targetAbsPath, or nil if there is
+// none.
+func (s *BackupStore) Latest(targetAbsPath AbsPath) (*Backup, error) {
+	backups, err := s.Backups()
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range slices.Backward(backups) {
+		if backup.TargetAbsPath == targetAbsPath {
+			return backup, nil
+		}
+	}
+	return nil, nil
+}
+
+// Prune removes backups older than options.MaxAge and all but the most recent
+// options.MaxCount backups of each target, and then removes all contents that
+// are no longer referenced by a backup or a generation. A zero options.MaxAge
+// or options.MaxCount means no limit. It returns the removed backups.
+func (s *BackupStore) Prune(options PruneBackupsOptions) ([]*Backup, error) {
+	backups, err := s.Backups()
+	if err != nil {
+		return nil, err
+	}
+
+	var prunedBackups []*Backup
+	referencedContents := chezmoiset.New[string]()
+	countByTargetAbsPath := make(map[AbsPath]int)
+	for _, backup := range slices.Backward(backups) {
+		countByTargetAbsPath[backup.TargetAbsPath]++
+		tooOld := options.MaxAge > 0 && options.Now.Sub(backup.Time) > options.MaxAge
+		tooMany := options.MaxCount > 0 && countByTargetAbsPath[backup.TargetAbsPath] > options.MaxCount
+		if !tooOld && !tooMany {
+			if backup.ContentsSHA256 != nil {
+				referencedContents.Add(backup.ContentsSHA256.String())
+			}
+			continue
+		}
+		if err := s.persistentState.Delete(BackupStateBucket, []byte(backup.ID)); err != nil {
+			return nil, err
+		}
+		prunedBackups = append(prunedBackups, backup)
+	}
+	slices.Reverse(prunedBackups)
+
+	generations, err := Generations(s.persistentState)
+	if err != nil {
+		return nil, err
+	}
+	for _, generation := range generations {
+		for _, entry := range generation.Entries {
+			for _, entryState := range []*EntryState{entry.Before, entry.After} {
+				if entryState != nil && entryState.ContentsSHA256 != nil {
+					referencedContents.Add(entryState.ContentsSHA256.String())
+				}
+			}
+		}
+	}
+
+	switch dirEntries, err := s.system.ReadDir(s.dirAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		for _, dirEntry := range dirEntries {
+			if referencedContents.Contains(dirEntry.Name()) {
+				continue
+			}
+			if err := s.system.Remove(s.dirAbsPath.JoinString(dirEntry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return prunedBackups, nil
+}
+
+// ReadContents returns the stored contents with contentsSHA256.
+func (s *BackupStore) ReadContents(contentsSHA256 HexBytes) ([]byte, error) {
+	contents, err := s.system.ReadFile(s.contentsAbsPath(contentsSHA256))
+	if err != nil {
+		return nil, err
+	}
+	if gotSHA256 := sha256.Sum256(contents); !bytes.Equal(gotSHA256[:], contentsSHA256) {
+		return nil, fmt.Errorf("SHA256 mismatch: expected %s, got %s", contentsSHA256, hex.EncodeToString(gotSHA256[:]))
+	}
+	return contents, nil
+}
+
+// StoreContents stores contents, if they are not already stored, so that they
+// can later be read with ReadContents.
+func (s *BackupStore) StoreContents(contents []byte) error {
+	contentsSHA256 := sha256.Sum256(contents)
+	return s.writeContents(HexBytes(contentsSHA256[:]), contents)
+}
+
+// Restore restores backup in system. If backup is a directory then all
+// backups of its children taken at the same time are also restored, and
+// children that cannot be restored, for example because their contents are no
+// longer available, are skipped and their errors returned.
+func (s *BackupStore) Restore(system System, backup *Backup) error {
+	backups := []*Backup{backup}
+	if backup.Type == EntryStateTypeDir {
+		allBackups, err := s.Backups()
+		if err != nil {
+			return err
+		}
+		prefix := backup.TargetAbsPath.String() + "/"
+		for _, b := range allBackups {
+			if b.Time.Equal(backup.Time) && strings.HasPrefix(b.TargetAbsPath.String(), prefix) {
+				backups = append(backups, b)
+			}
+		}
+		slices.SortFunc(backups, func(a, b *Backup) int {
+			return strings.Compare(a.TargetAbsPath.String(), b.TargetAbsPath.String())
+		})
+	}
+
+	var errs []error
+	for _, backup := range backups {
+		if err := s.restoreEntry(system, backup); err != nil {
+			if backup.Type == EntryStateTypeDir {
+				return chezmoierrors.Combine(append(errs, err)...)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return chezmoierrors.Combine(errs...)
+}
+
+// backupEntry backs up the single entry absPath with fileInfo in system.
+func (s *BackupStore) backupEntry(system System, absPath AbsPath, fileInfo fs.FileInfo) error {
+	backup := &Backup{
+		Time:          s.time,
+		TargetAbsPath: absPath,
+		Mode:          fileInfo.Mode(),
+	}
+	switch fileInfo.Mode().Type() {
+	case 0:
+		contents, err := system.ReadFile(absPath)
+		if err != nil {
+			return err
+		}
+		contentsSHA256 := sha256.Sum256(contents)
+		backup.Type = EntryStateTypeFile
+		backup.ContentsSHA256 = HexBytes(contentsSHA256[:])
+		if err := s.writeContents(backup.ContentsSHA256, contents); err != nil {
+			return err
+		}
+	case fs.ModeDir:
+		backup.Type = EntryStateTypeDir
+	case fs.ModeSymlink:
+		linkname, err := system.Readlink(absPath)
+		if err != nil {
+			return err
+		}
+		backup.Type = EntryStateTypeSymlink
+		backup.Linkname = linkname
+	default:
+		return nil
+	}
+	idSHA256 := sha256.Sum256([]byte(s.time.Format(time.RFC3339Nano) + "\x00" + absPath.String()))
+	backup.ID = hex.EncodeToString(idSHA256[:])[:12]
+	return PersistentStateSet(s.persistentState, BackupStateBucket, []byte(backup.ID), backup)
+}
+
+// contentsAbsPath returns the path where contents with contentsSHA256 are
+// stored.
+func (s *BackupStore) contentsAbsPath(contentsSHA256 HexBytes) AbsPath {
+	return s.dirAbsPath.JoinString(contentsSHA256.String())
+}
+
+// restoreEntry restores the single entry backup in system.
+func (s *BackupStore) restoreEntry(system System, backup *Backup) error {
+	fileInfo, err := system.Lstat(backup.TargetAbsPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		fileInfo = nil
+	case err != nil:
+		return err
+	}
+	if fileInfo != nil && (fileInfo.IsDir() != (backup.Type == EntryStateTypeDir) || backup.Type == EntryStateTypeSymlink) {
+		if err := system.RemoveAll(backup.TargetAbsPath); err != nil {
+			return err
+		}
+		fileInfo = nil
+	}
+
+	switch backup.Type {
+	case EntryStateTypeDir:
+		if fileInfo == nil {
+			return system.Mkdir(backup.TargetAbsPath, backup.Mode.Perm())
+		}
+		return system.Chmod(backup.TargetAbsPath, backup.Mode.Perm())
+	case EntryStateTypeFile:
+		contents, err := s.Contents(backup)
+		if err != nil {
+			return err
+		}
+		return system.WriteFile(backup.TargetAbsPath, contents, backup.Mode.Perm())
+	case EntryStateTypeSymlink:
+		return system.WriteSymlink(backup.Linkname, backup.TargetAbsPath)
+	default:
+		return fmt.Errorf("%s: %s: unsupported type", backup.ID, backup.Type)
+	}
+}
+
+// writeContents writes contents with contentsSHA256 to s, if they are not
+// already stored.
+func (s *BackupStore) writeContents(contentsSHA256 HexBytes, contents []byte) error {
+	contentsAbsPath := s.contentsAbsPath(contentsSHA256)
+	switch _, err := s.system.Lstat(contentsAbsPath); {
+	case err == nil:
+		return nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	if err := MkdirAll(s.system, s.dirAbsPath, 0o700); err != nil {
+		return err
+	}
+	return s.system.WriteFile(contentsAbsPath, contents, 0o600)
+}
+
+// compareBackups compares backups by time and then by target.
+func compareBackups(a, b *Backup) int {
+	if c := a.Time.Compare(b.Time); c != 0 {
+		return c
+	}
+	return strings.Compare(a.TargetAbsPath.String(), b.TargetAbsPath.String())
+}
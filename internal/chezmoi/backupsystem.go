@@ -0,0 +1,151 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"os/exec"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+)
+
+// A BackupSystem is a System that backs up entries in a BackupStore before
+// they are overwritten or removed in the wrapped System.
+type BackupSystem struct {
+	system      System
+	backupStore *BackupStore
+	backedUp    chezmoiset.Set[AbsPath]
+}
+
+// NewBackupSystem returns a new BackupSystem that wraps system and backs up
+// entries to backupStore.
+func NewBackupSystem(system System, backupStore *BackupStore) *BackupSystem {
+	return &BackupSystem{
+		system:      system,
+		backupStore: backupStore,
+		backedUp:    chezmoiset.New[AbsPath](),
+	}
+}
+
+// Chmod implements System.Chmod.
+func (s *BackupSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	return s.system.Chmod(name, mode)
+}
+
+// Chtimes implements System.Chtimes.
+func (s *BackupSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *BackupSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *BackupSystem) Link(oldName, newName AbsPath) error {
+	if err := s.backup(newName); err != nil {
+		return err
+	}
+	return s.system.Link(oldName, newName)
+}
+
+// Lstat implements System.Lstat.
+func (s *BackupSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *BackupSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	return s.system.Mkdir(name, perm)
+}
+
+// RawPath implements System.RawPath.
+func (s *BackupSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *BackupSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *BackupSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *BackupSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *BackupSystem) Remove(name AbsPath) error {
+	if err := s.backup(name); err != nil {
+		return err
+	}
+	return s.system.Remove(name)
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *BackupSystem) RemoveAll(name AbsPath) error {
+	if err := s.backup(name); err != nil {
+		return err
+	}
+	return s.system.RemoveAll(name)
+}
+
+// Rename implements System.Rename.
+func (s *BackupSystem) Rename(oldPath, newPath AbsPath) error {
+	if err := s.backup(newPath); err != nil {
+		return err
+	}
+	return s.system.Rename(oldPath, newPath)
+}
+
+// RunCmd implements System.RunCmd.
+func (s *BackupSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *BackupSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	return s.system.RunScript(scriptName, dir, data, options)
+}
+
+// Stat implements System.Stat.
+func (s *BackupSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *BackupSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *BackupSystem) WriteFile(filename AbsPath, data []byte, perm fs.FileMode) error {
+	if err := s.backup(filename); err != nil {
+		return err
+	}
+	return s.system.WriteFile(filename, data, perm)
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *BackupSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	if err := s.backup(newName); err != nil {
+		return err
+	}
+	return s.system.WriteSymlink(oldName, newName)
+}
+
+// backup backs up name, if it has not already been backed up.
+func (s *BackupSystem) backup(name AbsPath) error {
+	if s.backedUp.Contains(name) {
+		return nil
+	}
+	s.backedUp.Add(name)
+	return s.backupStore.Backup(s.system, name)
+}
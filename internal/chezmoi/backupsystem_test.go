@@ -0,0 +1,98 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+var _ System = &BackupSystem{}
+
+func TestBackupSystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir": map[string]any{
+				"file1": "# contents of .dir/file1\n",
+				"file2": "# contents of .dir/file2\n",
+			},
+			".file":    "# contents of .file\n",
+			".symlink": &vfst.Symlink{Target: ".file"},
+		},
+	}, func(fileSystem vfs.FS) {
+		system := NewRealSystem(fileSystem)
+		persistentState := NewMockPersistentState()
+		backupDirAbsPath := NewAbsPath("/home/user/.cache/chezmoi/backup")
+		backupStore := NewBackupStore(system, persistentState, backupDirAbsPath)
+		backupSystem := NewBackupSystem(system, backupStore)
+
+		// Test that writes and removals back up the previous entries.
+		assert.NoError(t, backupSystem.WriteFile(NewAbsPath("/home/user/.file"), []byte("# new contents of .file\n"), 0o666))
+		assert.NoError(t, backupSystem.WriteFile(NewAbsPath("/home/user/.file"), []byte("# newer contents of .file\n"), 0o666))
+		assert.NoError(t, backupSystem.WriteSymlink(".dir", NewAbsPath("/home/user/.symlink")))
+		assert.NoError(t, backupSystem.RemoveAll(NewAbsPath("/home/user/.dir")))
+		assert.NoError(t, backupSystem.WriteFile(NewAbsPath("/home/user/.new"), []byte("# contents of .new\n"), 0o666))
+
+		backups, err := backupStore.Backups()
+		assert.NoError(t, err)
+		actualTargets := make([]string, 0, len(backups))
+		for _, backup := range backups {
+			actualTargets = append(actualTargets, string(backup.Type)+" "+backup.TargetAbsPath.String())
+		}
+		assert.Equal(t, []string{
+			"dir /home/user/.dir",
+			"file /home/user/.dir/file1",
+			"file /home/user/.dir/file2",
+			"file /home/user/.file",
+			"symlink /home/user/.symlink",
+		}, actualTargets)
+
+		// Test that backed up contents can be read.
+		fileBackup, err := backupStore.Latest(NewAbsPath("/home/user/.file"))
+		assert.NoError(t, err)
+		contents, err := backupStore.Contents(fileBackup)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("# contents of .file\n"), contents)
+
+		// Test that backups can be restored.
+		dirBackup, err := backupStore.Get(backups[0].ID)
+		assert.NoError(t, err)
+		assert.NoError(t, backupStore.Restore(system, dirBackup))
+		assert.NoError(t, backupStore.Restore(system, fileBackup))
+		assert.NoError(t, backupStore.Restore(system, backups[4]))
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.dir/file1",
+				vfst.TestContentsString("# contents of .dir/file1\n"),
+			),
+			vfst.TestPath("/home/user/.dir/file2",
+				vfst.TestContentsString("# contents of .dir/file2\n"),
+			),
+			vfst.TestPath("/home/user/.file",
+				vfst.TestContentsString("# contents of .file\n"),
+			),
+			vfst.TestPath("/home/user/.symlink",
+				vfst.TestModeType(fs.ModeSymlink),
+				vfst.TestSymlinkTarget(".file"),
+			),
+		)
+
+		// Test that pruning removes backups and unreferenced contents.
+		prunedBackups, err := backupStore.Prune(PruneBackupsOptions{
+			MaxAge: time.Hour,
+			Now:    time.Now().Add(2 * time.Hour),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, backups, prunedBackups)
+		backups, err = backupStore.Backups()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(backups))
+		dirEntries, err := system.ReadDir(backupDirAbsPath)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(dirEntries))
+	})
+}
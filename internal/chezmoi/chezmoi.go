@@ -53,6 +53,7 @@ const (
 	readOnlyPrefix   = "readonly_"
 	removePrefix     = "remove_"
 	runPrefix        = "run_"
+	sopsPrefix       = "sops_"
 	symlinkPrefix    = "symlink_"
 	literalSuffix    = ".literal"
 	TemplateSuffix   = ".tmpl"
@@ -68,7 +69,10 @@ const (
 	dataName         = Prefix + "data"
 	externalName     = Prefix + "external"
 	externalsDirName = Prefix + "externals"
+	handlersName     = Prefix + "handlers"
+	hooksName        = Prefix + "hooks"
 	ignoreName       = Prefix + "ignore"
+	packagesName     = Prefix + "packages"
 	removeName       = Prefix + "remove"
 	scriptsDirName   = Prefix + "scripts"
 )
@@ -76,7 +80,7 @@ const (
 var (
 	dirPrefixRx  = regexp.MustCompile(`\A(dot|exact|literal|readonly|private)_`)
 	filePrefixRx = regexp.MustCompile(
-		`\A(after|before|create|dot|empty|encrypted|executable|literal|modify|once|private|readonly|remove|run|symlink)_`,
+		`\A(after|before|create|dot|empty|encrypted|executable|literal|modify|once|private|readonly|remove|run|sops|symlink)_`,
 	)
 	fileSuffixRx = regexp.MustCompile(`\.(literal|tmpl)\z`)
 	whitespaceRx = regexp.MustCompile(`\s+`)
@@ -98,8 +102,26 @@ var knownPrefixedFiles = chezmoiset.New(
 	externalName+".toml",
 	externalName+".yaml"+TemplateSuffix,
 	externalName+".yaml",
+	handlersName+".json"+TemplateSuffix,
+	handlersName+".json",
+	handlersName+".toml"+TemplateSuffix,
+	handlersName+".toml",
+	handlersName+".yaml"+TemplateSuffix,
+	handlersName+".yaml",
+	hooksName+".json"+TemplateSuffix,
+	hooksName+".json",
+	hooksName+".toml"+TemplateSuffix,
+	hooksName+".toml",
+	hooksName+".yaml"+TemplateSuffix,
+	hooksName+".yaml",
 	ignoreName+TemplateSuffix,
 	ignoreName,
+	packagesName+".json"+TemplateSuffix,
+	packagesName+".json",
+	packagesName+".toml"+TemplateSuffix,
+	packagesName+".toml",
+	packagesName+".yaml"+TemplateSuffix,
+	packagesName+".yaml",
 	removeName+TemplateSuffix,
 	removeName,
 )
@@ -0,0 +1,187 @@
+package chezmoi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"time"
+
+	vfs "github.com/twpayne/go-vfs/v5"
+)
+
+// DryRunEnvVar is the environment variable that is set when a script that
+// supports the dry run protocol is run in dry run mode.
+const DryRunEnvVar = "CHEZMOI_DRY_RUN"
+
+// A ScriptChange is a change that a script would make, as reported by the
+// script when it is run in dry run mode.
+type ScriptChange struct {
+	Action      string `json:"action"`
+	Target      string `json:"target"`
+	Description string `json:"description"`
+}
+
+// A ScriptChangesFunc is called with the changes that a script would make.
+type ScriptChangesFunc func(scriptName RelPath, changes []ScriptChange) error
+
+// A DryRunScriptSystem is a System that, in addition to passing all calls to
+// a wrapped System, runs scripts that support the dry run protocol on a
+// separate script System with the DryRunEnvVar environment variable set, and
+// reports the changes that they would make.
+type DryRunScriptSystem struct {
+	system       System
+	scriptSystem System
+	changesFunc  ScriptChangesFunc
+}
+
+// NewDryRunScriptSystem returns a new DryRunScriptSystem that wraps system,
+// runs scripts that support the dry run protocol on scriptSystem, and calls
+// changesFunc with the changes that they would make.
+func NewDryRunScriptSystem(system, scriptSystem System, changesFunc ScriptChangesFunc) *DryRunScriptSystem {
+	return &DryRunScriptSystem{
+		system:       system,
+		scriptSystem: scriptSystem,
+		changesFunc:  changesFunc,
+	}
+}
+
+// Chmod implements System.Chmod.
+func (s *DryRunScriptSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	return s.system.Chmod(name, mode)
+}
+
+// Chtimes implements System.Chtimes.
+func (s *DryRunScriptSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *DryRunScriptSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *DryRunScriptSystem) Link(oldName, newName AbsPath) error {
+	return s.system.Link(oldName, newName)
+}
+
+// Lstat implements System.Lstat.
+func (s *DryRunScriptSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *DryRunScriptSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	return s.system.Mkdir(name, perm)
+}
+
+// RawPath implements System.RawPath.
+func (s *DryRunScriptSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *DryRunScriptSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *DryRunScriptSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *DryRunScriptSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *DryRunScriptSystem) Remove(name AbsPath) error {
+	return s.system.Remove(name)
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *DryRunScriptSystem) RemoveAll(name AbsPath) error {
+	return s.system.RemoveAll(name)
+}
+
+// Rename implements System.Rename.
+func (s *DryRunScriptSystem) Rename(oldPath, newPath AbsPath) error {
+	return s.system.Rename(oldPath, newPath)
+}
+
+// RunCmd implements System.RunCmd.
+func (s *DryRunScriptSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *DryRunScriptSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	if options.DryRun {
+		var stdout bytes.Buffer
+		dryRunOptions := options
+		dryRunOptions.Env = append(append([]string{}, options.Env...), DryRunEnvVar+"=1")
+		dryRunOptions.Retries = 0
+		dryRunOptions.Stdout = &stdout
+		if dryRunOptions.Stderr == nil {
+			dryRunOptions.Stderr = os.Stderr
+		}
+		if err := s.scriptSystem.RunScript(scriptName, dir, data, dryRunOptions); err != nil {
+			return fmt.Errorf("%s: dry run: %w", scriptName, err)
+		}
+		changes, err := ParseScriptChanges(stdout.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s: dry run: %w", scriptName, err)
+		}
+		if err := s.changesFunc(scriptName, changes); err != nil {
+			return err
+		}
+	}
+	return s.system.RunScript(scriptName, dir, data, options)
+}
+
+// Stat implements System.Stat.
+func (s *DryRunScriptSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *DryRunScriptSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *DryRunScriptSystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	return s.system.WriteFile(name, data, perm)
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *DryRunScriptSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	return s.system.WriteSymlink(oldName, newName)
+}
+
+// ParseScriptChanges parses the output of a script run in dry run mode. Each
+// non-empty line must be a JSON object describing a single change.
+func ParseScriptChanges(data []byte) ([]ScriptChange, error) {
+	var changes []ScriptChange
+	lineNumber := 0
+	for line := range bytes.Lines(data) {
+		lineNumber++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var change ScriptChange
+		if err := json.Unmarshal(line, &change); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if change.Action == "" {
+			return nil, fmt.Errorf("line %d: missing action", lineNumber)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
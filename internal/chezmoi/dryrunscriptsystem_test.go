@@ -0,0 +1,62 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+var _ System = &DryRunScriptSystem{}
+
+func TestParseScriptChanges(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        string
+		expected    []ScriptChange
+		expectedErr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "changes",
+			data: chezmoitest.JoinLines(
+				`{"action":"install","target":"ripgrep"}`,
+				``,
+				`{"action":"reload","description":"reload the shell"}`,
+			),
+			expected: []ScriptChange{
+				{
+					Action: "install",
+					Target: "ripgrep",
+				},
+				{
+					Action:      "reload",
+					Description: "reload the shell",
+				},
+			},
+		},
+		{
+			name:        "invalid_json",
+			data:        "installing ripgrep\n",
+			expectedErr: "line 1: invalid character 'i' looking for beginning of value",
+		},
+		{
+			name:        "missing_action",
+			data:        "{}\n{\"target\":\"ripgrep\"}\n",
+			expectedErr: "line 1: missing action",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParseScriptChanges([]byte(tc.data))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
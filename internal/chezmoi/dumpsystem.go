@@ -50,11 +50,16 @@ type fileData struct {
 
 // A scriptData contains data about a script.
 type scriptData struct {
-	Type        dataType     `json:"type"                  yaml:"type"`
-	Name        AbsPath      `json:"name"                  yaml:"name"`
-	Contents    string       `json:"contents"              yaml:"contents"`
-	Condition   string       `json:"condition"             yaml:"condition"`
-	Interpreter *Interpreter `json:"interpreter,omitempty" yaml:"interpreter,omitempty"`
+	Type          dataType     `json:"type"                    yaml:"type"`
+	Name          AbsPath      `json:"name"                    yaml:"name"`
+	Contents      string       `json:"contents"                yaml:"contents"`
+	Condition     string       `json:"condition"               yaml:"condition"`
+	DependsOn     []RelPath    `json:"dependsOn,omitempty"     yaml:"dependsOn,omitempty"`
+	DryRun        bool         `json:"dryRun,omitempty"        yaml:"dryRun,omitempty"`
+	Interpreter   *Interpreter `json:"interpreter,omitempty"   yaml:"interpreter,omitempty"`
+	ParallelGroup string       `json:"parallelGroup,omitempty" yaml:"parallelGroup,omitempty"`
+	Retries       int          `json:"retries,omitempty"       yaml:"retries,omitempty"`
+	Timeout       string       `json:"timeout,omitempty"       yaml:"timeout,omitempty"`
 }
 
 // A symlinkData contains data about a symlink.
@@ -101,9 +106,16 @@ func (s *DumpSystem) RunCmd(cmd *exec.Cmd) error {
 func (s *DumpSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
 	scriptNameStr := scriptName.String()
 	scriptData := &scriptData{
-		Type:     dataTypeScript,
-		Name:     NewAbsPath(scriptNameStr),
-		Contents: string(data),
+		Type:          dataTypeScript,
+		Name:          NewAbsPath(scriptNameStr),
+		Contents:      string(data),
+		DependsOn:     options.DependsOn,
+		DryRun:        options.DryRun,
+		ParallelGroup: options.ParallelGroup,
+		Retries:       options.Retries,
+	}
+	if options.Timeout > 0 {
+		scriptData.Timeout = options.Timeout.String()
 	}
 	if options.Condition != ScriptConditionNone {
 		scriptData.Condition = string(options.Condition)
@@ -22,13 +22,16 @@ const (
 )
 
 // An EntryState represents the state of an entry. A nil EntryState is
-// equivalent to EntryStateTypeAbsent.
+// equivalent to EntryStateTypeAbsent. DependencySHA256s contains the SHA256
+// sums of a run_onchange_ script's onchange dependencies, which are included in
+// its ContentsSHA256.
 type EntryState struct {
-	Type           EntryStateType `json:"type"                     yaml:"type"`
-	Mode           fs.FileMode    `json:"mode,omitempty"           yaml:"mode,omitempty"`
-	ContentsSHA256 HexBytes       `json:"contentsSHA256,omitempty" yaml:"contentsSHA256,omitempty"` //nolint:tagliatelle
-	contents       []byte
-	overwrite      bool
+	Type              EntryStateType      `json:"type"                        yaml:"type"`
+	Mode              fs.FileMode         `json:"mode,omitempty"              yaml:"mode,omitempty"`
+	ContentsSHA256    HexBytes            `json:"contentsSHA256,omitempty"    yaml:"contentsSHA256,omitempty"`    //nolint:tagliatelle
+	DependencySHA256s map[string]HexBytes `json:"dependencySHA256s,omitempty" yaml:"dependencySHA256s,omitempty"` //nolint:tagliatelle
+	contents          []byte
+	overwrite         bool
 }
 
 // Contents returns s's contents, if available.
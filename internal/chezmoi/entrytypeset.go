@@ -33,6 +33,7 @@ const (
 	EntryTypeExternals
 	EntryTypeTemplates
 	EntryTypeAlways
+	EntryTypePackages
 
 	// EntryTypesAll is all entry types.
 	EntryTypesAll EntryTypeBits = EntryTypeDirs |
@@ -43,7 +44,8 @@ const (
 		EntryTypeEncrypted |
 		EntryTypeExternals |
 		EntryTypeTemplates |
-		EntryTypeAlways
+		EntryTypeAlways |
+		EntryTypePackages
 
 	// EntryTypesNone is no entry types.
 	EntryTypesNone EntryTypeBits = 0
@@ -56,6 +58,7 @@ var (
 		"always":    EntryTypeAlways,
 		"dirs":      EntryTypeDirs,
 		"files":     EntryTypeFiles,
+		"packages":  EntryTypePackages,
 		"remove":    EntryTypeRemove,
 		"scripts":   EntryTypeScripts,
 		"symlinks":  EntryTypeSymlinks,
@@ -79,10 +82,12 @@ var (
 		"noexternals",
 		"nofiles",
 		"none",
+		"nopackages",
 		"noremove",
 		"noscripts",
 		"nosymlinks",
 		"notemplates",
+		"packages",
 		"remove",
 		"scripts",
 		"symlinks",
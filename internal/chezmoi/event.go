@@ -0,0 +1,59 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"time"
+)
+
+// EventSchemaVersion is the version of the schema of Events. It is incremented
+// whenever a change is made to the schema that is not backwards compatible.
+const EventSchemaVersion = 1
+
+// An EventType is the type of an Event.
+type EventType string
+
+// Event types.
+const (
+	EventTypeDiff            EventType = "diff"
+	EventTypeError           EventType = "error"
+	EventTypeExternalFetched EventType = "externalFetched"
+	EventTypeScriptFinished  EventType = "scriptFinished"
+	EventTypeScriptStarted   EventType = "scriptStarted"
+	EventTypeTargetEvaluated EventType = "targetEvaluated"
+	EventTypeWrite           EventType = "write"
+)
+
+// Write event operations.
+const (
+	EventOpChmod        = "chmod"
+	EventOpLink         = "link"
+	EventOpMkdir        = "mkdir"
+	EventOpRemove       = "remove"
+	EventOpRename       = "rename"
+	EventOpWriteFile    = "writeFile"
+	EventOpWriteSymlink = "writeSymlink"
+)
+
+// An Event is a machine-readable record of something that chezmoi did. Only
+// the fields relevant to the event's type are set.
+type Event struct {
+	Version     int         `json:"version"`
+	Time        time.Time   `json:"time"`
+	Type        EventType   `json:"type"`
+	Path        string      `json:"path,omitempty"`
+	Op          string      `json:"op,omitempty"`
+	NewPath     string      `json:"newPath,omitempty"`
+	Linkname    string      `json:"linkname,omitempty"`
+	Mode        fs.FileMode `json:"mode,omitempty"`
+	Actual      *EntryState `json:"actual,omitempty"`
+	LastWritten *EntryState `json:"lastWritten,omitempty"`
+	Target      *EntryState `json:"target,omitempty"`
+	Diff        string      `json:"diff,omitempty"`
+	URL         string      `json:"url,omitempty"`
+	ExitCode    *int        `json:"exitCode,omitempty"`
+	Duration    *float64    `json:"duration,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// An EventFunc is called for each Event.
+type EventFunc func(*Event)
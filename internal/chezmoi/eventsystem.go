@@ -0,0 +1,215 @@
+package chezmoi
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"time"
+
+	"github.com/twpayne/go-vfs/v5"
+)
+
+// An EventSystem emits an Event for every change made to a System and for
+// every script run.
+type EventSystem struct {
+	system    System
+	eventFunc EventFunc
+}
+
+// NewEventSystem returns a new EventSystem that calls eventFunc for changes
+// made to system.
+func NewEventSystem(system System, eventFunc EventFunc) *EventSystem {
+	return &EventSystem{
+		system:    system,
+		eventFunc: eventFunc,
+	}
+}
+
+// Chmod implements System.Chmod.
+func (s *EventSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	if err := s.system.Chmod(name, mode); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type: EventTypeWrite,
+		Op:   EventOpChmod,
+		Path: name.String(),
+		Mode: mode,
+	})
+	return nil
+}
+
+// Chtimes implements System.Chtimes.
+func (s *EventSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *EventSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *EventSystem) Link(oldName, newName AbsPath) error {
+	if err := s.system.Link(oldName, newName); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type:    EventTypeWrite,
+		Op:      EventOpLink,
+		Path:    oldName.String(),
+		NewPath: newName.String(),
+	})
+	return nil
+}
+
+// Lstat implements System.Lstat.
+func (s *EventSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *EventSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	if err := s.system.Mkdir(name, perm); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type: EventTypeWrite,
+		Op:   EventOpMkdir,
+		Path: name.String(),
+		Mode: perm,
+	})
+	return nil
+}
+
+// RawPath implements System.RawPath.
+func (s *EventSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *EventSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *EventSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *EventSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *EventSystem) Remove(name AbsPath) error {
+	if err := s.system.Remove(name); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type: EventTypeWrite,
+		Op:   EventOpRemove,
+		Path: name.String(),
+	})
+	return nil
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *EventSystem) RemoveAll(name AbsPath) error {
+	if err := s.system.RemoveAll(name); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type: EventTypeWrite,
+		Op:   EventOpRemove,
+		Path: name.String(),
+	})
+	return nil
+}
+
+// Rename implements System.Rename.
+func (s *EventSystem) Rename(oldPath, newPath AbsPath) error {
+	if err := s.system.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type:    EventTypeWrite,
+		Op:      EventOpRename,
+		Path:    oldPath.String(),
+		NewPath: newPath.String(),
+	})
+	return nil
+}
+
+// RunCmd implements System.RunCmd.
+func (s *EventSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *EventSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	path := dir.JoinString(scriptName.Base()).String()
+	s.eventFunc(&Event{
+		Type: EventTypeScriptStarted,
+		Path: path,
+	})
+	start := time.Now()
+	err := s.system.RunScript(scriptName, dir, data, options)
+	duration := time.Since(start).Seconds()
+	exitCode := 0
+	event := &Event{
+		Type:     EventTypeScriptFinished,
+		Path:     path,
+		ExitCode: &exitCode,
+		Duration: &duration,
+	}
+	if err != nil {
+		if exitError := (&exec.ExitError{}); errors.As(err, &exitError) {
+			exitCode = exitError.ExitCode()
+		} else {
+			event.ExitCode = nil
+		}
+		event.Error = err.Error()
+	}
+	s.eventFunc(event)
+	return err
+}
+
+// Stat implements System.Stat.
+func (s *EventSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *EventSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *EventSystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	if err := s.system.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type: EventTypeWrite,
+		Op:   EventOpWriteFile,
+		Path: name.String(),
+		Mode: perm,
+	})
+	return nil
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *EventSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	if err := s.system.WriteSymlink(oldName, newName); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type:     EventTypeWrite,
+		Op:       EventOpWriteSymlink,
+		Path:     newName.String(),
+		Linkname: oldName,
+	})
+	return nil
+}
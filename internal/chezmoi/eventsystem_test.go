@@ -0,0 +1,34 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+var _ System = &EventSystem{}
+
+func TestEventSystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".file": "# contents of .file\n",
+		},
+	}, func(fileSystem vfs.FS) {
+		var events []*Event
+		system := NewEventSystem(NewRealSystem(fileSystem), func(event *Event) {
+			events = append(events, event)
+		})
+		assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.file"), []byte("# new contents of .file\n"), 0o666))
+		assert.NoError(t, system.Mkdir(NewAbsPath("/home/user/.dir"), 0o777))
+		assert.Error(t, system.Mkdir(NewAbsPath("/home/user/.missing/dir"), 0o777))
+		assert.NoError(t, system.RemoveAll(NewAbsPath("/home/user/.dir")))
+		assert.Equal(t, []*Event{
+			{Type: EventTypeWrite, Op: EventOpWriteFile, Path: "/home/user/.file", Mode: 0o666},
+			{Type: EventTypeWrite, Op: EventOpMkdir, Path: "/home/user/.dir", Mode: 0o777},
+			{Type: EventTypeWrite, Op: EventOpRemove, Path: "/home/user/.dir"},
+		}, events)
+	})
+}
@@ -0,0 +1,179 @@
+package chezmoi
+
+import (
+	"slices"
+	"strconv"
+	"time"
+)
+
+// A GenerationEntry records the change that a generation made to a target.
+type GenerationEntry struct {
+	Before         *EntryState `json:"before,omitempty"         yaml:"before,omitempty"`
+	BeforeLinkname string      `json:"beforeLinkname,omitempty" yaml:"beforeLinkname,omitempty"`
+	After          *EntryState `json:"after,omitempty"          yaml:"after,omitempty"`
+	AfterLinkname  string      `json:"afterLinkname,omitempty"  yaml:"afterLinkname,omitempty"`
+}
+
+// A Generation records the changes made to targets by a single command, for
+// example a run of apply.
+type Generation struct {
+	Number       int                          `json:"number"                 yaml:"number"`
+	Time         time.Time                    `json:"time"                   yaml:"time"`
+	Command      string                       `json:"command"                yaml:"command"`
+	SourceCommit string                       `json:"sourceCommit,omitempty" yaml:"sourceCommit,omitempty"`
+	Entries      map[AbsPath]*GenerationEntry `json:"entries"                yaml:"entries"`
+
+	backupStore *BackupStore
+}
+
+// PruneGenerationsOptions are options to PruneGenerations.
+type PruneGenerationsOptions struct {
+	MaxAge   time.Duration
+	MaxCount int
+	Now      time.Time
+}
+
+// NewGeneration returns a new Generation for command with sourceCommit. If
+// backupStore is not nil then the contents of files are stored in it so that
+// the generation can be rolled back.
+func NewGeneration(command, sourceCommit string, backupStore *BackupStore) *Generation {
+	return &Generation{
+		Time:         time.Now().UTC(),
+		Command:      command,
+		SourceCommit: sourceCommit,
+		Entries:      make(map[AbsPath]*GenerationEntry),
+		backupStore:  backupStore,
+	}
+}
+
+// Generations returns all generations in persistentState, oldest first.
+func Generations(persistentState PersistentState) ([]*Generation, error) {
+	var generations []*Generation
+	if err := persistentState.ForEach(GenerationStateBucket, func(k, v []byte) error {
+		var generation Generation
+		if err := stateFormat.Unmarshal(v, &generation); err != nil {
+			return err
+		}
+		generations = append(generations, &generation)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(generations, func(a, b *Generation) int {
+		return a.Number - b.Number
+	})
+	return generations, nil
+}
+
+// PruneGenerations removes generations older than options.MaxAge and all but
+// the most recent options.MaxCount generations from persistentState. A zero
+// options.MaxAge or options.MaxCount means no limit. It returns the removed
+// generations.
+func PruneGenerations(persistentState PersistentState, options PruneGenerationsOptions) ([]*Generation, error) {
+	generations, err := Generations(persistentState)
+	if err != nil {
+		return nil, err
+	}
+	var prunedGenerations []*Generation
+	for i, generation := range generations {
+		tooOld := options.MaxAge > 0 && options.Now.Sub(generation.Time) > options.MaxAge
+		tooMany := options.MaxCount > 0 && len(generations)-i > options.MaxCount
+		if !tooOld && !tooMany {
+			break
+		}
+		if err := persistentState.Delete(GenerationStateBucket, []byte(strconv.Itoa(generation.Number))); err != nil {
+			return nil, err
+		}
+		prunedGenerations = append(prunedGenerations, generation)
+	}
+	return prunedGenerations, nil
+}
+
+// Record records that g changed targetAbsPath as described by entry. If g
+// already changed targetAbsPath then only the state after is updated.
+func (g *Generation) Record(targetAbsPath AbsPath, entry *GenerationEntry) {
+	if prevEntry, ok := g.Entries[targetAbsPath]; ok {
+		prevEntry.After = entry.After
+		prevEntry.AfterLinkname = entry.AfterLinkname
+		return
+	}
+	g.Entries[targetAbsPath] = entry
+}
+
+// Save saves g to persistentState as the next generation, if g recorded any
+// changes.
+func (g *Generation) Save(persistentState PersistentState) error {
+	if len(g.Entries) == 0 {
+		return nil
+	}
+	generations, err := Generations(persistentState)
+	if err != nil {
+		return err
+	}
+	g.Number = 1
+	if len(generations) > 0 {
+		g.Number = generations[len(generations)-1].Number + 1
+	}
+	return PersistentStateSet(persistentState, GenerationStateBucket, []byte(strconv.Itoa(g.Number)), g)
+}
+
+// StoreContents stores the contents of actualStateEntry, if it is a file, so
+// that it can be restored when g is rolled back.
+func (g *Generation) StoreContents(actualStateEntry ActualStateEntry) error {
+	actualStateFile, ok := actualStateEntry.(*ActualStateFile)
+	if !ok || g.backupStore == nil {
+		return nil
+	}
+	contents, err := actualStateFile.Contents()
+	if err != nil {
+		return err
+	}
+	return g.backupStore.StoreContents(contents)
+}
+
+// newGenerationEntry returns a new GenerationEntry that describes applying
+// targetStateEntry over actualStateEntry, or nil if the change cannot be
+// recorded, for example because targetStateEntry is a script. It must be called
+// before targetStateEntry is applied.
+func newGenerationEntry(
+	actualStateEntry ActualStateEntry,
+	targetStateEntry TargetStateEntry,
+	targetEntryState *EntryState,
+) (*GenerationEntry, error) {
+	switch targetEntryState.Type {
+	case EntryStateTypeDir, EntryStateTypeFile, EntryStateTypeRemove, EntryStateTypeSymlink:
+	default:
+		return nil, nil
+	}
+	if _, ok := targetStateEntry.(*TargetStateModifyDirWithCmd); ok {
+		return nil, nil
+	}
+
+	entry := &GenerationEntry{}
+
+	before, err := actualStateEntry.EntryState()
+	if err != nil {
+		return nil, err
+	}
+	if before.Type != EntryStateTypeRemove {
+		entry.Before = before
+	}
+	if actualStateSymlink, ok := actualStateEntry.(*ActualStateSymlink); ok {
+		if entry.BeforeLinkname, err = actualStateSymlink.Linkname(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch targetStateEntry := targetStateEntry.(type) {
+	case *TargetStateRemove:
+	case *TargetStateSymlink:
+		entry.After = targetEntryState
+		if entry.AfterLinkname, err = targetStateEntry.Linkname(); err != nil {
+			return nil, err
+		}
+	default:
+		entry.After = targetEntryState
+	}
+
+	return entry, nil
+}
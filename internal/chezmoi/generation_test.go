@@ -0,0 +1,79 @@
+package chezmoi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestGenerations(t *testing.T) {
+	persistentState := NewMockPersistentState()
+	targetAbsPath := NewAbsPath("/home/user/.file")
+	fileV1 := &EntryState{Type: EntryStateTypeFile, Mode: 0o644, ContentsSHA256: HexBytes{1}}
+	fileV2 := &EntryState{Type: EntryStateTypeFile, Mode: 0o644, ContentsSHA256: HexBytes{2}}
+
+	// Test that empty generations are not saved.
+	assert.NoError(t, NewGeneration("apply", "", nil).Save(persistentState))
+	generations, err := Generations(persistentState)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(generations))
+
+	// Test that recording the same target twice keeps the first state before
+	// and the last state after.
+	generation1 := NewGeneration("apply", "0123456789abcdef", nil)
+	generation1.Record(targetAbsPath, &GenerationEntry{After: fileV1})
+	generation1.Record(targetAbsPath, &GenerationEntry{Before: fileV1, After: fileV2})
+	assert.Equal(t, &GenerationEntry{After: fileV2}, generation1.Entries[targetAbsPath])
+	assert.NoError(t, generation1.Save(persistentState))
+
+	// Test that generations are numbered consecutively.
+	generation2 := NewGeneration("rollback", "", nil)
+	generation2.Record(targetAbsPath, &GenerationEntry{Before: fileV2})
+	assert.NoError(t, generation2.Save(persistentState))
+
+	generations, err = Generations(persistentState)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(generations))
+	assert.Equal(t, 1, generations[0].Number)
+	assert.Equal(t, "apply", generations[0].Command)
+	assert.Equal(t, "0123456789abcdef", generations[0].SourceCommit)
+	assert.Equal(t, fileV2.ContentsSHA256, generations[0].Entries[targetAbsPath].After.ContentsSHA256)
+	assert.Equal(t, 2, generations[1].Number)
+	assert.Equal(t, "rollback", generations[1].Command)
+	assert.Equal(t, (*EntryState)(nil), generations[1].Entries[targetAbsPath].After)
+}
+
+func TestPruneGenerations(t *testing.T) {
+	persistentState := NewMockPersistentState()
+	now := time.Now().UTC()
+	for i := range 3 {
+		generation := NewGeneration("apply", "", nil)
+		generation.Time = now.Add(time.Duration(i-3) * time.Hour)
+		generation.Record(NewAbsPath("/home/user/.file"), &GenerationEntry{})
+		assert.NoError(t, generation.Save(persistentState))
+	}
+
+	// Test that generations older than MaxAge are pruned.
+	prunedGenerations, err := PruneGenerations(persistentState, PruneGenerationsOptions{
+		MaxAge: 150 * time.Minute,
+		Now:    now,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(prunedGenerations))
+	assert.Equal(t, 1, prunedGenerations[0].Number)
+
+	// Test that all but the most recent MaxCount generations are pruned.
+	prunedGenerations, err = PruneGenerations(persistentState, PruneGenerationsOptions{
+		MaxCount: 1,
+		Now:      now,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(prunedGenerations))
+	assert.Equal(t, 2, prunedGenerations[0].Number)
+
+	generations, err := Generations(persistentState)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(generations))
+	assert.Equal(t, 3, generations[0].Number)
+}
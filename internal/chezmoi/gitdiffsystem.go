@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"os/exec"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
@@ -21,6 +22,7 @@ import (
 type GitDiffSystem struct {
 	system         System
 	dirAbsPath     AbsPath
+	eventFunc      EventFunc
 	filter         *EntryTypeFilter
 	removedEntries chezmoiset.Set[AbsPath]
 	reverse        bool
@@ -32,6 +34,7 @@ type GitDiffSystem struct {
 // GitDiffSystemOptions are options for NewGitDiffSystem.
 type GitDiffSystemOptions struct {
 	Color          bool
+	EventFunc      EventFunc
 	Filter         *EntryTypeFilter
 	Reverse        bool
 	ScriptContents bool
@@ -49,6 +52,7 @@ func NewGitDiffSystem(system System, w io.Writer, dirAbsPath AbsPath, options *G
 	return &GitDiffSystem{
 		system:         system,
 		dirAbsPath:     dirAbsPath,
+		eventFunc:      options.EventFunc,
 		filter:         options.Filter,
 		removedEntries: chezmoiset.New[AbsPath](),
 		reverse:        options.Reverse,
@@ -230,7 +234,7 @@ func (s *GitDiffSystem) Rename(oldPath, newPath AbsPath) error {
 		if s.reverse {
 			fromPath, toPath = toPath, fromPath
 		}
-		if err := s.unifiedEncoder.Encode(&gitDiffPatch{
+		if err := s.encode(oldPath, &gitDiffPatch{
 			filePatches: []diff.FilePatch{
 				&gitDiffFilePatch{
 					from: &gitDiffFile{
@@ -281,7 +285,7 @@ func (s *GitDiffSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte,
 		if err != nil {
 			return err
 		}
-		if err := s.unifiedEncoder.Encode(diffPatch); err != nil {
+		if err := s.encode(dir.JoinString(scriptName.Base()), diffPatch); err != nil {
 			return err
 		}
 	}
@@ -326,6 +330,26 @@ func (s *GitDiffSystem) WriteSymlink(oldName string, newName AbsPath) error {
 	return s.system.WriteSymlink(oldName, newName)
 }
 
+// encode encodes patch, the diff of absPath, and emits it as an event.
+func (s *GitDiffSystem) encode(absPath AbsPath, patch diff.Patch) error {
+	if err := s.unifiedEncoder.Encode(patch); err != nil {
+		return err
+	}
+	if s.eventFunc == nil {
+		return nil
+	}
+	var builder strings.Builder
+	if err := diff.NewUnifiedEncoder(&builder, diff.DefaultContextLines).Encode(patch); err != nil {
+		return err
+	}
+	s.eventFunc(&Event{
+		Type: EventTypeDiff,
+		Path: absPath.String(),
+		Diff: builder.String(),
+	})
+	return nil
+}
+
 // encodeDiff encodes the diff between the actual state of absPath and the
 // target state of toData and toMode.
 func (s *GitDiffSystem) encodeDiff(absPath AbsPath, toData []byte, toMode fs.FileMode) error {
@@ -377,7 +401,7 @@ func (s *GitDiffSystem) encodeDiff(absPath AbsPath, toData []byte, toMode fs.Fil
 		return err
 	}
 
-	return s.unifiedEncoder.Encode(diffPatch)
+	return s.encode(absPath, diffPatch)
 }
 
 func (s *GitDiffSystem) isRemoved(absPath AbsPath) bool {
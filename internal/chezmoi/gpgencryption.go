@@ -1,27 +1,63 @@
 package chezmoi
 
 import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 
 	"github.com/twpayne/chezmoi/internal/chezmoierrors"
 	"github.com/twpayne/chezmoi/internal/chezmoilog"
 )
 
+const (
+	gpgArmorMessageType = "PGP MESSAGE"
+	gpgArmorHeader      = "-----BEGIN " + gpgArmorMessageType + "-----"
+)
+
+// maxGPGPassphraseAttempts is the maximum number of times that the builtin gpg
+// will prompt for a passphrase.
+const maxGPGPassphraseAttempts = 3
+
+var errGPGIncorrectPassphrase = errors.New("incorrect passphrase")
+
 // A GPGEncryption uses gpg for encryption and decryption. See https://gnupg.org/.
 type GPGEncryption struct {
-	Command    string   `json:"command"    mapstructure:"command"    yaml:"command"`
-	Args       []string `json:"args"       mapstructure:"args"       yaml:"args"`
-	Recipient  string   `json:"recipient"  mapstructure:"recipient"  yaml:"recipient"`
-	Recipients []string `json:"recipients" mapstructure:"recipients" yaml:"recipients"`
-	Symmetric  bool     `json:"symmetric"  mapstructure:"symmetric"  yaml:"symmetric"`
-	Suffix     string   `json:"suffix"     mapstructure:"suffix"     yaml:"suffix"`
+	UseBuiltin  bool      `json:"useBuiltin"  mapstructure:"useBuiltin"  yaml:"useBuiltin"`
+	Command     string    `json:"command"     mapstructure:"command"     yaml:"command"`
+	Args        []string  `json:"args"        mapstructure:"args"        yaml:"args"`
+	ArmoredKeys []string  `json:"armoredKeys" mapstructure:"armoredKeys" yaml:"armoredKeys"`
+	Keyring     AbsPath   `json:"keyring"     mapstructure:"keyring"     yaml:"keyring"`
+	Keyrings    []AbsPath `json:"keyrings"    mapstructure:"keyrings"    yaml:"keyrings"`
+	Passphrase  string    `json:"passphrase"  mapstructure:"passphrase"  yaml:"passphrase"`
+	Recipient   string    `json:"recipient"   mapstructure:"recipient"   yaml:"recipient"`
+	Recipients  []string  `json:"recipients"  mapstructure:"recipients"  yaml:"recipients"`
+	Symmetric   bool      `json:"symmetric"   mapstructure:"symmetric"   yaml:"symmetric"`
+	Suffix      string    `json:"suffix"      mapstructure:"suffix"      yaml:"suffix"`
+
+	// PassphraseFunc is called by the builtin gpg to read a passphrase if
+	// Passphrase is not set.
+	PassphraseFunc func(prompt string) (string, error) `json:"-" mapstructure:"-" yaml:"-"`
+
+	builtinKeyring    openpgp.EntityList
+	builtinPassphrase []byte
 }
 
 // Decrypt implements Encryption.Decrypt.
 func (e *GPGEncryption) Decrypt(ciphertext []byte) ([]byte, error) {
+	if e.UseBuiltin {
+		return e.builtinDecrypt(ciphertext)
+	}
+
 	var plaintext []byte
 	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		ciphertextAbsPath := tempDirAbsPath.JoinString("ciphertext" + e.EncryptedSuffix())
@@ -46,6 +82,14 @@ func (e *GPGEncryption) Decrypt(ciphertext []byte) ([]byte, error) {
 
 // DecryptToFile implements Encryption.DecryptToFile.
 func (e *GPGEncryption) DecryptToFile(plaintextAbsPath AbsPath, ciphertext []byte) error {
+	if e.UseBuiltin {
+		plaintext, err := e.builtinDecrypt(ciphertext)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(plaintextAbsPath.String(), plaintext, 0o644)
+	}
+
 	return withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		ciphertextAbsPath := tempDirAbsPath.JoinString("ciphertext" + e.EncryptedSuffix())
 		if err := os.WriteFile(ciphertextAbsPath.String(), ciphertext, 0o600); err != nil {
@@ -58,6 +102,10 @@ func (e *GPGEncryption) DecryptToFile(plaintextAbsPath AbsPath, ciphertext []byt
 
 // Encrypt implements Encryption.Encrypt.
 func (e *GPGEncryption) Encrypt(plaintext []byte) ([]byte, error) {
+	if e.UseBuiltin {
+		return e.builtinEncrypt(plaintext)
+	}
+
 	var ciphertext []byte
 	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		plaintextAbsPath := tempDirAbsPath.JoinString("plaintext")
@@ -82,6 +130,14 @@ func (e *GPGEncryption) Encrypt(plaintext []byte) ([]byte, error) {
 
 // EncryptFile implements Encryption.EncryptFile.
 func (e *GPGEncryption) EncryptFile(plaintextAbsPath AbsPath) ([]byte, error) {
+	if e.UseBuiltin {
+		plaintext, err := os.ReadFile(plaintextAbsPath.String())
+		if err != nil {
+			return nil, err
+		}
+		return e.builtinEncrypt(plaintext)
+	}
+
 	var ciphertext []byte
 	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
 		ciphertextAbsPath := tempDirAbsPath.JoinString("ciphertext" + e.EncryptedSuffix())
@@ -105,6 +161,174 @@ func (e *GPGEncryption) EncryptedSuffix() string {
 	return e.Suffix
 }
 
+// builtinDecrypt decrypts ciphertext using the builtin gpg.
+func (e *GPGEncryption) builtinDecrypt(ciphertext []byte) ([]byte, error) {
+	keyring, err := e.builtinKeys()
+	if err != nil {
+		return nil, err
+	}
+	var ciphertextReader io.Reader = bytes.NewReader(ciphertext)
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte(gpgArmorHeader)) {
+		block, err := armor.Decode(ciphertextReader)
+		if err != nil {
+			return nil, err
+		}
+		ciphertextReader = block.Body
+	}
+	attempts := 0
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if attempts++; attempts > maxGPGPassphraseAttempts || attempts > 1 && e.Passphrase != "" {
+			return nil, errGPGIncorrectPassphrase
+		}
+		passphrase, err := e.builtinReadPassphrase(attempts > 1)
+		if err != nil {
+			return nil, err
+		}
+		if symmetric {
+			return passphrase, nil
+		}
+		for _, key := range keys {
+			if key.PrivateKey != nil && key.PrivateKey.Encrypted {
+				_ = key.PrivateKey.Decrypt(passphrase)
+			}
+		}
+		return nil, nil
+	}
+	messageDetails, err := openpgp.ReadMessage(ciphertextReader, keyring, prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(messageDetails.UnverifiedBody)
+}
+
+// builtinEncrypt encrypts plaintext using the builtin gpg.
+func (e *GPGEncryption) builtinEncrypt(plaintext []byte) ([]byte, error) {
+	ciphertextBuffer := &bytes.Buffer{}
+	armoredCiphertextWriter, err := armor.Encode(ciphertextBuffer, gpgArmorMessageType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var plaintextWriteCloser io.WriteCloser
+	if e.Symmetric {
+		passphrase, err := e.builtinReadPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		plaintextWriteCloser, err = openpgp.SymmetricallyEncrypt(armoredCiphertextWriter, passphrase, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		recipients, err := e.builtinRecipients()
+		if err != nil {
+			return nil, err
+		}
+		plaintextWriteCloser, err = openpgp.Encrypt(armoredCiphertextWriter, recipients, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := plaintextWriteCloser.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := plaintextWriteCloser.Close(); err != nil {
+		return nil, err
+	}
+	if err := armoredCiphertextWriter.Close(); err != nil {
+		return nil, err
+	}
+	ciphertextBuffer.WriteByte('\n')
+	return ciphertextBuffer.Bytes(), nil
+}
+
+// builtinKeys returns the keys from the configured keyrings and armored keys
+// for use with the builtin gpg.
+func (e *GPGEncryption) builtinKeys() (openpgp.EntityList, error) {
+	if e.builtinKeyring != nil {
+		return e.builtinKeyring, nil
+	}
+	var keyring openpgp.EntityList
+	keyringAbsPaths := make([]AbsPath, 0, 1+len(e.Keyrings))
+	if !e.Keyring.IsEmpty() {
+		keyringAbsPaths = append(keyringAbsPaths, e.Keyring)
+	}
+	keyringAbsPaths = append(keyringAbsPaths, e.Keyrings...)
+	for _, keyringAbsPath := range keyringAbsPaths {
+		data, err := os.ReadFile(keyringAbsPath.String())
+		if err != nil {
+			return nil, err
+		}
+		entities, err := parseGPGKeyring(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyringAbsPath, err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	for _, armoredKey := range e.ArmoredKeys {
+		entities, err := parseGPGKeyring([]byte(armoredKey))
+		if err != nil {
+			return nil, err
+		}
+		keyring = append(keyring, entities...)
+	}
+	e.builtinKeyring = keyring
+	return keyring, nil
+}
+
+// builtinReadPassphrase returns the passphrase for use with the builtin gpg,
+// prompting for it if needed.
+func (e *GPGEncryption) builtinReadPassphrase(retry bool) ([]byte, error) {
+	switch {
+	case e.Passphrase != "":
+		return []byte(e.Passphrase), nil
+	case e.builtinPassphrase != nil && !retry:
+		return e.builtinPassphrase, nil
+	case e.PassphraseFunc == nil:
+		return nil, errors.New("no passphrase")
+	}
+	prompt := "Enter passphrase: "
+	if retry {
+		prompt = "Incorrect passphrase, try again: "
+	}
+	passphrase, err := e.PassphraseFunc(prompt)
+	if err != nil {
+		return nil, err
+	}
+	e.builtinPassphrase = []byte(passphrase)
+	return e.builtinPassphrase, nil
+}
+
+// builtinRecipients returns the recipients for encryption using the builtin
+// gpg.
+func (e *GPGEncryption) builtinRecipients() ([]*openpgp.Entity, error) {
+	keyring, err := e.builtinKeys()
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]string, 0, 1+len(e.Recipients))
+	if e.Recipient != "" {
+		recipients = append(recipients, e.Recipient)
+	}
+	recipients = append(recipients, e.Recipients...)
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	entities := make([]*openpgp.Entity, 0, len(recipients))
+FOR:
+	for _, recipient := range recipients {
+		for _, entity := range keyring {
+			if gpgEntityMatches(entity, recipient) {
+				entities = append(entities, entity)
+				continue FOR
+			}
+		}
+		return nil, fmt.Errorf("%s: no public key", recipient)
+	}
+	return entities, nil
+}
+
 // decryptArgs returns the arguments for decryption.
 func (e *GPGEncryption) decryptArgs(plaintextAbsPath, ciphertextAbsPath AbsPath) []string {
 	args := []string{"--output", plaintextAbsPath.String()}
@@ -146,6 +370,44 @@ func (e *GPGEncryption) run(args []string) error {
 	return chezmoilog.LogCmdRun(slog.Default(), cmd)
 }
 
+// gpgEntityMatches returns true if entity matches recipient. recipient can be a
+// fingerprint, a long or short key ID, an email address, or a substring of a
+// user ID, as accepted by gpg's --recipient option.
+func gpgEntityMatches(entity *openpgp.Entity, recipient string) bool {
+	keyID := strings.ToUpper(strings.TrimPrefix(recipient, "0x"))
+	if len(keyID) >= 8 {
+		fingerprints := [][]byte{entity.PrimaryKey.Fingerprint}
+		for _, subkey := range entity.Subkeys {
+			fingerprints = append(fingerprints, subkey.PublicKey.Fingerprint)
+		}
+		for _, fingerprint := range fingerprints {
+			if strings.HasSuffix(strings.ToUpper(hex.EncodeToString(fingerprint)), keyID) {
+				return true
+			}
+		}
+	}
+	lowerRecipient := strings.ToLower(recipient)
+	for name, identity := range entity.Identities {
+		switch {
+		case strings.HasPrefix(lowerRecipient, "<") && strings.HasSuffix(lowerRecipient, ">"):
+			if strings.EqualFold(identity.UserId.Email, lowerRecipient[1:len(lowerRecipient)-1]) {
+				return true
+			}
+		case strings.Contains(strings.ToLower(name), lowerRecipient):
+			return true
+		}
+	}
+	return false
+}
+
+// parseGPGKeyring parses an armored or binary keyring from data.
+func parseGPGKeyring(data []byte) (openpgp.EntityList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN ")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
 // withPrivateTempDir creates a private temporary and calls f.
 func withPrivateTempDir(f func(tempDirAbsPath AbsPath) error) (err error) {
 	var tempDir string
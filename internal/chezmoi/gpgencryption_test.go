@@ -1,9 +1,15 @@
 package chezmoi
 
 import (
+	"encoding/hex"
+	"os"
+	"os/exec"
 	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/alecthomas/assert/v2"
 
 	"github.com/twpayne/chezmoi/internal/chezmoitest"
@@ -47,3 +53,124 @@ func TestGPGEncryption(t *testing.T) {
 		})
 	}
 }
+
+func TestBuiltinGPGEncryption(t *testing.T) {
+	entity, err := openpgp.NewEntity("chezmoi-test-gpg-key", "", "chezmoi-test-gpg-key@example.com", nil)
+	assert.NoError(t, err)
+	armoredPrivateKey := &strings.Builder{}
+	armoredPrivateKeyWriteCloser, err := armor.Encode(armoredPrivateKey, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, entity.SerializePrivate(armoredPrivateKeyWriteCloser, nil))
+	assert.NoError(t, armoredPrivateKeyWriteCloser.Close())
+
+	keyringAbsPath := NewAbsPath(t.TempDir()).JoinString("keyring.asc")
+	assert.NoError(t, os.WriteFile(keyringAbsPath.String(), []byte(armoredPrivateKey.String()), 0o600))
+
+	for _, tc := range []struct {
+		name       string
+		encryption *GPGEncryption
+	}{
+		{
+			name: "armored_key",
+			encryption: &GPGEncryption{
+				UseBuiltin:  true,
+				ArmoredKeys: []string{armoredPrivateKey.String()},
+				Recipient:   "chezmoi-test-gpg-key@example.com",
+			},
+		},
+		{
+			name: "keyring",
+			encryption: &GPGEncryption{
+				UseBuiltin: true,
+				Keyring:    keyringAbsPath,
+				Recipient:  hex.EncodeToString(entity.PrimaryKey.Fingerprint),
+			},
+		},
+		{
+			name: "symmetric",
+			encryption: &GPGEncryption{
+				UseBuiltin: true,
+				Passphrase: "chezmoi-test-gpg-passphrase",
+				Symmetric:  true,
+			},
+		},
+		{
+			name: "symmetric_passphrase_func",
+			encryption: &GPGEncryption{
+				UseBuiltin: true,
+				Symmetric:  true,
+				PassphraseFunc: func(prompt string) (string, error) {
+					return "chezmoi-test-gpg-passphrase", nil
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testEncryption(t, tc.encryption)
+		})
+	}
+}
+
+func TestBuiltinGPGEncryptionInterop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping gpg tests on Windows")
+	}
+	command := lookPathOrSkip(t, "gpg")
+
+	tempDir := t.TempDir()
+	key, passphrase, err := chezmoitest.GPGGenerateKey(command, tempDir)
+	assert.NoError(t, err)
+	args := []string{
+		"--homedir", tempDir,
+		"--no-tty",
+		"--passphrase", passphrase,
+		"--pinentry-mode", "loopback",
+	}
+
+	exportCmd := exec.Command(command, append(args, "--armor", "--export-secret-keys", key)...) //nolint:gosec
+	armoredPrivateKey, err := exportCmd.Output()
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		symmetric bool
+	}{
+		{
+			name:      "asymmetric",
+			symmetric: false,
+		},
+		{
+			name:      "symmetric",
+			symmetric: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gpgEncryption := &GPGEncryption{
+				Command:   command,
+				Args:      args,
+				Recipient: key,
+				Symmetric: tc.symmetric,
+			}
+			builtinGPGEncryption := &GPGEncryption{
+				UseBuiltin:  true,
+				ArmoredKeys: []string{string(armoredPrivateKey)},
+				Passphrase:  passphrase,
+				Recipient:   key,
+				Symmetric:   tc.symmetric,
+			}
+			plaintext := []byte("plaintext\n")
+
+			gpgCiphertext, err := gpgEncryption.Encrypt(plaintext)
+			assert.NoError(t, err)
+			actualPlaintext, err := builtinGPGEncryption.Decrypt(gpgCiphertext)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, actualPlaintext)
+
+			builtinCiphertext, err := builtinGPGEncryption.Encrypt(plaintext)
+			assert.NoError(t, err)
+			actualPlaintext, err = gpgEncryption.Decrypt(builtinCiphertext)
+			assert.NoError(t, err)
+			assert.Equal(t, plaintext, actualPlaintext)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package chezmoi
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// A Handler is a command that is run at the end of an apply if any target that
+// matches one of its patterns was written.
+type Handler struct {
+	Name                string   `json:"-"       toml:"-"       yaml:"-"`
+	Targets             []string `json:"targets" toml:"targets" yaml:"targets"`
+	Command             string   `json:"command" toml:"command" yaml:"command"`
+	Args                []string `json:"args"    toml:"args"    yaml:"args"`
+	parentTargetRelPath RelPath
+	sourceAbsPath       AbsPath
+}
+
+// Match returns true if targetRelPath matches any of h's targets.
+func (h *Handler) Match(targetRelPath RelPath) bool {
+	for _, pattern := range h.Targets {
+		if !h.parentTargetRelPath.Empty() {
+			pattern = path.Join(h.parentTargetRelPath.String(), pattern)
+		}
+		if ok, _ := doublestar.Match(pattern, targetRelPath.String()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceAbsPath returns the absolute path of the file that defines h.
+func (h *Handler) SourceAbsPath() AbsPath {
+	return h.sourceAbsPath
+}
+
+// Handlers returns s's handlers, sorted by name.
+func (s *SourceState) Handlers() []*Handler {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	handlers := make([]*Handler, 0, len(s.handlers))
+	for _, name := range slices.Sorted(maps.Keys(s.handlers)) {
+		handlers = append(handlers, s.handlers[name])
+	}
+	return handlers
+}
+
+// addHandlers adds the handlers defined in the file at sourceAbsPath, whose
+// targets are relative to parentAbsPath, to s.
+func (s *SourceState) addHandlers(sourceAbsPath, parentAbsPath AbsPath) error {
+	parentRelPath, err := parentAbsPath.TrimDirPrefix(s.sourceDirAbsPath)
+	if err != nil {
+		return err
+	}
+	parentSourceRelPath := NewSourceRelDirPath(parentRelPath.String())
+	parentTargetRelPath := parentSourceRelPath.TargetRelPath(s.encryption.EncryptedSuffix())
+
+	format, err := FormatFromAbsPath(sourceAbsPath.TrimSuffix(TemplateSuffix))
+	if err != nil {
+		return err
+	}
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	handlers := make(map[string]*Handler)
+	if err := format.Unmarshal(data, &handlers); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for name, handler := range handlers {
+		switch {
+		case handler == nil || handler.Command == "":
+			return fmt.Errorf("%s: %s: missing command", sourceAbsPath, name)
+		case len(handler.Targets) == 0:
+			return fmt.Errorf("%s: %s: missing targets", sourceAbsPath, name)
+		}
+		for _, pattern := range handler.Targets {
+			if !doublestar.ValidatePattern(pattern) {
+				return fmt.Errorf("%s: %s: %s: invalid pattern", sourceAbsPath, name, pattern)
+			}
+		}
+		if otherHandler, ok := s.handlers[name]; ok {
+			return fmt.Errorf("%s: %s: handler already defined in %s", sourceAbsPath, name, otherHandler.sourceAbsPath)
+		}
+		handler.Name = name
+		handler.parentTargetRelPath = parentTargetRelPath
+		handler.sourceAbsPath = sourceAbsPath
+		s.handlers[name] = handler
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestSourceStateHandlers(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		root          any
+		targetRelPath RelPath
+		expectedNames []string
+		expectedErr   string
+	}{
+		{
+			name: "match",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihandlers.toml": chezmoitest.JoinLines(
+						`[b]`,
+						`    targets = [".config/b/*"]`,
+						`    command = "b"`,
+						`[a]`,
+						`    targets = [".config/**/*.conf"]`,
+						`    command = "a"`,
+					),
+				},
+			},
+			targetRelPath: NewRelPath(".config/b/b.conf"),
+			expectedNames: []string{"a", "b"},
+		},
+		{
+			name: "relative_to_parent",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_config": map[string]any{
+						".chezmoihandlers.yaml": chezmoitest.JoinLines(
+							`a:`,
+							`  targets: ["a/*"]`,
+							`  command: a`,
+						),
+					},
+				},
+			},
+			targetRelPath: NewRelPath(".config/a/file"),
+			expectedNames: []string{"a"},
+		},
+		{
+			name: "no_match",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihandlers.json": `{"a":{"targets":[".a"],"command":"a"}}`,
+				},
+			},
+			targetRelPath: NewRelPath(".b"),
+		},
+		{
+			name: "missing_command",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihandlers.json": `{"a":{"targets":[".a"]}}`,
+				},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoihandlers.json: a: missing command",
+		},
+		{
+			name: "missing_targets",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihandlers.json": `{"a":{"command":"a"}}`,
+				},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoihandlers.json: a: missing targets",
+		},
+		{
+			name: "invalid_pattern",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihandlers.json": `{"a":{"targets":["["],"command":"a"}}`,
+				},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoihandlers.json: a: [: invalid pattern",
+		},
+		{
+			name: "duplicate",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihandlers.json": `{"a":{"targets":[".a"],"command":"a"}}`,
+					"dot_dir": map[string]any{
+						".chezmoihandlers.json": `{"a":{"targets":["a"],"command":"a"}}`,
+					},
+				},
+			},
+			expectedErr: "handler already defined",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				system := NewRealSystem(fileSystem)
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+				)
+				err := s.Read(t.Context(), nil)
+				if tc.expectedErr != "" {
+					assert.Error(t, err)
+					assert.Contains(t, err.Error(), tc.expectedErr)
+					return
+				}
+				assert.NoError(t, err)
+				var actualNames []string
+				for _, handler := range s.Handlers() {
+					if handler.Match(tc.targetRelPath) {
+						actualNames = append(actualNames, handler.Name)
+					}
+				}
+				assert.Equal(t, tc.expectedNames, actualNames)
+			})
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package chezmoi
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+)
+
+// A HookCommand is a command run by a Hook.
+type HookCommand struct {
+	Command     string   `json:"command,omitempty"     toml:"command"     yaml:"command"`
+	Script      string   `json:"script,omitempty"      toml:"script"      yaml:"script"`
+	Args        []string `json:"args,omitempty"        toml:"args"        yaml:"args"`
+	PayloadFile bool     `json:"payloadFile,omitempty" toml:"payloadFile" yaml:"payloadFile"`
+}
+
+// A Hook is a pair of commands that are run before and after an event, defined
+// in the source state.
+type Hook struct {
+	Event         string      `json:"event" toml:"-"    yaml:"-"`
+	Pre           HookCommand `json:"pre"   toml:"pre"  yaml:"pre"`
+	Post          HookCommand `json:"post"  toml:"post" yaml:"post"`
+	sourceAbsPath AbsPath
+}
+
+// SourceAbsPath returns the absolute path of the file that defines h.
+func (h *Hook) SourceAbsPath() AbsPath {
+	return h.sourceAbsPath
+}
+
+// Hooks returns s's hooks, in the order in which their files were read and then
+// sorted by event.
+func (s *SourceState) Hooks() []*Hook {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.hooks)
+}
+
+// addHooks adds the hooks defined in the file at sourceAbsPath to s. Relative
+// script paths are relative to parentAbsPath.
+func (s *SourceState) addHooks(sourceAbsPath, parentAbsPath AbsPath) error {
+	format, err := FormatFromAbsPath(sourceAbsPath.TrimSuffix(TemplateSuffix))
+	if err != nil {
+		return err
+	}
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	hooks := make(map[string]*Hook)
+	if err := format.Unmarshal(data, &hooks); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, event := range slices.Sorted(maps.Keys(hooks)) {
+		hook := hooks[event]
+		if hook == nil {
+			continue
+		}
+		for _, hookCommand := range []*HookCommand{&hook.Pre, &hook.Post} {
+			switch {
+			case hookCommand.Command != "" && hookCommand.Script != "":
+				return fmt.Errorf("%s: %s: cannot specify both command and script", sourceAbsPath, event)
+			case hookCommand.Script != "" && !filepath.IsAbs(hookCommand.Script):
+				hookCommand.Script = parentAbsPath.JoinString(hookCommand.Script).String()
+			}
+		}
+		hook.Event = event
+		hook.sourceAbsPath = sourceAbsPath
+		s.hooks = append(s.hooks, hook)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestSourceStateHooks(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		root          any
+		expectedHooks []*Hook
+		expectedErr   string
+	}{
+		{
+			name: "hooks",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihooks.toml": chezmoitest.JoinLines(
+						`[read-source-state.pre]`,
+						`    command = "echo"`,
+						`    args = ["read-source-state"]`,
+						`[apply.post]`,
+						`    script = "hooks/apply.sh"`,
+					),
+				},
+			},
+			expectedHooks: []*Hook{
+				{
+					Event: "apply",
+					Post: HookCommand{
+						Script: "/home/user/.local/share/chezmoi/hooks/apply.sh",
+					},
+					sourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/.chezmoihooks.toml"),
+				},
+				{
+					Event: "read-source-state",
+					Pre: HookCommand{
+						Command: "echo",
+						Args:    []string{"read-source-state"},
+					},
+					sourceAbsPath: NewAbsPath("/home/user/.local/share/chezmoi/.chezmoihooks.toml"),
+				},
+			},
+		},
+		{
+			name: "ignored_dir",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiignore": "ignored\n",
+					"ignored": map[string]any{
+						".chezmoihooks.json": `{"apply":{"pre":{"command":"echo"}}}`,
+					},
+				},
+			},
+		},
+		{
+			name: "command_and_script",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoihooks.json": `{"apply":{"pre":{"command":"echo","script":"apply.sh"}}}`,
+				},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoihooks.json: apply: cannot specify both command and script",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				system := NewRealSystem(fileSystem)
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithHooksOnly(true),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+				)
+				err := s.Read(t.Context(), nil)
+				if tc.expectedErr != "" {
+					assert.EqualError(t, err, tc.expectedErr)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedHooks, s.Hooks())
+			})
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package chezmoi
+
+import "strconv"
+
+// EncryptInline returns a template action that evaluates to plaintext, with
+// plaintext encrypted by encryption.
+func EncryptInline(encryption Encryption, plaintext []byte) (string, error) {
+	ciphertext, err := encryption.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return "{{ decrypt " + strconv.Quote(string(ciphertext)) + " }}", nil
+}
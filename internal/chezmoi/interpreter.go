@@ -1,6 +1,7 @@
 package chezmoi
 
 import (
+	"context"
 	"log/slog"
 	"os/exec"
 )
@@ -19,6 +20,14 @@ func (i *Interpreter) ExecCommand(name string) *exec.Cmd {
 	return exec.Command(i.Command, append(i.Args, name)...)
 }
 
+// ExecCommandContext returns the *exec.Cmd to interpret name with ctx.
+func (i *Interpreter) ExecCommandContext(ctx context.Context, name string) *exec.Cmd {
+	if i.None() {
+		return exec.CommandContext(ctx, name)
+	}
+	return exec.CommandContext(ctx, i.Command, append(i.Args, name)...)
+}
+
 // None returns if i represents no interpreter.
 func (i *Interpreter) None() bool {
 	return i == nil || i.Command == ""
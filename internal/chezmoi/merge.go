@@ -0,0 +1,188 @@
+package chezmoi
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Conflict markers.
+const (
+	ConflictMarkerStart  = "<<<<<<<"
+	ConflictMarkerMiddle = "======="
+	ConflictMarkerEnd    = ">>>>>>>"
+)
+
+// A Hunk replaces the lines [Start, End) of a file with Lines.
+type Hunk struct {
+	Start int
+	End   int
+	Lines []string
+}
+
+// ThreeWayMerge merges the changes from base to ours and from base to theirs.
+// It returns the merged contents and the number of conflicts. Conflicts are
+// marked with git-style conflict markers labeled with oursLabel and
+// theirsLabel.
+func ThreeWayMerge(base, ours, theirs []byte, oursLabel, theirsLabel string) ([]byte, int) {
+	baseLines := SplitLines(string(base))
+	oursHunks := DiffHunks(base, ours)
+	theirsHunks := DiffHunks(base, theirs)
+
+	var builder strings.Builder
+	conflicts := 0
+	pos := 0
+	for len(oursHunks) > 0 || len(theirsHunks) > 0 {
+		// Find the next group of overlapping hunks from both sides.
+		var start int
+		switch {
+		case len(oursHunks) == 0:
+			start = theirsHunks[0].Start
+		case len(theirsHunks) == 0:
+			start = oursHunks[0].Start
+		default:
+			start = min(oursHunks[0].Start, theirsHunks[0].Start)
+		}
+		end := start
+		var oursGroup, theirsGroup []Hunk
+	GROUP:
+		for {
+			switch {
+			case len(oursHunks) > 0 && oursHunks[0].Start <= end:
+				end = max(end, oursHunks[0].End)
+				oursGroup = append(oursGroup, oursHunks[0])
+				oursHunks = oursHunks[1:]
+			case len(theirsHunks) > 0 && theirsHunks[0].Start <= end:
+				end = max(end, theirsHunks[0].End)
+				theirsGroup = append(theirsGroup, theirsHunks[0])
+				theirsHunks = theirsHunks[1:]
+			default:
+				break GROUP
+			}
+		}
+
+		writeLines(&builder, baseLines[pos:start])
+		oursLines := applyMergeHunks(baseLines, start, end, oursGroup)
+		theirsLines := applyMergeHunks(baseLines, start, end, theirsGroup)
+		switch {
+		case len(theirsGroup) == 0:
+			writeLines(&builder, oursLines)
+		case len(oursGroup) == 0 || slices.Equal(oursLines, theirsLines):
+			writeLines(&builder, theirsLines)
+		default:
+			conflicts++
+			builder.WriteString(ConflictMarkerStart + " " + oursLabel + "\n")
+			writeConflictLines(&builder, oursLines)
+			builder.WriteString(ConflictMarkerMiddle + "\n")
+			writeConflictLines(&builder, theirsLines)
+			builder.WriteString(ConflictMarkerEnd + " " + theirsLabel + "\n")
+		}
+		pos = end
+	}
+	writeLines(&builder, baseLines[pos:])
+
+	return []byte(builder.String()), conflicts
+}
+
+// ApplyHunks returns contents with hunks applied. hunks must be sorted and
+// must not overlap.
+func ApplyHunks(contents []byte, hunks []Hunk) []byte {
+	lines := SplitLines(string(contents))
+	var builder strings.Builder
+	writeLines(&builder, applyMergeHunks(lines, 0, len(lines), hunks))
+	return []byte(builder.String())
+}
+
+// DiffHunks returns the hunks that transform from into to.
+func DiffHunks(from, to []byte) []Hunk {
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = time.Second
+	fromRunes, toRunes, runesToLines := dmp.DiffLinesToRunes(string(from), string(to))
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(fromRunes, toRunes, false), runesToLines)
+
+	var hunks []Hunk
+	var hunk *Hunk
+	pos := 0
+	for _, diff := range diffs {
+		lines := SplitLines(diff.Text)
+		if diff.Type == diffmatchpatch.DiffEqual {
+			if hunk != nil {
+				hunks = append(hunks, *hunk)
+				hunk = nil
+			}
+			pos += len(lines)
+			continue
+		}
+		if hunk == nil {
+			hunk = &Hunk{
+				Start: pos,
+				End:   pos,
+			}
+		}
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			pos += len(lines)
+			hunk.End = pos
+		case diffmatchpatch.DiffInsert:
+			hunk.Lines = append(hunk.Lines, lines...)
+		}
+	}
+	if hunk != nil {
+		hunks = append(hunks, *hunk)
+	}
+	return hunks
+}
+
+// HasConflictMarkers returns if contents contains conflict markers.
+func HasConflictMarkers(contents []byte) bool {
+	for _, line := range bytes.SplitAfter(contents, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte(ConflictMarkerStart+" ")) || bytes.HasPrefix(line, []byte(ConflictMarkerEnd+" ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitLines splits s into lines, keeping line endings.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// applyMergeHunks returns the lines [start, end) of baseLines with hunks
+// applied.
+func applyMergeHunks(baseLines []string, start, end int, hunks []Hunk) []string {
+	var lines []string
+	pos := start
+	for _, hunk := range hunks {
+		lines = append(lines, baseLines[pos:hunk.Start]...)
+		lines = append(lines, hunk.Lines...)
+		pos = hunk.End
+	}
+	return append(lines, baseLines[pos:end]...)
+}
+
+// writeConflictLines writes lines to builder, ensuring that the last line ends
+// with a newline so that the following conflict marker is on its own line.
+func writeConflictLines(builder *strings.Builder, lines []string) {
+	writeLines(builder, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		builder.WriteByte('\n')
+	}
+}
+
+// writeLines writes lines to builder.
+func writeLines(builder *strings.Builder, lines []string) {
+	for _, line := range lines {
+		builder.WriteString(line)
+	}
+}
@@ -0,0 +1,100 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestThreeWayMerge(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		base              string
+		ours              string
+		theirs            string
+		expected          string
+		expectedConflicts int
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "unchanged",
+			base:     "a\nb\nc\n",
+			ours:     "a\nb\nc\n",
+			theirs:   "a\nb\nc\n",
+			expected: "a\nb\nc\n",
+		},
+		{
+			name:     "ours",
+			base:     "a\nb\nc\n",
+			ours:     "a\nB\nc\n",
+			theirs:   "a\nb\nc\n",
+			expected: "a\nB\nc\n",
+		},
+		{
+			name:     "theirs",
+			base:     "a\nb\nc\n",
+			ours:     "a\nb\nc\n",
+			theirs:   "a\nb\nc\nd\n",
+			expected: "a\nb\nc\nd\n",
+		},
+		{
+			name:     "both_separate",
+			base:     "a\nb\nc\nd\ne\n",
+			ours:     "A\nb\nc\nd\ne\n",
+			theirs:   "a\nb\nc\nd\nE\n",
+			expected: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:     "both_identical",
+			base:     "a\nb\nc\n",
+			ours:     "a\nB\nc\n",
+			theirs:   "a\nB\nc\n",
+			expected: "a\nB\nc\n",
+		},
+		{
+			name:              "conflict",
+			base:              "a\nb\nc\n",
+			ours:              "a\nours\nc\n",
+			theirs:            "a\ntheirs\nc\n",
+			expected:          "a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\nc\n",
+			expectedConflicts: 1,
+		},
+		{
+			name:              "conflict_no_final_newline",
+			base:              "a\nb",
+			ours:              "a\nours",
+			theirs:            "a\ntheirs",
+			expected:          "a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n",
+			expectedConflicts: 1,
+		},
+		{
+			name:              "no_base",
+			ours:              "ours\n",
+			theirs:            "theirs\n",
+			expected:          "<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n",
+			expectedConflicts: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, actualConflicts := ThreeWayMerge([]byte(tc.base), []byte(tc.ours), []byte(tc.theirs), "ours", "theirs")
+			assert.Equal(t, tc.expected, string(actual))
+			assert.Equal(t, tc.expectedConflicts, actualConflicts)
+			assert.Equal(t, tc.expectedConflicts != 0, HasConflictMarkers(actual))
+		})
+	}
+}
+
+func TestDiffHunks(t *testing.T) {
+	from := []byte("a\nb\nc\nd\ne\n")
+	to := []byte("A\nb\nc\nd\n")
+	hunks := DiffHunks(from, to)
+	assert.Equal(t, []Hunk{
+		{Start: 0, End: 1, Lines: []string{"A\n"}},
+		{Start: 4, End: 5},
+	}, hunks)
+	assert.Equal(t, to, ApplyHunks(from, hunks))
+	assert.Equal(t, "A\nb\nc\nd\ne\n", string(ApplyHunks(from, hunks[:1])))
+	assert.Equal(t, from, ApplyHunks(from, nil))
+}
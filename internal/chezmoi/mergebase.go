@@ -0,0 +1,107 @@
+package chezmoi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// A mergeBaseState records the contents of a file last written by chezmoi. If
+// Encrypted is true then Contents are encrypted.
+type mergeBaseState struct {
+	ContentsSHA256 HexBytes `json:"contentsSHA256"      yaml:"contentsSHA256"` //nolint:tagliatelle
+	Contents       []byte   `json:"contents"            yaml:"contents"`
+	Encrypted      bool     `json:"encrypted,omitempty" yaml:"encrypted,omitempty"`
+}
+
+// MergeBase returns the contents last written to targetAbsPath, for use as the
+// base of a three-way merge. It returns nil if the contents are not known or
+// do not match lastWrittenEntryState. Encrypted contents are decrypted with
+// encryption.
+func MergeBase(
+	persistentState PersistentState,
+	targetAbsPath AbsPath,
+	lastWrittenEntryState *EntryState,
+	encryption Encryption,
+) ([]byte, error) {
+	if lastWrittenEntryState == nil || lastWrittenEntryState.Type != EntryStateTypeFile {
+		return nil, nil
+	}
+	var state mergeBaseState
+	switch ok, err := PersistentStateGet(persistentState, MergeBaseStateBucket, targetAbsPath.Bytes(), &state); {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, nil
+	case !bytes.Equal(state.ContentsSHA256, lastWrittenEntryState.ContentsSHA256):
+		return nil, nil
+	case !state.Encrypted:
+		return state.Contents, nil
+	}
+	contents, err := encryption.Decrypt(state.Contents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: merge base: %w", targetAbsPath, err)
+	}
+	return contents, nil
+}
+
+// SetMergeBase records contents as the contents last written to
+// targetAbsPath. If encryption is not nil then contents are encrypted with
+// encryption. If encryption is NoEncryption then any existing merge base is
+// removed instead.
+func SetMergeBase(persistentState PersistentState, targetAbsPath AbsPath, contents []byte, encryption Encryption) error {
+	contentsSHA256 := sha256.Sum256(contents)
+	state := &mergeBaseState{
+		ContentsSHA256: HexBytes(contentsSHA256[:]),
+		Contents:       contents,
+	}
+	if encryption != nil {
+		switch ciphertext, err := encryption.Encrypt(contents); {
+		case errors.Is(err, errNoEncryption):
+			return persistentState.Delete(MergeBaseStateBucket, targetAbsPath.Bytes())
+		case err != nil:
+			return err
+		default:
+			state.Contents = ciphertext
+			state.Encrypted = true
+		}
+	}
+	return PersistentStateSet(persistentState, MergeBaseStateBucket, targetAbsPath.Bytes(), state)
+}
+
+// CanStoreMergeBase returns if the contents of sourceStateEntry's target can
+// be recorded as a merge base, and if they must be encrypted. Templates cannot
+// be merged into, and the plaintext contents of encrypted, private, and SOPS
+// files are never written to the persistent state.
+func CanStoreMergeBase(sourceStateEntry SourceStateEntry) (ok, encrypt bool) {
+	sourceStateFile, ok := sourceStateEntry.(*SourceStateFile)
+	if !ok {
+		return false, false
+	}
+	attr := sourceStateFile.Attr
+	if attr.Type != SourceFileTypeFile || attr.Template {
+		return false, false
+	}
+	return true, attr.Encrypted || attr.Private || attr.SOPS
+}
+
+// setLastWrittenEntryState records entryState as the entry state last written
+// to targetAbsPath. If storeMergeBase is true then its contents are also
+// recorded as the base for future merges, encrypted with mergeBaseEncryption if
+// it is not nil, otherwise any existing merge base is removed.
+func setLastWrittenEntryState(
+	persistentState PersistentState,
+	targetAbsPath AbsPath,
+	entryState *EntryState,
+	storeMergeBase bool,
+	mergeBaseEncryption Encryption,
+) error {
+	if err := PersistentStateSet(persistentState, EntryStateBucket, targetAbsPath.Bytes(), entryState); err != nil {
+		return err
+	}
+	if storeMergeBase && entryState.Type == EntryStateTypeFile {
+		return SetMergeBase(persistentState, targetAbsPath, entryState.contents, mergeBaseEncryption)
+	}
+	return persistentState.Delete(MergeBaseStateBucket, targetAbsPath.Bytes())
+}
@@ -0,0 +1,228 @@
+package chezmoi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+)
+
+// packagesAllOS is the key of the packages that are installed on all operating
+// systems.
+const packagesAllOS = "all"
+
+// A PackageManager is a package manager that chezmoi can query for installed
+// packages and use to install missing packages.
+type PackageManager struct {
+	Name         string
+	listArgs     []string
+	installArgs  []string
+	parseListCmd func([]byte) ([]string, error)
+}
+
+// packageManagers is the package managers that chezmoi supports, indexed by
+// name.
+var packageManagers = map[string]*PackageManager{
+	"apt": {
+		Name:         "apt",
+		listArgs:     []string{"dpkg-query", "--show", "--showformat=${db:Status-Abbrev} ${Package}\n"},
+		installArgs:  []string{"sudo", "apt-get", "install", "--yes"},
+		parseListCmd: parseDpkgQueryOutput,
+	},
+	"brew": {
+		Name:         "brew",
+		listArgs:     []string{"brew", "list", "-1"},
+		installArgs:  []string{"brew", "install"},
+		parseListCmd: parseFirstFields,
+	},
+	"cargo": {
+		Name:         "cargo",
+		listArgs:     []string{"cargo", "install", "--list"},
+		installArgs:  []string{"cargo", "install"},
+		parseListCmd: parseCargoInstallListOutput,
+	},
+	"dnf": {
+		Name:         "dnf",
+		listArgs:     []string{"rpm", "--query", "--all", "--queryformat", "%{NAME}\n"},
+		installArgs:  []string{"sudo", "dnf", "install", "--assumeyes"},
+		parseListCmd: parseFirstFields,
+	},
+	"npm": {
+		Name:         "npm",
+		listArgs:     []string{"npm", "ls", "--global", "--depth=0", "--json"},
+		installArgs:  []string{"npm", "install", "--global"},
+		parseListCmd: parseNPMLSOutput,
+	},
+	"pacman": {
+		Name:         "pacman",
+		listArgs:     []string{"pacman", "--query", "--quiet"},
+		installArgs:  []string{"sudo", "pacman", "--sync", "--needed", "--noconfirm"},
+		parseListCmd: parseFirstFields,
+	},
+	"pipx": {
+		Name:         "pipx",
+		listArgs:     []string{"pipx", "list", "--short"},
+		installArgs:  []string{"pipx", "install"},
+		parseListCmd: parseFirstFields,
+	},
+}
+
+// PackageManagerByName returns the package manager with the given name, or nil
+// if there is no such package manager.
+func PackageManagerByName(name string) *PackageManager {
+	return packageManagers[name]
+}
+
+// WithListCmd returns a copy of m that lists installed packages by running
+// command with args. The command's output must be in the same format as the
+// output of m's default list command.
+func (m *PackageManager) WithListCmd(command string, args []string) *PackageManager {
+	packageManager := *m
+	packageManager.listArgs = append([]string{command}, args...)
+	return &packageManager
+}
+
+// WithInstallCmd returns a copy of m that installs packages by running command
+// with args followed by the packages.
+func (m *PackageManager) WithInstallCmd(command string, args []string) *PackageManager {
+	packageManager := *m
+	packageManager.installArgs = append([]string{command}, args...)
+	return &packageManager
+}
+
+// ListCmd returns the command that lists m's installed packages.
+func (m *PackageManager) ListCmd() *exec.Cmd {
+	return exec.Command(m.listArgs[0], m.listArgs[1:]...) //nolint:gosec
+}
+
+// ParseListCmdOutput returns the set of installed packages in output, the
+// output of the command returned by m.ListCmd.
+func (m *PackageManager) ParseListCmdOutput(output []byte) (chezmoiset.Set[string], error) {
+	packages, err := m.parseListCmd(output)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Name, err)
+	}
+	return chezmoiset.New(packages...), nil
+}
+
+// InstallCmd returns the command that installs packages with m.
+func (m *PackageManager) InstallCmd(packages []string) *exec.Cmd {
+	args := append(slices.Clone(m.installArgs[1:]), packages...)
+	return exec.Command(m.installArgs[0], args...) //nolint:gosec
+}
+
+// Packages returns the packages in s for the current operating system, sorted
+// and indexed by package manager name.
+func (s *SourceState) Packages() map[string][]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	packages := make(map[string][]string, len(s.packages))
+	for name, packageSet := range s.packages {
+		packages[name] = slices.Sorted(maps.Keys(packageSet))
+	}
+	return packages
+}
+
+// addPackages adds the packages defined in the file at sourceAbsPath for the
+// current operating system to s.
+func (s *SourceState) addPackages(sourceAbsPath AbsPath) error {
+	format, err := FormatFromAbsPath(sourceAbsPath.TrimSuffix(TemplateSuffix))
+	if err != nil {
+		return err
+	}
+	data, err := s.executeTemplate(sourceAbsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	packagesByOS := make(map[string]map[string][]string)
+	if err := format.Unmarshal(data, &packagesByOS); err != nil {
+		return fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, goos := range slices.Sorted(maps.Keys(packagesByOS)) {
+		for _, name := range slices.Sorted(maps.Keys(packagesByOS[goos])) {
+			if _, ok := packageManagers[name]; !ok {
+				return fmt.Errorf("%s: %s: %s: unknown package manager", sourceAbsPath, goos, name)
+			}
+			if goos != packagesAllOS && goos != runtime.GOOS {
+				continue
+			}
+			packageSet, ok := s.packages[name]
+			if !ok {
+				packageSet = chezmoiset.New[string]()
+				s.packages[name] = packageSet
+			}
+			for _, pkg := range packagesByOS[goos][name] {
+				if pkg == "" {
+					return fmt.Errorf("%s: %s: %s: empty package name", sourceAbsPath, goos, name)
+				}
+				packageSet.Add(pkg)
+			}
+		}
+	}
+	return nil
+}
+
+// parseCargoInstallListOutput parses the output of cargo install --list, in
+// which each package is listed on an unindented line followed by indented lines
+// listing its binaries.
+func parseCargoInstallListOutput(output []byte) ([]string, error) {
+	var packages []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		packages = append(packages, strings.Fields(line)[0])
+	}
+	return packages, scanner.Err()
+}
+
+// parseDpkgQueryOutput parses the output of dpkg-query with a format of
+// ${db:Status-Abbrev} ${Package}, returning only installed packages.
+func parseDpkgQueryOutput(output []byte) ([]string, error) {
+	var packages []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "ii" {
+			continue
+		}
+		packages = append(packages, fields[len(fields)-1])
+	}
+	return packages, scanner.Err()
+}
+
+// parseFirstFields parses output that lists one package per line, optionally
+// followed by other fields such as its version.
+func parseFirstFields(output []byte) ([]string, error) {
+	var packages []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			packages = append(packages, fields[0])
+		}
+	}
+	return packages, scanner.Err()
+}
+
+// parseNPMLSOutput parses the output of npm ls --json.
+func parseNPMLSOutput(output []byte) ([]string, error) {
+	var npmLSOutput struct {
+		Dependencies map[string]any `json:"dependencies"`
+	}
+	if err := json.Unmarshal(output, &npmLSOutput); err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(npmLSOutput.Dependencies)), nil
+}
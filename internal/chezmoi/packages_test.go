@@ -0,0 +1,135 @@
+package chezmoi
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestPackageManagerParseListCmdOutput(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		output   string
+		expected chezmoiset.Set[string]
+	}{
+		{
+			name: "apt",
+			output: chezmoitest.JoinLines(
+				"ii  git",
+				"rc  vim",
+				"ii  zsh",
+			),
+			expected: chezmoiset.New("git", "zsh"),
+		},
+		{
+			name: "cargo",
+			output: chezmoitest.JoinLines(
+				"bat v0.24.0:",
+				"    bat",
+				"ripgrep v14.1.0:",
+				"    rg",
+			),
+			expected: chezmoiset.New("bat", "ripgrep"),
+		},
+		{
+			name:     "npm",
+			output:   `{"dependencies":{"npm":{"version":"10.0.0"},"typescript":{"version":"5.0.0"}}}`,
+			expected: chezmoiset.New("npm", "typescript"),
+		},
+		{
+			name: "pipx",
+			output: chezmoitest.JoinLines(
+				"black 24.1.0",
+				"ruff 0.1.0",
+			),
+			expected: chezmoiset.New("black", "ruff"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := PackageManagerByName(tc.name).ParseListCmdOutput([]byte(tc.output))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestSourceStatePackages(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		root        any
+		expected    map[string][]string
+		expectedErr string
+	}{
+		{
+			name: "merge",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoipackages.toml.tmpl": chezmoitest.JoinLines(
+						`[all]`,
+						`    pipx = ["ruff"]`,
+						`[{{ .chezmoi.os }}]`,
+						`    apt = ["ripgrep", "git"]`,
+						`[other]`,
+						`    brew = ["git"]`,
+					),
+					"dot_dir": map[string]any{
+						".chezmoipackages.yaml": chezmoitest.JoinLines(
+							`all:`,
+							`  apt: [git, zsh]`,
+						),
+					},
+				},
+			},
+			expected: map[string][]string{
+				"apt":  {"git", "ripgrep", "zsh"},
+				"pipx": {"ruff"},
+			},
+		},
+		{
+			name: "unknown_package_manager",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoipackages.json": `{"other":{"snap":["code"]}}`,
+				},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoipackages.json: other: snap: unknown package manager",
+		},
+		{
+			name: "empty_package_name",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoipackages.json": `{"all":{"apt":[""]}}`,
+				},
+			},
+			expectedErr: "/home/user/.local/share/chezmoi/.chezmoipackages.json: all: apt: empty package name",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				system := NewRealSystem(fileSystem)
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithPriorityTemplateData(map[string]any{
+						"chezmoi": map[string]any{
+							"os": runtime.GOOS,
+						},
+					}),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+				)
+				err := s.Read(t.Context(), nil)
+				if tc.expectedErr != "" {
+					assert.EqualError(t, err, tc.expectedErr)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, s.Packages())
+			})
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package chezmoi
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoilog"
+)
+
+// A ParallelScriptSystem is a System that allows scripts to run in parallel.
+// Callers must hold s's lock while using s. The lock is only released while a
+// script's process is running, so all other operations are serialized. Each
+// script's output is buffered and written, with each line prefixed by the
+// script's name, when the script finishes.
+type ParallelScriptSystem struct {
+	mutex     sync.Mutex
+	semaphore chan struct{}
+	stdout    io.Writer
+	stderr    io.Writer
+	system    System
+}
+
+// NewParallelScriptSystem returns a new ParallelScriptSystem that runs at most
+// workers scripts at once on system and writes their output to stdout and
+// stderr.
+func NewParallelScriptSystem(system System, workers int, stdout, stderr io.Writer) *ParallelScriptSystem {
+	return &ParallelScriptSystem{
+		semaphore: make(chan struct{}, workers),
+		stdout:    stdout,
+		stderr:    stderr,
+		system:    system,
+	}
+}
+
+// Lock locks s.
+func (s *ParallelScriptSystem) Lock() {
+	s.mutex.Lock()
+}
+
+// Unlock unlocks s.
+func (s *ParallelScriptSystem) Unlock() {
+	s.mutex.Unlock()
+}
+
+// Chmod implements System.Chmod.
+func (s *ParallelScriptSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	return s.system.Chmod(name, mode)
+}
+
+// Chtimes implements System.Chtimes.
+func (s *ParallelScriptSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *ParallelScriptSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *ParallelScriptSystem) Link(oldName, newName AbsPath) error {
+	return s.system.Link(oldName, newName)
+}
+
+// Lstat implements System.Lstat.
+func (s *ParallelScriptSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *ParallelScriptSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	return s.system.Mkdir(name, perm)
+}
+
+// RawPath implements System.RawPath.
+func (s *ParallelScriptSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *ParallelScriptSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *ParallelScriptSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *ParallelScriptSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *ParallelScriptSystem) Remove(name AbsPath) error {
+	return s.system.Remove(name)
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *ParallelScriptSystem) RemoveAll(name AbsPath) error {
+	return s.system.RemoveAll(name)
+}
+
+// Rename implements System.Rename.
+func (s *ParallelScriptSystem) Rename(oldPath, newPath AbsPath) error {
+	return s.system.Rename(oldPath, newPath)
+}
+
+// RunCmd implements System.RunCmd.
+func (s *ParallelScriptSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *ParallelScriptSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	var stdout, stderr bytes.Buffer
+	options.Stdout = &stdout
+	options.Stderr = &stderr
+	options.RunCmdFunc = func(cmd *exec.Cmd) error {
+		s.mutex.Unlock()
+		s.semaphore <- struct{}{}
+		err := chezmoilog.LogCmdRun(slog.Default(), cmd)
+		<-s.semaphore
+		s.mutex.Lock()
+
+		prefix := []byte("[" + scriptName.String() + "] ")
+		if _, err := s.stdout.Write(prefixLines(prefix, stdout.Bytes())); err != nil {
+			return err
+		}
+		if _, err := s.stderr.Write(prefixLines(prefix, stderr.Bytes())); err != nil {
+			return err
+		}
+		stdout.Reset()
+		stderr.Reset()
+		return err
+	}
+	return s.system.RunScript(scriptName, dir, data, options)
+}
+
+// Stat implements System.Stat.
+func (s *ParallelScriptSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *ParallelScriptSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *ParallelScriptSystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	return s.system.WriteFile(name, data, perm)
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *ParallelScriptSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	return s.system.WriteSymlink(oldName, newName)
+}
+
+// prefixLines returns data with prefix added to the start of every line. A
+// final newline is added if data does not end with one.
+func prefixLines(prefix, data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	var result []byte
+	for line := range bytes.Lines(data) {
+		result = append(result, prefix...)
+		result = append(result, line...)
+	}
+	if !bytes.HasSuffix(result, []byte{'\n'}) {
+		result = append(result, '\n')
+	}
+	return result
+}
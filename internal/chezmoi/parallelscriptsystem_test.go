@@ -0,0 +1,3 @@
+package chezmoi
+
+var _ System = &ParallelScriptSystem{}
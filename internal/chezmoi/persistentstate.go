@@ -1,16 +1,33 @@
 package chezmoi
 
 var (
+	// BackupStateBucket is the bucket for recording backups.
+	BackupStateBucket = []byte("backupState")
+
 	// ConfigStateBucket is the bucket for recording the config state.
 	ConfigStateBucket = []byte("configState")
 
 	// EntryStateBucket is the bucket for recording the entry states.
 	EntryStateBucket = []byte("entryState")
 
+	// FailedTargetStateBucket is the bucket for recording the targets that
+	// failed to apply.
+	FailedTargetStateBucket = []byte("failedTargetState")
+
+	// GenerationStateBucket is the bucket for recording generations.
+	GenerationStateBucket = []byte("generationState")
+
 	// GitRepoExternalStateBucket is the bucket for recording the state of commands
 	// that modify directories.
 	GitRepoExternalStateBucket = []byte("gitRepoExternalState")
 
+	// MergeBaseStateBucket is the bucket for recording the contents of files
+	// last written, which are the base for three-way merges.
+	MergeBaseStateBucket = []byte("mergeBaseState")
+
+	// ScriptRunStateBucket is the bucket for recording script runs.
+	ScriptRunStateBucket = []byte("scriptRunState")
+
 	// ScriptStateBucket is the bucket for recording the state of run once
 	// scripts.
 	ScriptStateBucket = []byte("scriptState")
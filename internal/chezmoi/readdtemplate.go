@@ -0,0 +1,206 @@
+package chezmoi
+
+import (
+	"bytes"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// templateLiteralMarkerRx matches the markers inserted around literal text
+// when rendering a template to find where the literal text ends up in the
+// output.
+var templateLiteralMarkerRx = regexp.MustCompile("\x00chezmoi:literal:([0-9]+):(start|end)\x00")
+
+// A ReAddTemplateResult is the result of mapping changes to the output of a
+// template back onto the template.
+type ReAddTemplateResult struct {
+	Data       []byte // The template with changes to literal text applied.
+	Rendered   []byte // The output of the original template.
+	Unresolved []Hunk // Changes to Rendered that touch template actions.
+}
+
+// A templateLiteral is a piece of literal text in a template that appears
+// exactly once in the template's output.
+type templateLiteral struct {
+	dataOffset  int
+	outputStart int
+	outputEnd   int
+}
+
+// A templateReplacement replaces the bytes [start, end) of a template with
+// text.
+type templateReplacement struct {
+	start int
+	end   int
+	text  string
+}
+
+// ReAddTemplateData maps the changes that transform the output of the template
+// in options into actualContents back onto the template. Changes that fall
+// entirely within the template's literal text are applied to the template. All
+// other changes are returned as unresolved.
+func (s *SourceState) ReAddTemplateData(options ExecuteTemplateDataOptions, actualContents []byte) (*ReAddTemplateResult, error) {
+	rendered, literals, err := s.renderTemplateLiterals(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the byte offset of the start of each line in the rendered output.
+	renderedLines := SplitLines(string(rendered))
+	lineOffsets := make([]int, 0, len(renderedLines)+1)
+	offset := 0
+	for _, line := range renderedLines {
+		lineOffsets = append(lineOffsets, offset)
+		offset += len(line)
+	}
+	lineOffsets = append(lineOffsets, offset)
+
+	result := &ReAddTemplateResult{
+		Rendered: rendered,
+	}
+	var replacements []templateReplacement
+HUNK:
+	for _, hunk := range DiffHunks(rendered, actualContents) {
+		start, end := lineOffsets[hunk.Start], lineOffsets[hunk.End]
+		text := strings.Join(hunk.Lines, "")
+		// Changes that would add template actions are never applied
+		// automatically.
+		if !strings.Contains(text, "{{") {
+			for _, literal := range literals {
+				if literal.outputStart <= start && end <= literal.outputEnd {
+					replacements = append(replacements, templateReplacement{
+						start: literal.dataOffset + start - literal.outputStart,
+						end:   literal.dataOffset + end - literal.outputStart,
+						text:  text,
+					})
+					continue HUNK
+				}
+			}
+		}
+		result.Unresolved = append(result.Unresolved, hunk)
+	}
+
+	var builder bytes.Buffer
+	pos := 0
+	for _, replacement := range replacements {
+		builder.Write(options.Data[pos:replacement.start])
+		builder.WriteString(replacement.text)
+		pos = replacement.end
+	}
+	builder.Write(options.Data[pos:])
+	result.Data = builder.Bytes()
+
+	return result, nil
+}
+
+// renderTemplateLiterals executes the template in options and returns its
+// output and the locations of the template's literal text in the output.
+// Literal text that is output more than once, for example in the body of a
+// range action, cannot be changed independently so it is not located.
+// Templates containing directives are rendered without locating any literal
+// text, as removing the directives changes the template's offsets.
+func (s *SourceState) renderTemplateLiterals(options ExecuteTemplateDataOptions) ([]byte, []templateLiteral, error) {
+	if templateDirectiveRx.Match(options.Data) {
+		rendered, err := s.ExecuteTemplateData(options)
+		return rendered, nil, err
+	}
+
+	tmpl, templateData, err := s.parseTemplateData(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Surround each text node with markers. Only text nodes whose text appears
+	// verbatim in the template can be mapped back onto it.
+	dataOffsets := make(map[int]int)
+	for i, textNode := range templateTextNodes(tmpl.template.Lookup(tmpl.name).Tree.Root) {
+		dataOffset := int(textNode.Pos)
+		if dataOffset+len(textNode.Text) > len(options.Data) ||
+			!bytes.Equal(options.Data[dataOffset:dataOffset+len(textNode.Text)], textNode.Text) {
+			continue
+		}
+		dataOffsets[i] = dataOffset
+		index := strconv.Itoa(i)
+		text := make([]byte, 0, len(textNode.Text)+64)
+		text = append(text, "\x00chezmoi:literal:"+index+":start\x00"...)
+		text = append(text, textNode.Text...)
+		text = append(text, "\x00chezmoi:literal:"+index+":end\x00"...)
+		textNode.Text = text
+	}
+
+	output, err := tmpl.Execute(templateData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Remove the markers, recording where each literal ends up. If the
+	// markers are not well-formed, for example if the template's data contains
+	// something that looks like a marker, then do not locate any literal text.
+	var literals []templateLiteral
+	var builder bytes.Buffer
+	pos := 0
+	wellFormed := true
+	var current *templateLiteral
+	outputCounts := make(map[int]int)
+	for _, match := range templateLiteralMarkerRx.FindAllSubmatchIndex(output, -1) {
+		builder.Write(output[pos:match[0]])
+		pos = match[1]
+		index, _ := strconv.Atoi(string(output[match[2]:match[3]]))
+		dataOffset, ok := dataOffsets[index]
+		switch {
+		case !ok:
+			wellFormed = false
+		case string(output[match[4]:match[5]]) == "start" && current == nil:
+			outputCounts[dataOffset]++
+			current = &templateLiteral{
+				dataOffset:  dataOffset,
+				outputStart: builder.Len(),
+			}
+		case string(output[match[4]:match[5]]) == "end" && current != nil && current.dataOffset == dataOffset:
+			current.outputEnd = builder.Len()
+			literals = append(literals, *current)
+			current = nil
+		default:
+			wellFormed = false
+		}
+	}
+	builder.Write(output[pos:])
+	if !wellFormed || current != nil {
+		literals = nil
+	}
+	literals = slices.DeleteFunc(literals, func(literal templateLiteral) bool {
+		return outputCounts[literal.dataOffset] > 1
+	})
+
+	return builder.Bytes(), literals, nil
+}
+
+// templateTextNodes returns the text nodes in node, including those in the
+// bodies of if, range, and with actions and their else branches, in the order
+// in which they appear in the template.
+func templateTextNodes(node parse.Node) []*parse.TextNode {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		var textNodes []*parse.TextNode
+		for _, node := range node.Nodes {
+			textNodes = append(textNodes, templateTextNodes(node)...)
+		}
+		return textNodes
+	case *parse.TextNode:
+		return []*parse.TextNode{node}
+	case *parse.IfNode:
+		return append(templateTextNodes(node.List), templateTextNodes(node.ElseList)...)
+	case *parse.RangeNode:
+		return append(templateTextNodes(node.List), templateTextNodes(node.ElseList)...)
+	case *parse.WithNode:
+		return append(templateTextNodes(node.List), templateTextNodes(node.ElseList)...)
+	default:
+		return nil
+	}
+}
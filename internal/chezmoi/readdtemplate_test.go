@@ -0,0 +1,227 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestSourceStateReAddTemplateData(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		dataStr            string
+		actualStr          string
+		expectedDataStr    string
+		expectedUnresolved []Hunk
+	}{
+		{
+			name: "unchanged",
+			dataStr: chezmoitest.JoinLines(
+				"# literal",
+				`email = {{ "user@example.com" }}`,
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# literal",
+				"email = user@example.com",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"# literal",
+				`email = {{ "user@example.com" }}`,
+			),
+		},
+		{
+			name: "literal",
+			dataStr: chezmoitest.JoinLines(
+				"# literal",
+				`email = {{ "user@example.com" }}`,
+				"# literal",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# changed",
+				"email = user@example.com",
+				"# literal",
+				"# added",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"# changed",
+				`email = {{ "user@example.com" }}`,
+				"# literal",
+				"# added",
+			),
+		},
+		{
+			name: "action",
+			dataStr: chezmoitest.JoinLines(
+				"# literal",
+				"",
+				`email = {{ "user@example.com" }}`,
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# changed",
+				"",
+				"email = other@example.com",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"# changed",
+				"",
+				`email = {{ "user@example.com" }}`,
+			),
+			expectedUnresolved: []Hunk{
+				{Start: 2, End: 3, Lines: []string{"email = other@example.com\n"}},
+			},
+		},
+		{
+			name: "trim",
+			dataStr: chezmoitest.JoinLines(
+				"# literal",
+				`{{- if true }}`,
+				"# conditional",
+				"{{- end }}",
+				"# literal",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# literal",
+				"# conditional",
+				"# changed",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"# literal",
+				`{{- if true }}`,
+				"# conditional",
+				"{{- end }}",
+				"# changed",
+			),
+		},
+		{
+			name: "conditional",
+			dataStr: chezmoitest.JoinLines(
+				"{{ if true -}}",
+				"# conditional",
+				"{{ end -}}",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# changed",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"{{ if true -}}",
+				"# changed",
+				"{{ end -}}",
+			),
+		},
+		{
+			name: "else",
+			dataStr: chezmoitest.JoinLines(
+				"{{ if false -}}",
+				"# true",
+				"{{ else if false -}}",
+				"# false",
+				"{{ else -}}",
+				"# else",
+				"{{ end -}}",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# changed",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"{{ if false -}}",
+				"# true",
+				"{{ else if false -}}",
+				"# false",
+				"{{ else -}}",
+				"# changed",
+				"{{ end -}}",
+			),
+		},
+		{
+			name: "with",
+			dataStr: chezmoitest.JoinLines(
+				`{{ with "value" -}}`,
+				"# literal",
+				"{{ . }}",
+				"{{ end -}}",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# changed",
+				"value",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				`{{ with "value" -}}`,
+				"# changed",
+				"{{ . }}",
+				"{{ end -}}",
+			),
+		},
+		{
+			name: "range",
+			dataStr: chezmoitest.JoinLines(
+				"{{ range 2 -}}",
+				"# item",
+				"{{ end -}}",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# item",
+				"# changed",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"{{ range 2 -}}",
+				"# item",
+				"{{ end -}}",
+			),
+			expectedUnresolved: []Hunk{
+				{Start: 1, End: 2, Lines: []string{"# changed\n"}},
+			},
+		},
+		{
+			name: "add_action",
+			dataStr: chezmoitest.JoinLines(
+				"# literal",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"{{ .action }}",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"# literal",
+			),
+			expectedUnresolved: []Hunk{
+				{Start: 0, End: 1, Lines: []string{"{{ .action }}\n"}},
+			},
+		},
+		{
+			name: "directive",
+			dataStr: chezmoitest.JoinLines(
+				"# chezmoi:template:left-delimiter=[[ right-delimiter=]]",
+				"# literal",
+			),
+			actualStr: chezmoitest.JoinLines(
+				"# changed",
+			),
+			expectedDataStr: chezmoitest.JoinLines(
+				"# chezmoi:template:left-delimiter=[[ right-delimiter=]]",
+				"# literal",
+			),
+			expectedUnresolved: []Hunk{
+				{Start: 0, End: 1, Lines: []string{"# changed\n"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewSourceState()
+			result, err := s.ReAddTemplateData(ExecuteTemplateDataOptions{
+				Name: tc.name,
+				Data: []byte(tc.dataStr),
+			}, []byte(tc.actualStr))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDataStr, string(result.Data))
+			assert.Equal(t, tc.expectedUnresolved, result.Unresolved)
+			assert.NotContains(t, string(result.Rendered), "\x00")
+			renderedData, err := s.ExecuteTemplateData(ExecuteTemplateDataOptions{
+				Name: tc.name,
+				Data: result.Data,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.actualStr, string(ApplyHunks(renderedData, result.Unresolved)))
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package chezmoi
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
 	"os"
@@ -119,19 +122,13 @@ func (s *RealSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, opt
 		return err
 	}
 
-	cmd := options.Interpreter.ExecCommand(f.Name())
-	cmd.Dir, err = s.getScriptWorkingDir(dir)
-	if err != nil {
-		return err
+	// Run the script, retrying it if it fails.
+	for attempt := 0; ; attempt++ {
+		err = s.runScriptCmd(f.Name(), dir, options)
+		if err == nil || attempt >= options.Retries {
+			return err
+		}
 	}
-	cmd.Env = append(os.Environ(),
-		"CHEZMOI_SOURCE_FILE="+options.SourceRelPath.String(),
-	)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return s.RunCmd(cmd)
 }
 
 // Stat implements System.Stat.
@@ -144,6 +141,52 @@ func (s *RealSystem) UnderlyingFS() vfs.FS {
 	return s.fileSystem
 }
 
+// runScriptCmd runs the script at name once.
+func (s *RealSystem) runScriptCmd(name string, dir AbsPath, options RunScriptOptions) error {
+	ctx := context.Background()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	cmd := options.Interpreter.ExecCommandContext(ctx, name)
+	var err error
+	cmd.Dir, err = s.getScriptWorkingDir(dir)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(),
+		"CHEZMOI_SOURCE_FILE="+options.SourceRelPath.String(),
+	)
+	cmd.Env = append(cmd.Env, options.Env...)
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if options.Stdout != nil {
+		stdout, stderr = options.Stdout, options.Stderr
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	if options.Output != nil {
+		stdout = io.MultiWriter(stdout, options.Output)
+		stderr = io.MultiWriter(stderr, options.Output)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Do not wait indefinitely for any child processes that the script
+	// started to close their output after the script is killed.
+	cmd.WaitDelay = time.Second
+
+	if options.RunCmdFunc != nil {
+		err = options.RunCmdFunc(cmd)
+	} else {
+		err = s.RunCmd(cmd)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", options.Timeout, err)
+	}
+	return err
+}
+
 // getScriptWorkingDir returns the script's working directory.
 //
 // If this is a before_ script then the requested working directory may not
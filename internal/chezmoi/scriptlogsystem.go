@@ -0,0 +1,295 @@
+package chezmoi
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoierrors"
+)
+
+// A ScriptRun is a record of a single run of a script.
+type ScriptRun struct {
+	Name            string    `json:"name"                      yaml:"name"`
+	SourcePath      string    `json:"sourcePath"                yaml:"sourcePath"`
+	Time            time.Time `json:"time"                      yaml:"time"`
+	Duration        float64   `json:"duration"                  yaml:"duration"`
+	ExitCode        int       `json:"exitCode"                  yaml:"exitCode"`
+	Error           string    `json:"error,omitempty"           yaml:"error,omitempty"`
+	Output          string    `json:"output,omitempty"          yaml:"output,omitempty"`
+	OutputTruncated bool      `json:"outputTruncated,omitempty" yaml:"outputTruncated,omitempty"`
+}
+
+// ScriptLogSystemOptions are options to NewScriptLogSystem.
+type ScriptLogSystemOptions struct {
+	// MaxOutputSize is the maximum number of bytes of each script's output
+	// that is recorded. Only the end of longer output is recorded. If
+	// MaxOutputSize is zero then output is not recorded.
+	MaxOutputSize int
+
+	// MaxRuns is the maximum number of runs of each script that are kept. If
+	// MaxRuns is zero then all runs are kept.
+	MaxRuns int
+
+	// RedactFunc, if set, is called to remove secrets from recorded output.
+	RedactFunc func([]byte) ([]byte, error)
+}
+
+// A ScriptLogSystem is a System that records every script run in a persistent
+// state.
+type ScriptLogSystem struct {
+	system          System
+	persistentState PersistentState
+	options         ScriptLogSystemOptions
+}
+
+// NewScriptLogSystem returns a new ScriptLogSystem that records the runs of
+// scripts on system in persistentState.
+func NewScriptLogSystem(system System, persistentState PersistentState, options ScriptLogSystemOptions) *ScriptLogSystem {
+	return &ScriptLogSystem{
+		system:          system,
+		persistentState: persistentState,
+		options:         options,
+	}
+}
+
+// ScriptLastRunTimes returns the time that each script was last recorded as
+// run in persistentState, with any contents.
+func ScriptLastRunTimes(persistentState PersistentState) (map[RelPath]time.Time, error) {
+	lastRunTimes := make(map[RelPath]time.Time)
+	if err := persistentState.ForEach(ScriptStateBucket, func(k, v []byte) error {
+		// RelPath does not implement encoding.TextUnmarshaler, so decode the
+		// name as a string.
+		var scriptState struct {
+			Name  string    `json:"name"`
+			RunAt time.Time `json:"runAt"`
+		}
+		if err := stateFormat.Unmarshal(v, &scriptState); err != nil {
+			return err
+		}
+		name := NewRelPath(scriptState.Name)
+		if scriptState.RunAt.After(lastRunTimes[name]) {
+			lastRunTimes[name] = scriptState.RunAt
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return lastRunTimes, nil
+}
+
+// ScriptRuns returns all script runs recorded in persistentState, oldest
+// first.
+func ScriptRuns(persistentState PersistentState) ([]*ScriptRun, error) {
+	var scriptRuns []*ScriptRun
+	if err := persistentState.ForEach(ScriptRunStateBucket, func(k, v []byte) error {
+		var scriptRun ScriptRun
+		if err := stateFormat.Unmarshal(v, &scriptRun); err != nil {
+			return err
+		}
+		scriptRuns = append(scriptRuns, &scriptRun)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(scriptRuns, compareScriptRuns)
+	return scriptRuns, nil
+}
+
+// Chmod implements System.Chmod.
+func (s *ScriptLogSystem) Chmod(name AbsPath, mode fs.FileMode) error {
+	return s.system.Chmod(name, mode)
+}
+
+// Chtimes implements System.Chtimes.
+func (s *ScriptLogSystem) Chtimes(name AbsPath, atime, mtime time.Time) error {
+	return s.system.Chtimes(name, atime, mtime)
+}
+
+// Glob implements System.Glob.
+func (s *ScriptLogSystem) Glob(pattern string) ([]string, error) {
+	return s.system.Glob(pattern)
+}
+
+// Link implements System.Link.
+func (s *ScriptLogSystem) Link(oldName, newName AbsPath) error {
+	return s.system.Link(oldName, newName)
+}
+
+// Lstat implements System.Lstat.
+func (s *ScriptLogSystem) Lstat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Lstat(name)
+}
+
+// Mkdir implements System.Mkdir.
+func (s *ScriptLogSystem) Mkdir(name AbsPath, perm fs.FileMode) error {
+	return s.system.Mkdir(name, perm)
+}
+
+// RawPath implements System.RawPath.
+func (s *ScriptLogSystem) RawPath(path AbsPath) (AbsPath, error) {
+	return s.system.RawPath(path)
+}
+
+// ReadDir implements System.ReadDir.
+func (s *ScriptLogSystem) ReadDir(name AbsPath) ([]fs.DirEntry, error) {
+	return s.system.ReadDir(name)
+}
+
+// ReadFile implements System.ReadFile.
+func (s *ScriptLogSystem) ReadFile(name AbsPath) ([]byte, error) {
+	return s.system.ReadFile(name)
+}
+
+// Readlink implements System.Readlink.
+func (s *ScriptLogSystem) Readlink(name AbsPath) (string, error) {
+	return s.system.Readlink(name)
+}
+
+// Remove implements System.Remove.
+func (s *ScriptLogSystem) Remove(name AbsPath) error {
+	return s.system.Remove(name)
+}
+
+// RemoveAll implements System.RemoveAll.
+func (s *ScriptLogSystem) RemoveAll(name AbsPath) error {
+	return s.system.RemoveAll(name)
+}
+
+// Rename implements System.Rename.
+func (s *ScriptLogSystem) Rename(oldPath, newPath AbsPath) error {
+	return s.system.Rename(oldPath, newPath)
+}
+
+// RunCmd implements System.RunCmd.
+func (s *ScriptLogSystem) RunCmd(cmd *exec.Cmd) error {
+	return s.system.RunCmd(cmd)
+}
+
+// RunScript implements System.RunScript.
+func (s *ScriptLogSystem) RunScript(scriptName RelPath, dir AbsPath, data []byte, options RunScriptOptions) error {
+	var output *tailBuffer
+	if s.options.MaxOutputSize > 0 {
+		output = &tailBuffer{
+			size: s.options.MaxOutputSize,
+		}
+		options.Output = output
+	}
+
+	start := time.Now()
+	err := s.system.RunScript(scriptName, dir, data, options)
+	scriptRun := &ScriptRun{
+		Name:       scriptName.String(),
+		SourcePath: options.SourceRelPath.String(),
+		Time:       start.UTC(),
+		Duration:   time.Since(start).Seconds(),
+	}
+	if err != nil {
+		scriptRun.ExitCode = -1
+		if exitError := (&exec.ExitError{}); errors.As(err, &exitError) {
+			scriptRun.ExitCode = exitError.ExitCode()
+		}
+		scriptRun.Error = err.Error()
+	}
+	if output != nil && len(output.data) > 0 {
+		outputData := output.data
+		if s.options.RedactFunc != nil {
+			var redactErr error
+			if outputData, redactErr = s.options.RedactFunc(outputData); redactErr != nil {
+				return chezmoierrors.Combine(err, redactErr)
+			}
+		}
+		scriptRun.Output = string(outputData)
+		scriptRun.OutputTruncated = output.truncated
+	}
+
+	return chezmoierrors.Combine(err, s.record(scriptRun))
+}
+
+// Stat implements System.Stat.
+func (s *ScriptLogSystem) Stat(name AbsPath) (fs.FileInfo, error) {
+	return s.system.Stat(name)
+}
+
+// UnderlyingFS implements System.UnderlyingFS.
+func (s *ScriptLogSystem) UnderlyingFS() vfs.FS {
+	return s.system.UnderlyingFS()
+}
+
+// WriteFile implements System.WriteFile.
+func (s *ScriptLogSystem) WriteFile(name AbsPath, data []byte, perm fs.FileMode) error {
+	return s.system.WriteFile(name, data, perm)
+}
+
+// WriteSymlink implements System.WriteSymlink.
+func (s *ScriptLogSystem) WriteSymlink(oldName string, newName AbsPath) error {
+	return s.system.WriteSymlink(oldName, newName)
+}
+
+// record records scriptRun and removes all but the most recent runs of the
+// same script.
+func (s *ScriptLogSystem) record(scriptRun *ScriptRun) error {
+	if err := PersistentStateSet(s.persistentState, ScriptRunStateBucket, []byte(scriptRun.key()), scriptRun); err != nil {
+		return err
+	}
+	if s.options.MaxRuns <= 0 {
+		return nil
+	}
+	scriptRuns, err := ScriptRuns(s.persistentState)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, run := range slices.Backward(scriptRuns) {
+		if run.Name != scriptRun.Name {
+			continue
+		}
+		if count++; count <= s.options.MaxRuns {
+			continue
+		}
+		if err := s.persistentState.Delete(ScriptRunStateBucket, []byte(run.key())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// key returns r's key in the persistent state.
+func (r *ScriptRun) key() string {
+	return r.Time.Format("2006-01-02T15:04:05.000000000Z") + " " + r.Name
+}
+
+// compareScriptRuns compares script runs by time and then by name.
+func compareScriptRuns(a, b *ScriptRun) int {
+	if c := a.Time.Compare(b.Time); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+// A tailBuffer is an io.Writer that keeps the last size bytes written to it. It
+// is safe for concurrent use.
+type tailBuffer struct {
+	mutex     sync.Mutex
+	size      int
+	data      []byte
+	truncated bool
+}
+
+// Write implements io.Writer.Write.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.data = append(b.data, p...)
+	if excess := len(b.data) - b.size; excess > 0 {
+		b.data = append(b.data[:0], b.data[excess:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
@@ -0,0 +1,26 @@
+package chezmoi
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+var _ System = &ScriptLogSystem{}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{
+		size: 4,
+	}
+	_, err := b.Write([]byte("ab"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ab", string(b.data))
+	assert.False(t, b.truncated)
+	_, err = b.Write([]byte("cdef"))
+	assert.NoError(t, err)
+	assert.Equal(t, "cdef", string(b.data))
+	assert.True(t, b.truncated)
+	_, err = b.Write([]byte("g"))
+	assert.NoError(t, err)
+	assert.Equal(t, "defg", string(b.data))
+}
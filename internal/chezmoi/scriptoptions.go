@@ -0,0 +1,316 @@
+package chezmoi
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+)
+
+var scriptDirectiveRx = regexp.MustCompile(`(?m)^.*?chezmoi:script:(.*)$`)
+
+// ScriptOptions are options parsed from script directives.
+type ScriptOptions struct {
+	DependsOn     []RelPath
+	DryRun        bool
+	OnChange      []string
+	ParallelGroup string
+	Retries       int
+	Timeout       time.Duration
+}
+
+// A scriptDependencyCycleError is returned when scripts' dependencies form a
+// cycle.
+type scriptDependencyCycleError struct {
+	targetRelPaths []RelPath
+}
+
+func (e *scriptDependencyCycleError) Error() string {
+	targetRelPathStrs := make([]string, 0, len(e.targetRelPaths))
+	for _, targetRelPath := range e.targetRelPaths {
+		targetRelPathStrs = append(targetRelPathStrs, targetRelPath.String())
+	}
+	return "script dependency cycle: " + strings.Join(targetRelPathStrs, " -> ")
+}
+
+// parseScriptOptions parses all script directives in data.
+func parseScriptOptions(data []byte) (*ScriptOptions, error) {
+	var options ScriptOptions
+	for _, directiveMatch := range scriptDirectiveRx.FindAllSubmatch(data, -1) {
+		for _, keyValuePairMatch := range templateDirectiveKeyValuePairRx.FindAllSubmatch(directiveMatch[1], -1) {
+			key := string(keyValuePairMatch[1])
+			value := maybeUnquote(string(keyValuePairMatch[2]))
+			switch key {
+			case "depends-on":
+				options.DependsOn = append(options.DependsOn, NewRelPath(value))
+			case "dry-run":
+				dryRun, err := ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid dry-run", value)
+				}
+				options.DryRun = dryRun
+			case "onchange":
+				if !doublestar.ValidatePattern(value) {
+					return nil, fmt.Errorf("%s: invalid onchange pattern", value)
+				}
+				options.OnChange = append(options.OnChange, value)
+			case "parallel-group":
+				options.ParallelGroup = value
+			case "retries":
+				retries, err := strconv.Atoi(value)
+				if err != nil || retries < 0 {
+					return nil, fmt.Errorf("%s: invalid retries", value)
+				}
+				options.Retries = retries
+			case "timeout":
+				timeout, err := time.ParseDuration(value)
+				if err != nil || timeout < 0 {
+					return nil, fmt.Errorf("%s: invalid timeout", value)
+				}
+				options.Timeout = timeout
+			}
+		}
+	}
+	return &options, nil
+}
+
+// ScriptOptions returns the options of the script at targetRelPath, or nil if
+// targetRelPath is not a script.
+func (s *SourceState) ScriptOptions(targetRelPath RelPath) (*ScriptOptions, error) {
+	sourceStateFile, ok := s.Get(targetRelPath).(*SourceStateFile)
+	if !ok || sourceStateFile.Attr.Type != SourceFileTypeScript {
+		return nil, nil
+	}
+	contents, err := sourceStateFile.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return parseScriptOptions(contents)
+}
+
+// onChangeDependencySHA256s returns the SHA256 sums of the target states of all
+// entries that match any of patterns, excluding scripts, indexed by their
+// target names. patterns match either target names or source paths, and a
+// pattern that matches a directory also matches everything in it. Files in the
+// source directory that match patterns but are not entries, for example
+// because they are ignored, are included with the SHA256 sums of their
+// contents, indexed by their source paths.
+func (s *SourceState) onChangeDependencySHA256s(destSystem System, patterns []string) (map[string]HexBytes, error) {
+	matches := func(path string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := doublestar.Match(pattern, path); ok {
+				return true
+			}
+			if ok, _ := doublestar.Match(pattern+"/**", path); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	dependencySHA256s := make(map[string]HexBytes)
+	sourceRelPaths := chezmoiset.New[string]()
+	if err := s.ForEach(func(targetRelPath RelPath, sourceStateEntry SourceStateEntry) error {
+		sourceRelPaths.Add(sourceStateEntry.SourceRelPath().String())
+		if sourceStateFile, ok := sourceStateEntry.(*SourceStateFile); ok && sourceStateFile.Attr.Type == SourceFileTypeScript {
+			return nil
+		}
+		if !matches(targetRelPath.String()) && !matches(sourceStateEntry.SourceRelPath().String()) {
+			return nil
+		}
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(destSystem, s.destDirAbsPath.Join(targetRelPath))
+		if err != nil {
+			return fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		entryState, err := targetStateEntry.EntryState(s.umask)
+		if err != nil {
+			return fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		dependencySHA256 := sha256.Sum256([]byte(string(entryState.Type) + "\x00" + entryState.ContentsSHA256.String()))
+		dependencySHA256s[targetRelPath.String()] = HexBytes(dependencySHA256[:])
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range patterns {
+		matches, err := s.system.Glob(s.sourceDirAbsPath.JoinString(pattern).String())
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if err := Walk(s.system, NewAbsPath(match), func(absPath AbsPath, fileInfo fs.FileInfo, err error) error {
+				switch {
+				case err != nil:
+					return err
+				case !fileInfo.Mode().IsRegular():
+					return nil
+				}
+				sourceRelPath, err := absPath.TrimDirPrefix(s.sourceDirAbsPath)
+				if err != nil {
+					return err
+				}
+				if sourceRelPaths.Contains(sourceRelPath.String()) {
+					return nil
+				}
+				contents, err := s.system.ReadFile(absPath)
+				if err != nil {
+					return err
+				}
+				contentsSHA256 := sha256.Sum256(contents)
+				dependencySHA256s[sourceRelPath.String()] = HexBytes(contentsSHA256[:])
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return dependencySHA256s, nil
+}
+
+// SortTargetRelPaths returns targetRelPaths sorted so that every script comes
+// after the targets that it depends on and scripts in the same parallel group
+// are adjacent. Otherwise, the order of targetRelPaths is preserved.
+// Dependencies on targets that are not in targetRelPaths are ignored.
+func (s *SourceState) SortTargetRelPaths(targetRelPaths []RelPath) ([]RelPath, error) {
+	// Build the graph of dependencies. dependents[j] contains the indexes of
+	// all scripts that must run after targetRelPaths[j].
+	dependencies := make([][]int, len(targetRelPaths))
+	dependents := make([][]int, len(targetRelPaths))
+	inDegrees := make([]int, len(targetRelPaths))
+	groups := make([]string, len(targetRelPaths))
+	groupMembers := make(map[string][]int)
+	for i, targetRelPath := range targetRelPaths {
+		scriptOptions, err := s.ScriptOptions(targetRelPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		if scriptOptions == nil {
+			continue
+		}
+		if group := scriptOptions.ParallelGroup; group != "" {
+			groups[i] = group
+			groupMembers[group] = append(groupMembers[group], i)
+		}
+		for _, dependency := range scriptOptions.DependsOn {
+			if s.Get(dependency) == nil {
+				if s.Ignore(dependency) {
+					continue
+				}
+				return nil, fmt.Errorf("%s: %s: dependency not in source state", targetRelPath, dependency)
+			}
+			for j, dependencyRelPath := range targetRelPaths {
+				if j == i || dependencyRelPath != dependency && !dependencyRelPath.HasDirPrefix(dependency) {
+					continue
+				}
+				if slices.Contains(dependencies[i], j) {
+					continue
+				}
+				dependencies[i] = append(dependencies[i], j)
+				dependents[j] = append(dependents[j], i)
+				inDegrees[i]++
+			}
+		}
+	}
+
+	// Sort topologically, always choosing the earliest ready target so that
+	// the existing order is preserved where possible. A parallel group is
+	// ready when all of its members are ready, and is represented in ready by
+	// its first member.
+	ready := &intHeap{}
+	readyGroupMembers := make(map[string]int)
+	markReady := func(i int) {
+		group := groups[i]
+		if group == "" {
+			heap.Push(ready, i)
+			return
+		}
+		readyGroupMembers[group]++
+		if members := groupMembers[group]; readyGroupMembers[group] == len(members) {
+			heap.Push(ready, members[0])
+		}
+	}
+	for i, inDegree := range inDegrees {
+		if inDegree == 0 {
+			markReady(i)
+		}
+	}
+	sorted := make([]bool, len(targetRelPaths))
+	sortedTargetRelPaths := make([]RelPath, 0, len(targetRelPaths))
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int) //nolint:forcetypeassert
+		members := []int{i}
+		if group := groups[i]; group != "" {
+			members = groupMembers[group]
+		}
+		for _, i := range members {
+			sorted[i] = true
+			sortedTargetRelPaths = append(sortedTargetRelPaths, targetRelPaths[i])
+			for _, j := range dependents[i] {
+				inDegrees[j]--
+				if inDegrees[j] == 0 {
+					markReady(j)
+				}
+			}
+		}
+	}
+	if len(sortedTargetRelPaths) == len(targetRelPaths) {
+		return sortedTargetRelPaths, nil
+	}
+
+	// Find a cycle to report by following unsorted dependencies, or unready
+	// members of the same parallel group, until a target is repeated.
+	i := slices.IndexFunc(inDegrees, func(inDegree int) bool {
+		return inDegree > 0
+	})
+	var cycle []int
+	for !slices.Contains(cycle, i) {
+		cycle = append(cycle, i)
+		if j := slices.IndexFunc(dependencies[i], func(j int) bool {
+			return !sorted[j]
+		}); j != -1 {
+			i = dependencies[i][j]
+		} else {
+			i = groupMembers[groups[i]][slices.IndexFunc(groupMembers[groups[i]], func(j int) bool {
+				return inDegrees[j] > 0
+			})]
+		}
+	}
+	cycle = append(cycle[slices.Index(cycle, i):], i)
+	cycleRelPaths := make([]RelPath, 0, len(cycle))
+	for _, i := range cycle {
+		cycleRelPaths = append(cycleRelPaths, targetRelPaths[i])
+	}
+	return nil, &scriptDependencyCycleError{
+		targetRelPaths: cycleRelPaths,
+	}
+}
+
+// An intHeap is a min-heap of ints.
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *intHeap) Push(x any) {
+	*h = append(*h, x.(int)) //nolint:forcetypeassert
+}
+
+func (h *intHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
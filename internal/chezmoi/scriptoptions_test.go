@@ -0,0 +1,245 @@
+package chezmoi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestParseScriptOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        string
+		expected    *ScriptOptions
+		expectedErr string
+	}{
+		{
+			name:     "empty",
+			expected: &ScriptOptions{},
+		},
+		{
+			name: "depends_on",
+			data: chezmoitest.JoinLines(
+				"#!/bin/sh",
+				"# chezmoi:script:depends-on=.file depends-on=\"dir/with space\"",
+				"# chezmoi:script:depends-on=script.sh",
+			),
+			expected: &ScriptOptions{
+				DependsOn: []RelPath{
+					NewRelPath(".file"),
+					NewRelPath("dir/with space"),
+					NewRelPath("script.sh"),
+				},
+			},
+		},
+		{
+			name: "dry_run",
+			data: "# chezmoi:script:dry-run=true\n",
+			expected: &ScriptOptions{
+				DryRun: true,
+			},
+		},
+		{
+			name:        "invalid_dry_run",
+			data:        "# chezmoi:script:dry-run=maybe\n",
+			expectedErr: "maybe: invalid dry-run",
+		},
+		{
+			name: "onchange",
+			data: "# chezmoi:script:onchange=.config/app onchange=dot_theme-*\n",
+			expected: &ScriptOptions{
+				OnChange: []string{
+					".config/app",
+					"dot_theme-*",
+				},
+			},
+		},
+		{
+			name:        "invalid_onchange",
+			data:        "# chezmoi:script:onchange=[\n",
+			expectedErr: "[: invalid onchange pattern",
+		},
+		{
+			name: "parallel_group",
+			data: "# chezmoi:script:parallel-group=install\n",
+			expected: &ScriptOptions{
+				ParallelGroup: "install",
+			},
+		},
+		{
+			name: "timeout_and_retries",
+			data: "# chezmoi:script:timeout=1m30s retries=2\n",
+			expected: &ScriptOptions{
+				Retries: 2,
+				Timeout: 90 * time.Second,
+			},
+		},
+		{
+			name:        "invalid_retries",
+			data:        "# chezmoi:script:retries=-1\n",
+			expectedErr: "-1: invalid retries",
+		},
+		{
+			name:        "invalid_timeout",
+			data:        "# chezmoi:script:timeout=forever\n",
+			expectedErr: "forever: invalid timeout",
+		},
+		{
+			name:     "unknown_key",
+			data:     "# chezmoi:script:unknown=value\n",
+			expected: &ScriptOptions{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseScriptOptions([]byte(tc.data))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestSourceStateSortTargetRelPaths(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		root                   any
+		expectedTargetRelPaths []RelPath
+		expectedErr            string
+	}{
+		{
+			name: "no_dependencies",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_file":     "",
+					"run_after_1":  "",
+					"run_before_2": "",
+				},
+			},
+			expectedTargetRelPaths: []RelPath{
+				NewRelPath("2"),
+				NewRelPath(".file"),
+				NewRelPath("1"),
+			},
+		},
+		{
+			name: "script_dependencies",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"run_1": "# chezmoi:script:depends-on=3\n",
+					"run_2": "",
+					"run_3": "# chezmoi:script:depends-on=2\n",
+				},
+			},
+			expectedTargetRelPaths: []RelPath{
+				NewRelPath("2"),
+				NewRelPath("3"),
+				NewRelPath("1"),
+			},
+		},
+		{
+			name: "dir_dependency",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_dir": map[string]any{
+						"file": "",
+					},
+					"run_before_1": "# chezmoi:script:depends-on=.dir\n",
+					"run_before_2": "",
+				},
+			},
+			expectedTargetRelPaths: []RelPath{
+				NewRelPath("2"),
+				NewRelPath(".dir"),
+				NewRelPath(".dir/file"),
+				NewRelPath("1"),
+			},
+		},
+		{
+			name: "ignored_dependency",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					".chezmoiignore": ".ignored\n",
+					"dot_ignored":    "",
+					"run_1":          "# chezmoi:script:depends-on=.ignored\n",
+				},
+			},
+			expectedTargetRelPaths: []RelPath{
+				NewRelPath("1"),
+			},
+		},
+		{
+			name: "parallel_group",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"dot_file": "",
+					"run_1":    "# chezmoi:script:parallel-group=group\n",
+					"run_2":    "",
+					"run_3":    "# chezmoi:script:parallel-group=group\n# chezmoi:script:depends-on=.file\n",
+				},
+			},
+			expectedTargetRelPaths: []RelPath{
+				NewRelPath(".file"),
+				NewRelPath("1"),
+				NewRelPath("3"),
+				NewRelPath("2"),
+			},
+		},
+		{
+			name: "parallel_group_cycle",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"run_1": "# chezmoi:script:parallel-group=group\n",
+					"run_2": "# chezmoi:script:parallel-group=group\n# chezmoi:script:depends-on=1\n",
+				},
+			},
+			expectedErr: "script dependency cycle: 2 -> 1 -> 2",
+		},
+		{
+			name: "unknown_dependency",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"run_1": "# chezmoi:script:depends-on=.missing\n",
+				},
+			},
+			expectedErr: "1: .missing: dependency not in source state",
+		},
+		{
+			name: "cycle",
+			root: map[string]any{
+				"/home/user/.local/share/chezmoi": map[string]any{
+					"run_1": "# chezmoi:script:depends-on=2\n",
+					"run_2": "# chezmoi:script:depends-on=3\n",
+					"run_3": "# chezmoi:script:depends-on=1\n",
+				},
+			},
+			expectedErr: "script dependency cycle: 1 -> 2 -> 3 -> 1",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chezmoitest.WithTestFS(t, tc.root, func(fileSystem vfs.FS) {
+				ctx := t.Context()
+				system := NewRealSystem(fileSystem)
+				s := NewSourceState(
+					WithBaseSystem(system),
+					WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+					WithSystem(system),
+				)
+				assert.NoError(t, s.Read(ctx, nil))
+				actualTargetRelPaths, err := s.SortTargetRelPaths(s.TargetRelPaths())
+				if tc.expectedErr != "" {
+					assert.EqualError(t, err, tc.expectedErr)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedTargetRelPaths, actualTargetRelPaths)
+			})
+		})
+	}
+}
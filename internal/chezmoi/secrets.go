@@ -0,0 +1,62 @@
+package chezmoi
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Secret is a secret found in a file.
+type Secret struct {
+	Name  string // Name of the kind of secret, e.g. aws-access-token.
+	Value string
+}
+
+// A SecretsFunc returns the secrets in contents.
+type SecretsFunc func(contents []byte) ([]Secret, error)
+
+// A ReplaceSecretFunc returns a template action that evaluates to secret, which
+// was found in targetRelPath.
+type ReplaceSecretFunc func(targetRelPath RelPath, secret Secret) (string, error)
+
+// replaceSecrets returns the template contents with every occurrence of each
+// of secrets replaced with the template action returned by replaceSecretFunc.
+// Secrets with the same name are given unique names.
+func replaceSecrets(
+	targetRelPath RelPath,
+	contents []byte,
+	secrets []Secret,
+	replaceSecretFunc ReplaceSecretFunc,
+) ([]byte, error) {
+	// Replace longer secrets first so that secrets which contain other secrets
+	// are replaced whole.
+	secrets = slices.Clone(secrets)
+	slices.SortStableFunc(secrets, func(a, b Secret) int {
+		return cmp.Or(-cmp.Compare(len(a.Value), len(b.Value)), strings.Compare(a.Value, b.Value))
+	})
+	secrets = slices.CompactFunc(secrets, func(a, b Secret) bool {
+		return a.Value == b.Value
+	})
+
+	nameCount := make(map[string]int)
+	oldnew := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		if secret.Value == "" {
+			continue
+		}
+		nameCount[secret.Name]++
+		if count := nameCount[secret.Name]; count > 1 {
+			secret.Name += "-" + strconv.Itoa(count)
+		}
+		replacement, err := replaceSecretFunc(targetRelPath, secret)
+		if err != nil {
+			return nil, err
+		}
+		oldnew = append(oldnew, secret.Value, replacement)
+	}
+	if len(oldnew) == 0 {
+		return contents, nil
+	}
+	return []byte(strings.NewReplacer(oldnew...).Replace(string(contents))), nil
+}
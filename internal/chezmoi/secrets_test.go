@@ -0,0 +1,86 @@
+package chezmoi
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestReplaceSecrets(t *testing.T) {
+	encryption := &xorEncryption{
+		key: 0x55,
+	}
+	funcMap := template.FuncMap{
+		"decrypt": func(ciphertext string) string {
+			plaintext, err := encryption.Decrypt([]byte(ciphertext))
+			assert.NoError(t, err)
+			return string(plaintext)
+		},
+	}
+
+	for i, tc := range []struct {
+		contents      string
+		secrets       []Secret
+		expectedNames []string
+	}{
+		{
+			contents: "no secrets\n",
+		},
+		{
+			contents: chezmoitest.JoinLines(
+				"user = me",
+				"token = s3cr3t",
+			),
+			secrets: []Secret{
+				{Name: "token", Value: "s3cr3t"},
+			},
+			expectedNames: []string{"token"},
+		},
+		{
+			contents: chezmoitest.JoinLines(
+				"token1 = s3cr3t",
+				"token2 = s3cr3t-longer",
+				"token3 = s3cr3t",
+			),
+			secrets: []Secret{
+				{Name: "token", Value: "s3cr3t"},
+				{Name: "token", Value: "s3cr3t-longer"},
+				{Name: "token", Value: "s3cr3t"},
+			},
+			expectedNames: []string{"token", "token-2"},
+		},
+		{
+			contents: "quote = \"\\\n",
+			secrets: []Secret{
+				{Name: "quote", Value: "\"\\"},
+			},
+			expectedNames: []string{"quote"},
+		},
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var actualNames []string
+			replaceSecretFunc := func(targetRelPath RelPath, secret Secret) (string, error) {
+				assert.Equal(t, NewRelPath(".file"), targetRelPath)
+				actualNames = append(actualNames, secret.Name)
+				return EncryptInline(encryption, []byte(secret.Value))
+			}
+			actualContents, err := replaceSecrets(NewRelPath(".file"), []byte(tc.contents), tc.secrets, replaceSecretFunc)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedNames, actualNames)
+			for _, secret := range tc.secrets {
+				assert.False(t, strings.Contains(string(actualContents), secret.Value))
+			}
+
+			tmpl, err := template.New("").Funcs(funcMap).Parse(string(actualContents))
+			assert.NoError(t, err)
+			var builder strings.Builder
+			assert.NoError(t, tmpl.Execute(&builder, nil))
+			assert.Equal(t, tc.contents, builder.String())
+		})
+	}
+}
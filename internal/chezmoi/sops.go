@@ -0,0 +1,716 @@
+package chezmoi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/twpayne/chezmoi/internal/chezmoierrors"
+	"github.com/twpayne/chezmoi/internal/chezmoilog"
+)
+
+const (
+	sopsMetadataKey              = "sops"
+	sopsBinaryDataKey            = "data"
+	sopsDataKeySize              = 32
+	sopsNonceSize                = 32
+	sopsDefaultUnencryptedSuffix = "_unencrypted"
+)
+
+var sopsEncryptedValueRx = regexp.MustCompile(`\AENC\[AES256_GCM,data:(.*),iv:(.*),tag:(.*),type:(.*)\]\z`)
+
+// A sopsFormat is a SOPS file format.
+type sopsFormat int
+
+// SOPS file formats.
+const (
+	sopsFormatBinary sopsFormat = iota
+	sopsFormatJSON
+	sopsFormatYAML
+)
+
+// A SOPS decrypts and re-encrypts files encrypted with SOPS. See
+// https://getsops.io.
+type SOPS struct {
+	UseBuiltin bool     `json:"useBuiltin" mapstructure:"useBuiltin" yaml:"useBuiltin"`
+	Command    string   `json:"command"    mapstructure:"command"    yaml:"command"`
+	Args       []string `json:"args"       mapstructure:"args"       yaml:"args"`
+
+	// AgeEncryption and GPGEncryption are used by the builtin sops to decrypt
+	// the data key.
+	AgeEncryption *AgeEncryption `json:"-" mapstructure:"-" yaml:"-"`
+	GPGEncryption *GPGEncryption `json:"-" mapstructure:"-" yaml:"-"`
+}
+
+// sopsMetadata is the metadata of a SOPS file.
+type sopsMetadata struct {
+	Age []struct {
+		Recipient string `yaml:"recipient"`
+		Enc       string `yaml:"enc"`
+	} `yaml:"age"`
+	PGP []struct {
+		FP  string `yaml:"fp"`
+		Enc string `yaml:"enc"`
+	} `yaml:"pgp"`
+	KeyGroups         []any  `yaml:"key_groups"`
+	LastModified      string `yaml:"lastmodified"`
+	MAC               string `yaml:"mac"`
+	MACOnlyEncrypted  bool   `yaml:"mac_only_encrypted"`
+	UnencryptedSuffix string `yaml:"unencrypted_suffix"`
+	EncryptedSuffix   string `yaml:"encrypted_suffix"`
+	UnencryptedRegex  string `yaml:"unencrypted_regex"`
+	EncryptedRegex    string `yaml:"encrypted_regex"`
+
+	unencryptedRx *regexp.Regexp
+	encryptedRx   *regexp.Regexp
+}
+
+// A sopsFile is a parsed SOPS file.
+type sopsFile struct {
+	format      sopsFormat
+	tree        yaml.MapSlice
+	rawMetadata yaml.MapSlice
+	metadata    sopsMetadata
+}
+
+// A sopsReuseKey identifies a plaintext value at a path in a SOPS file so that
+// its ciphertext can be re-used if the value is unchanged.
+type sopsReuseKey struct {
+	path      string
+	valueType string
+	value     string
+}
+
+// isSOPSDocument returns if data, the contents of a file, is SOPS-encrypted.
+// sops writes files in formats that it does not support, for example TOML, as
+// JSON, so data is parsed as YAML, a superset of JSON, whatever its format.
+func isSOPSDocument(data []byte) bool {
+	var document map[string]any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return false
+	}
+	metadata, ok := document[sopsMetadataKey].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = metadata["mac"]
+	return ok
+}
+
+// Decrypt decrypts data read from the file name.
+func (s *SOPS) Decrypt(name string, data []byte) ([]byte, error) {
+	if !s.UseBuiltin {
+		return s.commandDecrypt(name, data)
+	}
+
+	file, err := parseSOPSFile(name, data)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := s.dataKey(&file.metadata)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.decrypt(dataKey, nil); err != nil {
+		return nil, err
+	}
+	return file.marshalPlaintext()
+}
+
+// Reencrypt returns data, read from the file name, with its values replaced by
+// those in plaintext. Values that are unchanged keep their existing
+// ciphertext, so only changed values are re-encrypted.
+func (s *SOPS) Reencrypt(name string, data, plaintext []byte) ([]byte, error) {
+	if !s.UseBuiltin {
+		return s.commandReencrypt(name, data, plaintext)
+	}
+
+	file, err := parseSOPSFile(name, data)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := s.dataKey(&file.metadata)
+	if err != nil {
+		return nil, err
+	}
+	reuse := make(map[sopsReuseKey][]string)
+	if err := file.decrypt(dataKey, reuse); err != nil {
+		return nil, err
+	}
+
+	switch file.format {
+	case sopsFormatBinary:
+		file.tree = yaml.MapSlice{{Key: sopsBinaryDataKey, Value: string(plaintext)}}
+	default:
+		var tree yaml.MapSlice
+		if err := yaml.UnmarshalWithOptions(plaintext, &tree, yaml.UseOrderedMap()); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if slices.ContainsFunc(tree, func(item yaml.MapItem) bool {
+			return item.Key == sopsMetadataKey
+		}) {
+			return nil, fmt.Errorf("%s: %s: reserved key", name, sopsMetadataKey)
+		}
+		file.tree = tree
+	}
+
+	if err := file.encrypt(dataKey, reuse, time.Now()); err != nil {
+		return nil, err
+	}
+	return file.marshalCiphertext()
+}
+
+// commandDecrypt decrypts data using the sops command.
+func (s *SOPS) commandDecrypt(name string, data []byte) ([]byte, error) {
+	var plaintext []byte
+	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
+		ciphertextAbsPath := tempDirAbsPath.JoinString(filepath.Base(name))
+		if err := os.WriteFile(ciphertextAbsPath.String(), data, 0o600); err != nil {
+			return err
+		}
+		args := append([]string{"--decrypt"}, s.Args...)
+		args = append(args, ciphertextAbsPath.String())
+		cmd := exec.Command(s.Command, args...)
+		cmd.Stderr = os.Stderr
+		var err error
+		plaintext, err = chezmoilog.LogCmdOutput(slog.Default(), cmd)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return plaintext, nil
+}
+
+// commandReencrypt re-encrypts data using the sops command. sops is run to
+// edit data with an editor that replaces the decrypted file with plaintext, so
+// sops keeps the existing data key and metadata.
+func (s *SOPS) commandReencrypt(name string, data, plaintext []byte) ([]byte, error) {
+	var ciphertext []byte
+	if err := withPrivateTempDir(func(tempDirAbsPath AbsPath) error {
+		ciphertextAbsPath := tempDirAbsPath.JoinString(filepath.Base(name))
+		if err := os.WriteFile(ciphertextAbsPath.String(), data, 0o600); err != nil {
+			return err
+		}
+		plaintextAbsPath := tempDirAbsPath.JoinString("plaintext")
+		if err := os.WriteFile(plaintextAbsPath.String(), plaintext, 0o600); err != nil {
+			return err
+		}
+		editor := sopsCopyEditor(plaintextAbsPath)
+		args := append(slices.Clone(s.Args), ciphertextAbsPath.String())
+		cmd := exec.Command(s.Command, args...)
+		cmd.Env = append(os.Environ(), "EDITOR="+editor, "SOPS_EDITOR="+editor)
+		cmd.Stderr = os.Stderr
+		if err := chezmoilog.LogCmdRun(slog.Default(), cmd); err != nil {
+			return err
+		}
+		var err error
+		ciphertext, err = os.ReadFile(ciphertextAbsPath.String())
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return ciphertext, nil
+}
+
+// dataKey returns the data key from metadata, decrypted with s's keys.
+func (s *SOPS) dataKey(metadata *sopsMetadata) ([]byte, error) {
+	if len(metadata.KeyGroups) > 0 {
+		return nil, errors.New("key groups are not supported by the builtin sops")
+	}
+	var errs []error
+	if s.AgeEncryption != nil {
+		for _, ageKey := range metadata.Age {
+			dataKey, err := s.AgeEncryption.Decrypt([]byte(ageKey.Enc))
+			if err == nil && len(dataKey) == sopsDataKeySize {
+				return dataKey, nil
+			}
+			errs = append(errs, fmt.Errorf("age: %s: %w", ageKey.Recipient, err))
+		}
+	}
+	if s.GPGEncryption != nil {
+		for _, pgpKey := range metadata.PGP {
+			dataKey, err := s.GPGEncryption.Decrypt([]byte(pgpKey.Enc))
+			if err == nil && len(dataKey) == sopsDataKeySize {
+				return dataKey, nil
+			}
+			errs = append(errs, fmt.Errorf("pgp: %s: %w", pgpKey.FP, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no age or pgp keys found")
+	}
+	return nil, fmt.Errorf("cannot decrypt data key: %w", chezmoierrors.Combine(errs...))
+}
+
+// parseSOPSFile parses a SOPS file with name from data.
+func parseSOPSFile(name string, data []byte) (*sopsFile, error) {
+	format, err := sopsFormatFromName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var document yaml.MapSlice
+	if err := yaml.UnmarshalWithOptions(data, &document, yaml.UseOrderedMap()); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	file := &sopsFile{
+		format: format,
+		tree:   make(yaml.MapSlice, 0, len(document)),
+	}
+	for _, item := range document {
+		if item.Key != sopsMetadataKey {
+			file.tree = append(file.tree, item)
+			continue
+		}
+		rawMetadata, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: invalid metadata", name, sopsMetadataKey)
+		}
+		file.rawMetadata = rawMetadata
+	}
+	if file.rawMetadata == nil {
+		return nil, fmt.Errorf("%s: not encrypted with sops", name)
+	}
+
+	metadataData, err := yaml.Marshal(file.rawMetadata)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(metadataData, &file.metadata); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", name, sopsMetadataKey, err)
+	}
+	if file.metadata.UnencryptedRegex != "" {
+		if file.metadata.unencryptedRx, err = regexp.Compile(file.metadata.UnencryptedRegex); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if file.metadata.EncryptedRegex != "" {
+		if file.metadata.encryptedRx, err = regexp.Compile(file.metadata.EncryptedRegex); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if file.metadata.UnencryptedSuffix == "" && file.metadata.EncryptedSuffix == "" &&
+		file.metadata.unencryptedRx == nil && file.metadata.encryptedRx == nil {
+		file.metadata.UnencryptedSuffix = sopsDefaultUnencryptedSuffix
+	}
+
+	return file, nil
+}
+
+// sopsFormatFromName returns the SOPS file format of name. As with sops,
+// formats that are not JSON or YAML, for example TOML, are binary.
+func sopsFormatFromName(name string) (sopsFormat, error) {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".json":
+		return sopsFormatJSON, nil
+	case ".yaml", ".yml":
+		return sopsFormatYAML, nil
+	case ".env", ".ini":
+		return sopsFormatBinary, fmt.Errorf("%s: %s format is not supported by the builtin sops", name, ext[1:])
+	default:
+		return sopsFormatBinary, nil
+	}
+}
+
+// decrypt decrypts all values in f in place and verifies f's MAC. If reuse is
+// not nil then the ciphertext of every encrypted value is recorded in it.
+func (f *sopsFile) decrypt(dataKey []byte, reuse map[sopsReuseKey][]string) error {
+	hash := sha512.New()
+	var walk func(value any, path []string) (any, error)
+	walk = func(value any, path []string) (any, error) {
+		switch value := value.(type) {
+		case yaml.MapSlice:
+			for i, item := range value {
+				var err error
+				if value[i].Value, err = walk(item.Value, appendPath(path, item.Key)); err != nil {
+					return nil, err
+				}
+			}
+			return value, nil
+		case []any:
+			for i, element := range value {
+				var err error
+				if value[i], err = walk(element, path); err != nil {
+					return nil, err
+				}
+			}
+			return value, nil
+		default:
+			encrypted := f.metadata.shouldEncrypt(path)
+			if ciphertext, ok := value.(string); ok && encrypted {
+				plaintext, valueType, err := sopsDecryptValue(ciphertext, dataKey, sopsAdditionalData(path))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", strings.Join(path, "."), err)
+				}
+				if reuse != nil {
+					reuseKey := newSOPSReuseKey(path, valueType, plaintext)
+					reuse[reuseKey] = append(reuse[reuseKey], ciphertext)
+				}
+				value = plaintext
+			}
+			if encrypted || !f.metadata.MACOnlyEncrypted {
+				hash.Write(sopsToBytes(value))
+			}
+			return value, nil
+		}
+	}
+	if _, err := walk(f.tree, nil); err != nil {
+		return err
+	}
+
+	mac, _, err := sopsDecryptValue(f.metadata.MAC, dataKey, f.metadata.LastModified)
+	if err != nil {
+		return fmt.Errorf("mac: %w", err)
+	}
+	if mac != sopsMAC(hash) {
+		return errors.New("mac mismatch")
+	}
+	return nil
+}
+
+// encrypt encrypts all values in f in place, re-using existing ciphertexts from
+// reuse, and updates f's metadata.
+func (f *sopsFile) encrypt(dataKey []byte, reuse map[sopsReuseKey][]string, now time.Time) error {
+	hash := sha512.New()
+	var walk func(value any, path []string) (any, error)
+	walk = func(value any, path []string) (any, error) {
+		switch value := value.(type) {
+		case yaml.MapSlice:
+			for i, item := range value {
+				var err error
+				if value[i].Value, err = walk(item.Value, appendPath(path, item.Key)); err != nil {
+					return nil, err
+				}
+			}
+			return value, nil
+		case []any:
+			for i, element := range value {
+				var err error
+				if value[i], err = walk(element, path); err != nil {
+					return nil, err
+				}
+			}
+			return value, nil
+		default:
+			encrypted := f.metadata.shouldEncrypt(path)
+			if encrypted || !f.metadata.MACOnlyEncrypted {
+				hash.Write(sopsToBytes(value))
+			}
+			if !encrypted || value == nil {
+				return value, nil
+			}
+			reuseKey := newSOPSReuseKey(path, sopsValueType(value), value)
+			if ciphertexts := reuse[reuseKey]; len(ciphertexts) > 0 {
+				reuse[reuseKey] = ciphertexts[1:]
+				return ciphertexts[0], nil
+			}
+			return sopsEncryptValue(value, dataKey, sopsAdditionalData(path))
+		}
+	}
+	if _, err := walk(f.tree, nil); err != nil {
+		return err
+	}
+
+	lastModified := now.UTC().Format(time.RFC3339)
+	mac, err := sopsEncryptValue(sopsMAC(hash), dataKey, lastModified)
+	if err != nil {
+		return err
+	}
+	f.metadata.LastModified = lastModified
+	f.metadata.MAC = mac
+	f.rawMetadata = setMapSliceValue(f.rawMetadata, "lastmodified", lastModified)
+	f.rawMetadata = setMapSliceValue(f.rawMetadata, "mac", mac)
+	return nil
+}
+
+// marshalCiphertext returns the encrypted contents of f.
+func (f *sopsFile) marshalCiphertext() ([]byte, error) {
+	document := append(slices.Clone(f.tree), yaml.MapItem{Key: sopsMetadataKey, Value: f.rawMetadata})
+	switch f.format {
+	case sopsFormatYAML:
+		return marshalSOPSYAML(document)
+	default:
+		return marshalSOPSJSON(document)
+	}
+}
+
+// marshalPlaintext returns the decrypted contents of f.
+func (f *sopsFile) marshalPlaintext() ([]byte, error) {
+	switch f.format {
+	case sopsFormatBinary:
+		for _, item := range f.tree {
+			if item.Key == sopsBinaryDataKey {
+				if data, ok := item.Value.(string); ok {
+					return []byte(data), nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s: missing or invalid key", sopsBinaryDataKey)
+	case sopsFormatJSON:
+		return marshalSOPSJSON(f.tree)
+	default:
+		return marshalSOPSYAML(f.tree)
+	}
+}
+
+// shouldEncrypt returns whether the value at path should be encrypted.
+func (m *sopsMetadata) shouldEncrypt(path []string) bool {
+	switch {
+	case m.UnencryptedSuffix != "":
+		return !slices.ContainsFunc(path, func(key string) bool {
+			return strings.HasSuffix(key, m.UnencryptedSuffix)
+		})
+	case m.EncryptedSuffix != "":
+		return slices.ContainsFunc(path, func(key string) bool {
+			return strings.HasSuffix(key, m.EncryptedSuffix)
+		})
+	case m.unencryptedRx != nil:
+		return !slices.ContainsFunc(path, m.unencryptedRx.MatchString)
+	case m.encryptedRx != nil:
+		return slices.ContainsFunc(path, m.encryptedRx.MatchString)
+	default:
+		return true
+	}
+}
+
+// appendPath returns a new path with key appended to path.
+func appendPath(path []string, key any) []string {
+	return append(slices.Clip(path), fmt.Sprint(key))
+}
+
+// marshalSOPSJSON marshals value as JSON, preserving the order of keys.
+func marshalSOPSJSON(value any) ([]byte, error) {
+	var write func(*bytes.Buffer, any) error
+	write = func(buffer *bytes.Buffer, value any) error {
+		switch value := value.(type) {
+		case yaml.MapSlice:
+			buffer.WriteByte('{')
+			for i, item := range value {
+				if i != 0 {
+					buffer.WriteByte(',')
+				}
+				key, err := json.Marshal(fmt.Sprint(item.Key))
+				if err != nil {
+					return err
+				}
+				buffer.Write(key)
+				buffer.WriteByte(':')
+				if err := write(buffer, item.Value); err != nil {
+					return err
+				}
+			}
+			buffer.WriteByte('}')
+		case []any:
+			buffer.WriteByte('[')
+			for i, element := range value {
+				if i != 0 {
+					buffer.WriteByte(',')
+				}
+				if err := write(buffer, element); err != nil {
+					return err
+				}
+			}
+			buffer.WriteByte(']')
+		default:
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			buffer.Write(data)
+		}
+		return nil
+	}
+	compact := &bytes.Buffer{}
+	if err := write(compact, value); err != nil {
+		return nil, err
+	}
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, compact.Bytes(), "", "\t"); err != nil {
+		return nil, err
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+// marshalSOPSYAML marshals value as YAML in the same style as sops.
+func marshalSOPSYAML(value any) ([]byte, error) {
+	return yaml.MarshalWithOptions(value,
+		yaml.Indent(4),
+		yaml.IndentSequence(true),
+		yaml.UseLiteralStyleIfMultiline(true),
+	)
+}
+
+// newSOPSReuseKey returns a new sopsReuseKey.
+func newSOPSReuseKey(path []string, valueType string, value any) sopsReuseKey {
+	return sopsReuseKey{
+		path:      sopsAdditionalData(path),
+		valueType: valueType,
+		value:     string(sopsToBytes(value)),
+	}
+}
+
+// setMapSliceValue sets the value of key in mapSlice.
+func setMapSliceValue(mapSlice yaml.MapSlice, key string, value any) yaml.MapSlice {
+	for i, item := range mapSlice {
+		if item.Key == key {
+			mapSlice[i].Value = value
+			return mapSlice
+		}
+	}
+	return append(mapSlice, yaml.MapItem{Key: key, Value: value})
+}
+
+// sopsAdditionalData returns the additional data used to authenticate the value
+// at path.
+func sopsAdditionalData(path []string) string {
+	return strings.Join(path, ":") + ":"
+}
+
+// sopsDecryptValue decrypts a single encrypted value.
+func sopsDecryptValue(value string, dataKey []byte, additionalData string) (any, string, error) {
+	m := sopsEncryptedValueRx.FindStringSubmatch(value)
+	if m == nil {
+		return nil, "", errors.New("invalid encrypted value")
+	}
+	var decoded [3][]byte
+	for i, s := range m[1:4] {
+		var err error
+		if decoded[i], err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, "", err
+		}
+	}
+	data, iv, tag := decoded[0], decoded[1], decoded[2]
+	gcm, err := newSOPSGCM(dataKey, len(iv))
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, "", err
+	}
+	switch valueType := m[4]; valueType {
+	case "bool":
+		value, err := strconv.ParseBool(string(plaintext))
+		return value, valueType, err
+	case "bytes", "comment", "str":
+		return string(plaintext), valueType, nil
+	case "float":
+		value, err := strconv.ParseFloat(string(plaintext), 64)
+		return value, valueType, err
+	case "int":
+		value, err := strconv.Atoi(string(plaintext))
+		return value, valueType, err
+	default:
+		return nil, "", fmt.Errorf("%s: unknown type", valueType)
+	}
+}
+
+// sopsEncryptValue encrypts a single value.
+func sopsEncryptValue(value any, dataKey []byte, additionalData string) (string, error) {
+	iv := make([]byte, sopsNonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	gcm, err := newSOPSGCM(dataKey, len(iv))
+	if err != nil {
+		return "", err
+	}
+	var plaintext []byte
+	switch value := value.(type) {
+	case bool:
+		plaintext = []byte(strconv.FormatBool(value))
+	default:
+		plaintext = sopsToBytes(value)
+	}
+	ciphertext := gcm.Seal(nil, iv, plaintext, []byte(additionalData))
+	data, tag := ciphertext[:len(ciphertext)-gcm.Overhead()], ciphertext[len(ciphertext)-gcm.Overhead():]
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(tag),
+		sopsValueType(value),
+	), nil
+}
+
+// newSOPSGCM returns a new AES-GCM cipher with dataKey and nonceSize.
+func newSOPSGCM(dataKey []byte, nonceSize int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, nonceSize)
+}
+
+// sopsCopyEditor returns an editor command for sops that replaces the file
+// being edited with the file at srcAbsPath.
+//
+// sops splits its editor command into arguments with POSIX shell quoting rules
+// on all platforms, so srcAbsPath is always quoted with single quotes. On
+// Windows, the arguments are then quoted for cmd.exe by os/exec, so copy
+// receives srcAbsPath as a single double-quoted argument.
+func sopsCopyEditor(srcAbsPath AbsPath) string {
+	quotedSrcAbsPath := "'" + strings.ReplaceAll(srcAbsPath.String(), "'", `'\''`) + "'"
+	if runtime.GOOS == "windows" {
+		return "cmd /c copy /y " + quotedSrcAbsPath
+	}
+	return "cp " + quotedSrcAbsPath
+}
+
+// sopsMAC returns the MAC from hash.
+func sopsMAC(hash hash.Hash) string {
+	return fmt.Sprintf("%X", hash.Sum(nil))
+}
+
+// sopsToBytes returns the representation of value used by sops.
+func sopsToBytes(value any) []byte {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		if value {
+			return []byte("True")
+		}
+		return []byte("False")
+	case float64:
+		return []byte(strconv.FormatFloat(value, 'f', -1, 64))
+	case string:
+		return []byte(value)
+	default:
+		return []byte(fmt.Sprint(value))
+	}
+}
+
+// sopsValueType returns the sops type of value.
+func sopsValueType(value any) string {
+	switch value.(type) {
+	case bool:
+		return "bool"
+	case float32, float64:
+		return "float"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	default:
+		return "str"
+	}
+}
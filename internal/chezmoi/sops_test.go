@@ -0,0 +1,214 @@
+package chezmoi
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/alecthomas/assert/v2"
+	"github.com/goccy/go-yaml"
+	vfs "github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestSOPS(t *testing.T) {
+	sops := newTestSOPS(t)
+
+	for _, tc := range []struct {
+		name      string
+		plaintext string
+	}{
+		{
+			name: "file.yaml",
+			plaintext: chezmoitest.JoinLines(
+				"bool: true",
+				"float: 1.5",
+				"int: 1",
+				"list:",
+				"    - a",
+				"    - b",
+				"map:",
+				"    key: value",
+				"public_unencrypted: public",
+				"string: secret",
+			),
+		},
+		{
+			name: "file.json",
+			plaintext: chezmoitest.JoinLines(
+				"{",
+				"\t\"string\": \"secret\",",
+				"\t\"bool\": false,",
+				"\t\"map\": {",
+				"\t\t\"key\": \"value\"",
+				"\t}",
+				"}",
+			),
+		},
+		{
+			name:      "file",
+			plaintext: "# contents of file\n",
+		},
+		{
+			name:      "file.toml",
+			plaintext: "string = \"secret\"\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ciphertext := newTestSOPSFile(t, sops, tc.name, []byte(tc.plaintext))
+			assert.False(t, strings.Contains(string(ciphertext), "secret"))
+			assert.True(t, strings.Contains(string(ciphertext), "ENC[AES256_GCM,"))
+
+			actualPlaintext, err := sops.Decrypt(tc.name, ciphertext)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.plaintext, string(actualPlaintext))
+		})
+	}
+}
+
+func TestSOPSMACMismatch(t *testing.T) {
+	sops := newTestSOPS(t)
+	ciphertext := newTestSOPSFile(t, sops, "file.yaml", []byte(chezmoitest.JoinLines(
+		"key1: value1",
+		"key2: value2",
+	)))
+	lines := strings.Split(string(ciphertext), "\n")
+	assert.True(t, strings.HasPrefix(lines[0], "key1: "))
+	_, err := sops.Decrypt("file.yaml", []byte(strings.Join(lines[1:], "\n")))
+	assert.EqualError(t, err, "mac mismatch")
+}
+
+func TestSOPSReencrypt(t *testing.T) {
+	sops := newTestSOPS(t)
+	ciphertext := newTestSOPSFile(t, sops, "file.yaml", []byte(chezmoitest.JoinLines(
+		"key1: value1",
+		"key2: value2",
+	)))
+
+	newPlaintext := chezmoitest.JoinLines(
+		"key1: value1",
+		"key2: new-value2",
+		"key3: value3",
+	)
+	newCiphertext, err := sops.Reencrypt("file.yaml", ciphertext, []byte(newPlaintext))
+	assert.NoError(t, err)
+
+	actualPlaintext, err := sops.Decrypt("file.yaml", newCiphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, newPlaintext, string(actualPlaintext))
+
+	var oldDocument, newDocument map[string]any
+	assert.NoError(t, yaml.Unmarshal(ciphertext, &oldDocument))
+	assert.NoError(t, yaml.Unmarshal(newCiphertext, &newDocument))
+	assert.Equal(t, oldDocument["key1"], newDocument["key1"])
+	assert.NotEqual(t, oldDocument["key2"], newDocument["key2"])
+}
+
+func TestSourceStateSOPSTemplateData(t *testing.T) {
+	sops := newTestSOPS(t)
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user/.local/share/chezmoi": map[string]any{
+			".chezmoidata.json": newTestSOPSFile(t, sops, ".chezmoidata.json", []byte(`{"json":"secret"}`)),
+			".chezmoidata.toml": newTestSOPSFile(t, sops, ".chezmoidata.toml", []byte(`toml = "secret"`)),
+			".chezmoidata.yaml": newTestSOPSFile(t, sops, ".chezmoidata.yaml", []byte(`yaml: secret`)),
+		},
+	}, func(fileSystem vfs.FS) {
+		system := NewRealSystem(fileSystem)
+		s := NewSourceState(
+			WithBaseSystem(system),
+			WithSOPS(sops),
+			WithSourceDir(NewAbsPath("/home/user/.local/share/chezmoi")),
+			WithSystem(system),
+		)
+		assert.NoError(t, s.Read(t.Context(), nil))
+		templateData := s.TemplateData()
+		assert.Equal(t, "secret", templateData["json"])
+		assert.Equal(t, "secret", templateData["toml"])
+		assert.Equal(t, "secret", templateData["yaml"])
+	})
+}
+
+func TestSOPSFormatFromName(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		expectedFormat sopsFormat
+		expectedErr    bool
+	}{
+		{name: "file", expectedFormat: sopsFormatBinary},
+		{name: "file.json", expectedFormat: sopsFormatJSON},
+		{name: "file.yaml", expectedFormat: sopsFormatYAML},
+		{name: "file.yml", expectedFormat: sopsFormatYAML},
+		{name: ".chezmoidata.toml", expectedFormat: sopsFormatBinary},
+		{name: ".env", expectedErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actualFormat, err := sopsFormatFromName(tc.name)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedFormat, actualFormat)
+			}
+		})
+	}
+}
+
+// newTestSOPS returns a new SOPS using the builtin age with a new identity.
+func newTestSOPS(t *testing.T) *SOPS {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	assert.NoError(t, os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600))
+	return &SOPS{
+		UseBuiltin: true,
+		AgeEncryption: &AgeEncryption{
+			UseBuiltin: true,
+			Identity:   NewAbsPath(identityFile),
+			Recipient:  identity.Recipient().String(),
+		},
+	}
+}
+
+// newTestSOPSFile returns plaintext encrypted by sops's age recipient.
+func newTestSOPSFile(t *testing.T, sops *SOPS, name string, plaintext []byte) []byte {
+	t.Helper()
+	dataKey := make([]byte, sopsDataKeySize)
+	_, err := rand.Read(dataKey)
+	assert.NoError(t, err)
+	encryptedDataKey, err := sops.AgeEncryption.Encrypt(dataKey)
+	assert.NoError(t, err)
+
+	format, err := sopsFormatFromName(name)
+	assert.NoError(t, err)
+	file := &sopsFile{
+		format: format,
+		rawMetadata: yaml.MapSlice{
+			{Key: "age", Value: []any{
+				yaml.MapSlice{
+					{Key: "recipient", Value: sops.AgeEncryption.Recipient},
+					{Key: "enc", Value: string(encryptedDataKey)},
+				},
+			}},
+			{Key: "unencrypted_suffix", Value: sopsDefaultUnencryptedSuffix},
+			{Key: "version", Value: "3.9.0"},
+		},
+		metadata: sopsMetadata{
+			UnencryptedSuffix: sopsDefaultUnencryptedSuffix,
+		},
+	}
+	if format == sopsFormatBinary {
+		file.tree = yaml.MapSlice{{Key: sopsBinaryDataKey, Value: string(plaintext)}}
+	} else {
+		assert.NoError(t, yaml.UnmarshalWithOptions(plaintext, &file.tree, yaml.UseOrderedMap()))
+	}
+	assert.NoError(t, file.encrypt(dataKey, nil, time.Now()))
+	ciphertext, err := file.marshalCiphertext()
+	assert.NoError(t, err)
+	return ciphertext
+}
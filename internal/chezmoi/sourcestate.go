@@ -130,6 +130,8 @@ type SourceState struct {
 	scriptTempDirAbsPath    AbsPath
 	umask                   fs.FileMode
 	encryption              Encryption
+	eventFunc               EventFunc
+	sops                    *SOPS
 	ignore                  *patternSet
 	remove                  *patternSet
 	interpreters            map[string]Interpreter
@@ -149,7 +151,11 @@ type SourceState struct {
 	templateOptions         []string
 	templates               map[string]*Template
 	externals               map[RelPath][]*External
+	handlers                map[string]*Handler
+	hooks                   []*Hook
+	hooksOnly               bool
 	ignoredRelPaths         chezmoiset.Set[RelPath]
+	packages                map[string]chezmoiset.Set[string]
 	warnFunc                WarnFunc
 }
 
@@ -191,6 +197,13 @@ func WithEncryption(encryption Encryption) SourceStateOption {
 	}
 }
 
+// WithEventFunc sets the function called for each event.
+func WithEventFunc(eventFunc EventFunc) SourceStateOption {
+	return func(s *SourceState) {
+		s.eventFunc = eventFunc
+	}
+}
+
 // WithHTTPClient sets the HTTP client.
 func WithHTTPClient(httpClient *http.Client) SourceStateOption {
 	return func(s *SourceState) {
@@ -247,6 +260,13 @@ func WithScriptTempDir(scriptDirAbsPath AbsPath) SourceStateOption {
 	}
 }
 
+// WithSOPS sets the SOPS decryption.
+func WithSOPS(sops *SOPS) SourceStateOption {
+	return func(s *SourceState) {
+		s.sops = sops
+	}
+}
+
 // WithSourceDir sets the source directory.
 func WithSourceDir(sourceDirAbsPath AbsPath) SourceStateOption {
 	return func(s *SourceState) {
@@ -261,6 +281,14 @@ func WithSystem(system System) SourceStateOption {
 	}
 }
 
+// WithHooksOnly sets whether only template data, ignore patterns, and hooks
+// should be read.
+func WithHooksOnly(hooksOnly bool) SourceStateOption {
+	return func(s *SourceState) {
+		s.hooksOnly = hooksOnly
+	}
+}
+
 // WithTemplateDataOnly sets whether only template data should be read.
 func WithTemplateDataOnly(templateDataOnly bool) SourceStateOption {
 	return func(s *SourceState) {
@@ -324,7 +352,9 @@ func NewSourceState(options ...SourceStateOption) *SourceState {
 		templateOptions:      DefaultTemplateOptions,
 		templates:            make(map[string]*Template),
 		externals:            make(map[RelPath][]*External),
+		handlers:             make(map[string]*Handler),
 		ignoredRelPaths:      chezmoiset.New[RelPath](),
+		packages:             make(map[string]chezmoiset.Set[string]),
 	}
 	for _, option := range options {
 		option(s)
@@ -353,6 +383,8 @@ type AddOptions struct {
 	ProtectedAbsPaths []AbsPath            // Paths that must not be added.
 	RemoveDir         RelPath              // Directory to remove before adding.
 	ReplaceFunc       ReplaceFunc          // Function to be called before a source entry is replaced.
+	ReplaceSecretFunc ReplaceSecretFunc    // Function to replace secrets in added files.
+	SecretsFunc       SecretsFunc          // Function to find secrets in added files.
 	Template          bool                 // Add the .tmpl attribute to added files.
 	TemplateSymlinks  bool                 // Add symlinks with targets in the source or home directories as templates.
 }
@@ -407,9 +439,11 @@ func (s *SourceState) Add(
 	}
 
 	type sourceUpdate struct {
-		destAbsPath    AbsPath
-		entryState     *EntryState
-		sourceRelPaths []SourceRelPath
+		destAbsPath         AbsPath
+		entryState          *EntryState
+		sourceRelPaths      []SourceRelPath
+		storeMergeBase      bool
+		mergeBaseEncryption Encryption
 	}
 
 	sourceUpdates := make([]sourceUpdate, 0, len(destAbsPaths))
@@ -501,6 +535,10 @@ DEST_ABS_PATH:
 			entryState:     entryState,
 			sourceRelPaths: []SourceRelPath{sourceEntryRelPath},
 		}
+		var encryptMergeBase bool
+		if update.storeMergeBase, encryptMergeBase = CanStoreMergeBase(newSourceStateEntry); encryptMergeBase {
+			update.mergeBaseEncryption = s.encryption
+		}
 
 		if oldSourceStateEntry := s.root.get(targetRelPath); oldSourceStateEntry != nil {
 			oldSourceEntryRelPath := oldSourceStateEntry.SourceRelPath()
@@ -625,7 +663,13 @@ DEST_ABS_PATH:
 			}
 		}
 		if !sourceUpdate.destAbsPath.IsEmpty() {
-			if err := PersistentStateSet(persistentState, EntryStateBucket, sourceUpdate.destAbsPath.Bytes(), sourceUpdate.entryState); err != nil {
+			if err := setLastWrittenEntryState(
+				persistentState,
+				sourceUpdate.destAbsPath,
+				sourceUpdate.entryState,
+				sourceUpdate.storeMergeBase,
+				sourceUpdate.mergeBaseEncryption,
+			); err != nil {
 				return err
 			}
 		}
@@ -688,9 +732,18 @@ func (s *SourceState) AddDestAbsPathInfos(
 // A PreApplyFunc is called before a target is applied.
 type PreApplyFunc func(targetRelPath RelPath, targetEntryState, lastWrittenEntryState, actualEntryState *EntryState) error
 
+// A PatchFunc is called before a file is applied over an existing file with
+// different contents. If it returns non-nil contents then they are applied
+// instead of the target state's contents.
+type PatchFunc func(targetRelPath RelPath, targetEntryState, actualEntryState *EntryState) ([]byte, error)
+
 // ApplyOptions are options to SourceState.ApplyAll and SourceState.ApplyOne.
 type ApplyOptions struct {
+	BackupStore  *BackupStore
+	ChangedFunc  func(targetRelPath RelPath, targetEntryState, actualEntryState *EntryState)
 	Filter       *EntryTypeFilter
+	Generation   *Generation
+	PatchFunc    PatchFunc
 	PreApplyFunc PreApplyFunc
 	Umask        fs.FileMode
 }
@@ -723,6 +776,11 @@ func (s *SourceState) Apply(
 	}
 
 	targetAbsPath := targetDirAbsPath.Join(targetRelPath)
+	storeMergeBase, encryptMergeBase := CanStoreMergeBase(sourceStateEntry)
+	var mergeBaseEncryption Encryption
+	if encryptMergeBase {
+		mergeBaseEncryption = s.encryption
+	}
 
 	targetEntryState, err := targetStateEntry.EntryState(options.Umask)
 	if err != nil {
@@ -741,6 +799,14 @@ func (s *SourceState) Apply(
 		return err
 	}
 
+	var actualEntryState *EntryState
+	if options.PreApplyFunc != nil || options.ChangedFunc != nil || options.PatchFunc != nil {
+		actualEntryState, err = actualStateEntry.EntryState()
+		if err != nil {
+			return err
+		}
+	}
+
 	if options.PreApplyFunc != nil {
 		var lastWrittenEntryState *EntryState
 		var entryState EntryState
@@ -752,11 +818,6 @@ func (s *SourceState) Apply(
 			lastWrittenEntryState = &entryState
 		}
 
-		actualEntryState, err := actualStateEntry.EntryState()
-		if err != nil {
-			return err
-		}
-
 		// If the target entry state matches the actual entry state, but not the
 		// last written entry state then silently update the last written entry
 		// state. This handles the case where the user makes identical edits to
@@ -764,17 +825,46 @@ func (s *SourceState) Apply(
 		// respect to the last written state, we record the effect of the last
 		// apply as the last written state.
 		if targetEntryState.Equivalent(actualEntryState) && !lastWrittenEntryState.Equivalent(actualEntryState) {
-			err := PersistentStateSet(persistentState, EntryStateBucket, targetAbsPath.Bytes(), targetEntryState)
-			if err != nil {
+			if err := setLastWrittenEntryState(persistentState, targetAbsPath, targetEntryState, storeMergeBase, mergeBaseEncryption); err != nil {
 				return err
 			}
 			lastWrittenEntryState = targetEntryState
 		}
 
-		err = options.PreApplyFunc(targetRelPath, targetEntryState, lastWrittenEntryState, actualEntryState)
+		if err := options.PreApplyFunc(targetRelPath, targetEntryState, lastWrittenEntryState, actualEntryState); err != nil {
+			return err
+		}
+	}
+
+	if targetStateFile, ok := targetStateEntry.(*TargetStateFile); ok && options.PatchFunc != nil &&
+		actualEntryState.Type == EntryStateTypeFile && !targetEntryState.Equivalent(actualEntryState) {
+		switch contents, err := options.PatchFunc(targetRelPath, targetEntryState, actualEntryState); {
+		case err != nil:
+			return err
+		case contents != nil:
+			targetStateEntry = targetStateFile.withContents(contents)
+			if targetEntryState, err = targetStateEntry.EntryState(options.Umask); err != nil {
+				return err
+			}
+		}
+	}
+
+	var generationEntry *GenerationEntry
+	if options.Generation != nil {
+		generationEntry, err = newGenerationEntry(actualStateEntry, targetStateEntry, targetEntryState)
 		if err != nil {
 			return err
 		}
+		if generationEntry != nil && !generationEntry.Before.Equivalent(targetEntryState) {
+			if err := options.Generation.StoreContents(actualStateEntry); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Back up any entries that are overwritten or removed.
+	if options.BackupStore != nil {
+		targetSystem = NewBackupSystem(targetSystem, options.BackupStore)
 	}
 
 	if changed, err := targetStateEntry.Apply(targetSystem, persistentState, actualStateEntry); err != nil {
@@ -783,7 +873,15 @@ func (s *SourceState) Apply(
 		return nil
 	}
 
-	return PersistentStateSet(persistentState, EntryStateBucket, targetAbsPath.Bytes(), targetEntryState)
+	if generationEntry != nil {
+		options.Generation.Record(targetAbsPath, generationEntry)
+	}
+
+	if options.ChangedFunc != nil {
+		options.ChangedFunc(targetRelPath, targetEntryState, actualEntryState)
+	}
+
+	return setLastWrittenEntryState(persistentState, targetAbsPath, targetEntryState, storeMergeBase, mergeBaseEncryption)
 }
 
 // Encryption returns s's encryption.
@@ -801,29 +899,10 @@ type ExecuteTemplateDataOptions struct {
 
 // ExecuteTemplateData returns the result of executing template data.
 func (s *SourceState) ExecuteTemplateData(options ExecuteTemplateDataOptions) ([]byte, error) {
-	templateOptions := options.TemplateOptions
-	templateOptions.Funcs = s.templateFuncs
-	templateOptions.Options = slices.Clone(s.templateOptions)
-
-	tmpl, err := ParseTemplate(options.Name, options.Data, templateOptions)
+	tmpl, templateData, err := s.parseTemplateData(options)
 	if err != nil {
 		return nil, err
 	}
-
-	for _, t := range s.templates {
-		tmpl, err = tmpl.AddParseTree(t)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// Set .chezmoi.sourceFile to the name of the template.
-	templateData := s.TemplateData()
-	if chezmoiTemplateData, ok := templateData["chezmoi"].(map[string]any); ok {
-		chezmoiTemplateData["sourceFile"] = options.Name
-		chezmoiTemplateData["targetFile"] = options.Destination
-	}
-
 	return tmpl.Execute(templateData)
 }
 
@@ -995,6 +1074,24 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 			return fs.SkipDir
 		case s.templateDataOnly:
 			return nil
+		case isPrefixDotFormat(fileInfo.Name(), hooksName) || isPrefixDotFormatDotTmpl(fileInfo.Name(), hooksName):
+			parentAbsPath, _ := sourceAbsPath.Split()
+			return s.addHooks(sourceAbsPath, parentAbsPath)
+		case fileInfo.Name() == ignoreName || fileInfo.Name() == ignoreName+TemplateSuffix:
+			return s.addPatterns(s.ignore, sourceAbsPath, parentSourceRelPath)
+		case s.hooksOnly:
+			switch {
+			case !fileInfo.IsDir():
+				return nil
+			case strings.HasPrefix(fileInfo.Name(), ignorePrefix):
+				return fs.SkipDir
+			}
+			da := parseDirAttr(sourceName.String())
+			targetRelPath := parentSourceRelPath.Dir().TargetRelPath(s.encryption.EncryptedSuffix()).JoinString(da.TargetName)
+			if da.External || s.Ignore(targetRelPath) {
+				return fs.SkipDir
+			}
+			return nil
 		case isPrefixDotFormat(fileInfo.Name(), externalName) || isPrefixDotFormatDotTmpl(fileInfo.Name(), externalName):
 			parentAbsPath, _ := sourceAbsPath.Split()
 			return s.addExternal(sourceAbsPath, parentAbsPath)
@@ -1003,8 +1100,11 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 				return err
 			}
 			return fs.SkipDir
-		case fileInfo.Name() == ignoreName || fileInfo.Name() == ignoreName+TemplateSuffix:
-			return s.addPatterns(s.ignore, sourceAbsPath, parentSourceRelPath)
+		case isPrefixDotFormat(fileInfo.Name(), handlersName) || isPrefixDotFormatDotTmpl(fileInfo.Name(), handlersName):
+			parentAbsPath, _ := sourceAbsPath.Split()
+			return s.addHandlers(sourceAbsPath, parentAbsPath)
+		case isPrefixDotFormat(fileInfo.Name(), packagesName) || isPrefixDotFormatDotTmpl(fileInfo.Name(), packagesName):
+			return s.addPackages(sourceAbsPath)
 		case fileInfo.Name() == removeName || fileInfo.Name() == removeName+TemplateSuffix:
 			return s.addPatterns(s.remove, sourceAbsPath, parentSourceRelPath)
 		case fileInfo.Name() == scriptsDirName:
@@ -1072,7 +1172,7 @@ func (s *SourceState) Read(ctx context.Context, options *ReadOptions) error {
 		return err
 	}
 
-	if s.templateDataOnly {
+	if s.templateDataOnly || s.hooksOnly {
 		return nil
 	}
 
@@ -1461,6 +1561,11 @@ func (s *SourceState) addTemplateData(sourceAbsPath AbsPath) error {
 	if err != nil {
 		return fmt.Errorf("%s: %w", sourceAbsPath, err)
 	}
+	if isSOPSDocument(data) {
+		if data, err = s.decryptSOPS(sourceAbsPath.Base(), data); err != nil {
+			return fmt.Errorf("%s: %w", sourceAbsPath, err)
+		}
+	}
 	var templateData map[string]any
 	if err := format.Unmarshal(data, &templateData); err != nil {
 		return fmt.Errorf("%s: %w", sourceAbsPath, err)
@@ -1474,6 +1579,14 @@ func (s *SourceState) addTemplateData(sourceAbsPath AbsPath) error {
 	return nil
 }
 
+// decryptSOPS decrypts the SOPS-encrypted data of the file name.
+func (s *SourceState) decryptSOPS(name string, data []byte) ([]byte, error) {
+	if s.sops == nil {
+		return nil, errors.New("sops not configured")
+	}
+	return s.sops.Decrypt(name, data)
+}
+
 // addTemplateDataDir adds all template data in the directory sourceAbsPath to s.
 func (s *SourceState) addTemplateDataDir(sourceAbsPath AbsPath, fileInfo fs.FileInfo) error {
 	walkFunc := func(dataAbsPath AbsPath, fileInfo fs.FileInfo, err error) error {
@@ -1629,6 +1742,7 @@ func (s *SourceState) getExternalDataRaw(
 	if err != nil {
 		return nil, err
 	}
+	start := time.Now()
 	resp, err := chezmoilog.LogHTTPRequest(ctx, s.logger, s.httpClient, req)
 	if err != nil {
 		return nil, err
@@ -1657,6 +1771,16 @@ func (s *SourceState) getExternalDataRaw(
 		return nil, err
 	}
 
+	if s.eventFunc != nil {
+		duration := time.Since(start).Seconds()
+		s.eventFunc(&Event{
+			Type:     EventTypeExternalFetched,
+			Path:     s.destDirAbsPath.Join(externalRelPath).String(),
+			URL:      urlStr,
+			Duration: &duration,
+		})
+	}
+
 	return data, nil
 }
 
@@ -1852,7 +1976,7 @@ func (s *SourceState) newCreateTargetStateEntryFunc(
 			empty:              fileAttr.Empty,
 			perm:               fileAttr.perm() &^ s.umask,
 			sourceAttr: SourceAttr{
-				Encrypted: fileAttr.Encrypted,
+				Encrypted: fileAttr.Encrypted || fileAttr.SOPS,
 				Template:  fileAttr.Template,
 			},
 		}, nil
@@ -1867,7 +1991,7 @@ func (s *SourceState) newFileTargetStateEntryFunc(
 	sourceContentsFunc func() ([]byte, error),
 ) targetStateEntryFunc {
 	return func(destSystem System, destAbsPath AbsPath) (TargetStateEntry, error) {
-		if s.mode == ModeSymlink && !fileAttr.Encrypted && !fileAttr.Executable && !fileAttr.Private && !fileAttr.Template {
+		if s.mode == ModeSymlink && !fileAttr.Encrypted && !fileAttr.SOPS && !fileAttr.Executable && !fileAttr.Private && !fileAttr.Template {
 			switch contents, err := sourceContentsFunc(); {
 			case err != nil:
 				return nil, err
@@ -1906,7 +2030,7 @@ func (s *SourceState) newFileTargetStateEntryFunc(
 			empty:              fileAttr.Empty,
 			perm:               fileAttr.perm() &^ s.umask,
 			sourceAttr: SourceAttr{
-				Encrypted: fileAttr.Encrypted,
+				Encrypted: fileAttr.Encrypted || fileAttr.SOPS,
 				Template:  fileAttr.Template,
 			},
 		}, nil
@@ -2044,6 +2168,14 @@ func (s *SourceState) newScriptTargetStateEntryFunc(
 	interpreter *Interpreter,
 ) targetStateEntryFunc {
 	return func(destSystem System, destAbsPath AbsPath) (TargetStateEntry, error) {
+		sourceContents, err := sourceContentsFunc()
+		if err != nil {
+			return nil, err
+		}
+		scriptOptions, err := parseScriptOptions(sourceContents)
+		if err != nil {
+			return nil, err
+		}
 		contentsFunc := sync.OnceValues(func() ([]byte, error) {
 			contents, err := sourceContentsFunc()
 			if err != nil {
@@ -2061,12 +2193,20 @@ func (s *SourceState) newScriptTargetStateEntryFunc(
 			}
 			return contents, nil
 		})
+		var dependenciesFunc func() (map[string]HexBytes, error)
+		if fileAttr.Condition == ScriptConditionOnChange && len(scriptOptions.OnChange) != 0 {
+			dependenciesFunc = sync.OnceValues(func() (map[string]HexBytes, error) {
+				return s.onChangeDependencySHA256s(destSystem, scriptOptions.OnChange)
+			})
+		}
 		return &TargetStateScript{
 			name:               targetRelPath,
 			contentsFunc:       contentsFunc,
 			contentsSHA256Func: lazySHA256(contentsFunc),
+			dependenciesFunc:   dependenciesFunc,
 			condition:          fileAttr.Condition,
 			interpreter:        interpreter,
+			options:            *scriptOptions,
 			sourceAttr: SourceAttr{
 				Condition: fileAttr.Condition,
 			},
@@ -2126,6 +2266,12 @@ func (s *SourceState) newSourceStateFile(
 				return nil, err
 			}
 		}
+		if fileAttr.SOPS {
+			contents, err = s.decryptSOPS(fileAttr.TargetName, contents)
+			if err != nil {
+				return nil, err
+			}
+		}
 		return contents, nil
 	})
 
@@ -2229,6 +2375,12 @@ func (s *SourceState) newSourceStateFileEntryFromFile(
 	if err != nil {
 		return nil, err
 	}
+	var secrets []Secret
+	if options.SecretsFunc != nil && options.ReplaceSecretFunc != nil && !options.Encrypt {
+		if secrets, err = options.SecretsFunc(contents); err != nil {
+			return nil, err
+		}
+	}
 	if options.AutoTemplate {
 		var replacements bool
 		contents, replacements = autoTemplate(contents, s.TemplateData())
@@ -2236,6 +2388,17 @@ func (s *SourceState) newSourceStateFileEntryFromFile(
 			fileAttr.Template = true
 		}
 	}
+	if len(secrets) > 0 {
+		if !fileAttr.Template {
+			contents = templateMarkerRx.ReplaceAll(contents, []byte(`{{ "$0" }}`))
+			fileAttr.Template = true
+		}
+		targetRelPath := actualStateFile.absPath.MustTrimDirPrefix(s.destDirAbsPath)
+		contents, err = replaceSecrets(targetRelPath, contents, secrets, options.ReplaceSecretFunc)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(contents) == 0 {
 		fileAttr.Empty = true
 	}
@@ -2314,6 +2477,35 @@ func (s *SourceState) newSourceStateFileEntryFromSymlink(
 	}, nil
 }
 
+// parseTemplateData parses the template data in options and returns the
+// template and the template data to execute it with.
+func (s *SourceState) parseTemplateData(options ExecuteTemplateDataOptions) (*Template, map[string]any, error) {
+	templateOptions := options.TemplateOptions
+	templateOptions.Funcs = s.templateFuncs
+	templateOptions.Options = slices.Clone(s.templateOptions)
+
+	tmpl, err := ParseTemplate(options.Name, options.Data, templateOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, t := range s.templates {
+		tmpl, err = tmpl.AddParseTree(t)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Set .chezmoi.sourceFile to the name of the template.
+	templateData := s.TemplateData()
+	if chezmoiTemplateData, ok := templateData["chezmoi"].(map[string]any); ok {
+		chezmoiTemplateData["sourceFile"] = options.Name
+		chezmoiTemplateData["targetFile"] = options.Destination
+	}
+
+	return tmpl, templateData, nil
+}
+
 // populateImplicitParentDirs creates implicit parent directories for externalRelPath.
 func (s *SourceState) populateImplicitParentDirs(
 	externalRelPath RelPath,
@@ -4,6 +4,7 @@ import (
 	"cmp"
 	"context"
 	"errors"
+	"io"
 	"io/fs"
 	"os/exec"
 	"slices"
@@ -17,7 +18,23 @@ import (
 type RunScriptOptions struct {
 	Interpreter   *Interpreter
 	Condition     ScriptCondition
+	DependsOn     []RelPath
+	DryRun        bool
+	Env           []string
+	ParallelGroup string
+	Retries       int
+	RunCmdFunc    func(*exec.Cmd) error
 	SourceRelPath SourceRelPath
+	Timeout       time.Duration
+
+	// Output, if set, receives a copy of the script's combined standard
+	// output and standard error.
+	Output io.Writer
+
+	// Stdout and Stderr, if set, replace the script's standard output and
+	// standard error. The script's standard input is not connected.
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 // A System reads from and writes to a filesystem, runs scripts, and persists
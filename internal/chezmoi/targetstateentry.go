@@ -6,8 +6,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os/exec"
 	"runtime"
+	"slices"
 	"time"
 )
 
@@ -57,8 +59,10 @@ type TargetStateScript struct {
 	name               RelPath
 	contentsFunc       func() ([]byte, error)
 	contentsSHA256Func func() ([32]byte, error)
+	dependenciesFunc   func() (map[string]HexBytes, error)
 	interpreter        *Interpreter
 	condition          ScriptCondition
+	options            ScriptOptions
 	sourceAttr         SourceAttr
 	sourceRelPath      SourceRelPath
 }
@@ -268,6 +272,19 @@ func (t *TargetStateFile) EntryState(umask fs.FileMode) (*EntryState, error) {
 	}, nil
 }
 
+// withContents returns a copy of t with contents. The copy is never treated as
+// empty, so applying it writes contents even if they are empty.
+func (t *TargetStateFile) withContents(contents []byte) *TargetStateFile {
+	return &TargetStateFile{
+		contentsFunc:       eagerNoErr(contents),
+		contentsSHA256Func: eagerNoErr(sha256.Sum256(contents)),
+		empty:              true,
+		overwrite:          t.overwrite,
+		perm:               t.perm,
+		sourceAttr:         t.sourceAttr,
+	}
+}
+
 // Evaluate evaluates t.
 func (t *TargetStateFile) Evaluate() error {
 	if _, err := t.Contents(); err != nil {
@@ -342,11 +359,6 @@ func (t *TargetStateScript) Apply(
 		return false, nil
 	}
 
-	contentsSHA256, err := t.ContentsSHA256()
-	if err != nil {
-		return false, err
-	}
-
 	contents, err := t.Contents()
 	if err != nil {
 		return false, err
@@ -355,26 +367,19 @@ func (t *TargetStateScript) Apply(
 	if !isEmpty(contents) {
 		if err := system.RunScript(t.name, actualStateEntry.Path().Dir(), contents, RunScriptOptions{
 			Condition:     t.condition,
+			DependsOn:     t.options.DependsOn,
+			DryRun:        t.options.DryRun,
 			Interpreter:   t.interpreter,
+			ParallelGroup: t.options.ParallelGroup,
+			Retries:       t.options.Retries,
 			SourceRelPath: t.sourceRelPath,
+			Timeout:       t.options.Timeout,
 		}); err != nil {
 			return false, err
 		}
 	}
 
-	scriptStateKey := []byte(hex.EncodeToString(contentsSHA256[:]))
-	if err := PersistentStateSet(persistentState, ScriptStateBucket, scriptStateKey, &scriptState{
-		Name:  t.name,
-		RunAt: runAt,
-	}); err != nil {
-		return false, err
-	}
-
-	entryStateKey := actualStateEntry.Path().Bytes()
-	if err := PersistentStateSet(persistentState, EntryStateBucket, entryStateKey, &EntryState{
-		Type:           EntryStateTypeScript,
-		ContentsSHA256: HexBytes(contentsSHA256[:]),
-	}); err != nil {
+	if err := t.MarkRun(persistentState, actualStateEntry.Path(), runAt); err != nil {
 		return false, err
 	}
 
@@ -393,14 +398,7 @@ func (t *TargetStateScript) ContentsSHA256() ([32]byte, error) {
 
 // EntryState returns t's entry state.
 func (t *TargetStateScript) EntryState(umask fs.FileMode) (*EntryState, error) {
-	contentsSHA256, err := t.ContentsSHA256()
-	if err != nil {
-		return nil, err
-	}
-	return &EntryState{
-		Type:           EntryStateTypeScript,
-		ContentsSHA256: HexBytes(contentsSHA256[:]),
-	}, nil
+	return t.entryState()
 }
 
 // Evaluate evaluates t.
@@ -409,6 +407,43 @@ func (t *TargetStateScript) Evaluate() error {
 	return err
 }
 
+// MarkNotRun removes the records that t, at targetAbsPath, has been run with
+// its current contents from persistentState.
+func (t *TargetStateScript) MarkNotRun(persistentState PersistentState, targetAbsPath AbsPath) error {
+	contentsSHA256, err := t.ContentsSHA256()
+	if err != nil {
+		return err
+	}
+	scriptStateKey := []byte(hex.EncodeToString(contentsSHA256[:]))
+	if err := persistentState.Delete(ScriptStateBucket, scriptStateKey); err != nil {
+		return err
+	}
+	return persistentState.Delete(EntryStateBucket, targetAbsPath.Bytes())
+}
+
+// MarkRun records in persistentState that t, at targetAbsPath, was run with its
+// current contents at runAt.
+func (t *TargetStateScript) MarkRun(persistentState PersistentState, targetAbsPath AbsPath, runAt time.Time) error {
+	contentsSHA256, err := t.ContentsSHA256()
+	if err != nil {
+		return err
+	}
+
+	scriptStateKey := []byte(hex.EncodeToString(contentsSHA256[:]))
+	if err := PersistentStateSet(persistentState, ScriptStateBucket, scriptStateKey, &scriptState{
+		Name:  t.name,
+		RunAt: runAt,
+	}); err != nil {
+		return err
+	}
+
+	entryState, err := t.entryState()
+	if err != nil {
+		return err
+	}
+	return PersistentStateSet(persistentState, EntryStateBucket, targetAbsPath.Bytes(), entryState)
+}
+
 // SkipApply implements TargetStateEntry.SkipApply.
 func (t *TargetStateScript) SkipApply(persistentState PersistentState, targetAbsPath AbsPath) (bool, error) {
 	switch contents, err := t.Contents(); {
@@ -442,11 +477,11 @@ func (t *TargetStateScript) SkipApply(persistentState PersistentState, targetAbs
 			if err := stateFormat.Unmarshal(entryStateBytes, &entryState); err != nil {
 				return false, err
 			}
-			contentsSHA256, err := t.ContentsSHA256()
+			targetEntryState, err := t.entryState()
 			if err != nil {
 				return false, err
 			}
-			if bytes.Equal(entryState.ContentsSHA256.Bytes(), contentsSHA256[:]) {
+			if bytes.Equal(entryState.ContentsSHA256.Bytes(), targetEntryState.ContentsSHA256.Bytes()) {
 				return true, nil
 			}
 		}
@@ -454,6 +489,37 @@ func (t *TargetStateScript) SkipApply(persistentState PersistentState, targetAbs
 	return false, nil
 }
 
+// entryState returns t's entry state. If t has onchange dependencies then its
+// ContentsSHA256 is the SHA256 sum of its contents and its dependencies.
+func (t *TargetStateScript) entryState() (*EntryState, error) {
+	contentsSHA256, err := t.ContentsSHA256()
+	if err != nil {
+		return nil, err
+	}
+	if t.dependenciesFunc == nil {
+		return &EntryState{
+			Type:           EntryStateTypeScript,
+			ContentsSHA256: HexBytes(contentsSHA256[:]),
+		}, nil
+	}
+
+	dependencySHA256s, err := t.dependenciesFunc()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	hash.Write(contentsSHA256[:])
+	for _, targetName := range slices.Sorted(maps.Keys(dependencySHA256s)) {
+		hash.Write([]byte(targetName + "\x00"))
+		hash.Write(dependencySHA256s[targetName])
+	}
+	return &EntryState{
+		Type:              EntryStateTypeScript,
+		ContentsSHA256:    HexBytes(hash.Sum(nil)),
+		DependencySHA256s: dependencySHA256s,
+	}, nil
+}
+
 // SourceAttr implements TargetStateEntry.SourceAttr.
 func (t *TargetStateScript) SourceAttr() SourceAttr {
 	return t.sourceAttr
@@ -0,0 +1,192 @@
+package chezmoi
+
+import (
+	"fmt"
+	"slices"
+	"text/template/parse"
+
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+)
+
+// A TemplateFuncCall is a call to a template function found by statically
+// analyzing a template.
+type TemplateFuncCall struct {
+	Name    string   `json:"name"    yaml:"name"`
+	Args    []string `json:"args"    yaml:"args"`
+	Literal bool     `json:"literal" yaml:"literal"`
+}
+
+// FuncCalls returns all calls to template functions in t and the names of all
+// templates invoked by t with the template action.
+//
+// Arguments that are literals are returned as their values. Other arguments
+// are returned as their template source and the call is marked as not
+// literal. Values piped into a function are treated as its last argument.
+func (t *Template) FuncCalls() ([]TemplateFuncCall, []string) {
+	var funcCalls []TemplateFuncCall
+	var templateNames []string
+
+	var walkNode func(parse.Node)
+	walkPipe := func(pipe *parse.PipeNode) {
+		if pipe == nil {
+			return
+		}
+		var prevArg parse.Node
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				walkNode(arg)
+			}
+			if len(cmd.Args) == 0 {
+				continue
+			}
+			identifier, ok := cmd.Args[0].(*parse.IdentifierNode)
+			if !ok {
+				prevArg = nil
+				if len(cmd.Args) == 1 {
+					prevArg = cmd.Args[0]
+				}
+				continue
+			}
+			args := slices.Clone(cmd.Args[1:])
+			if prevArg != nil {
+				args = append(args, prevArg)
+			}
+			funcCall := TemplateFuncCall{
+				Name:    identifier.Ident,
+				Args:    make([]string, 0, len(args)),
+				Literal: true,
+			}
+			for _, arg := range args {
+				switch arg := arg.(type) {
+				case *parse.StringNode:
+					funcCall.Args = append(funcCall.Args, arg.Text)
+				case *parse.BoolNode, *parse.NumberNode:
+					funcCall.Args = append(funcCall.Args, arg.String())
+				default:
+					funcCall.Args = append(funcCall.Args, arg.String())
+					funcCall.Literal = false
+				}
+			}
+			funcCalls = append(funcCalls, funcCall)
+			prevArg = nil
+		}
+	}
+	walkNode = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ActionNode:
+			walkPipe(node.Pipe)
+		case *parse.BranchNode:
+			walkPipe(node.Pipe)
+			walkNode(node.List)
+			walkNode(node.ElseList)
+		case *parse.ChainNode:
+			walkNode(node.Node)
+		case *parse.IfNode:
+			walkNode(&node.BranchNode)
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, child := range node.Nodes {
+				walkNode(child)
+			}
+		case *parse.PipeNode:
+			walkPipe(node)
+		case *parse.RangeNode:
+			walkNode(&node.BranchNode)
+		case *parse.TemplateNode:
+			templateNames = append(templateNames, node.Name)
+			walkPipe(node.Pipe)
+		case *parse.WithNode:
+			walkNode(&node.BranchNode)
+		}
+	}
+
+	for _, tmpl := range t.template.Templates() {
+		if tmpl.Tree != nil {
+			walkNode(tmpl.Tree.Root)
+		}
+	}
+
+	return funcCalls, templateNames
+}
+
+// TemplateFuncCalls returns all calls to template functions in the templates
+// in s, indexed by target. Calls made by templates in .chezmoitemplates are
+// included in the calls of each target that uses them.
+func (s *SourceState) TemplateFuncCalls() (map[RelPath][]TemplateFuncCall, error) {
+	type namedTemplate struct {
+		funcCalls     []TemplateFuncCall
+		templateNames []string
+	}
+	namedTemplates := make(map[string]namedTemplate, len(s.templates))
+	for name, tmpl := range s.templates {
+		funcCalls, templateNames := tmpl.FuncCalls()
+		namedTemplates[name] = namedTemplate{
+			funcCalls:     funcCalls,
+			templateNames: templateNames,
+		}
+	}
+
+	// addNamedTemplate appends the calls of the template name, and all the
+	// templates that it uses, to funcCalls.
+	var addNamedTemplate func([]TemplateFuncCall, string, chezmoiset.Set[string]) []TemplateFuncCall
+	addNamedTemplate = func(funcCalls []TemplateFuncCall, name string, visited chezmoiset.Set[string]) []TemplateFuncCall {
+		if visited.Contains(name) {
+			return funcCalls
+		}
+		visited.Add(name)
+		namedTemplate, ok := namedTemplates[name]
+		if !ok {
+			return funcCalls
+		}
+		funcCalls = append(funcCalls, namedTemplate.funcCalls...)
+		for _, funcCall := range namedTemplate.funcCalls {
+			if funcCall.Name == "includeTemplate" && funcCall.Literal && len(funcCall.Args) > 0 {
+				funcCalls = addNamedTemplate(funcCalls, funcCall.Args[0], visited)
+			}
+		}
+		for _, templateName := range namedTemplate.templateNames {
+			funcCalls = addNamedTemplate(funcCalls, templateName, visited)
+		}
+		return funcCalls
+	}
+
+	templateOptions := TemplateOptions{
+		Funcs:   s.templateFuncs,
+		Options: slices.Clone(s.templateOptions),
+	}
+	result := make(map[RelPath][]TemplateFuncCall)
+	if err := s.ForEach(func(targetRelPath RelPath, sourceStateEntry SourceStateEntry) error {
+		sourceStateFile, ok := sourceStateEntry.(*SourceStateFile)
+		if !ok || !sourceStateFile.Attr.Template {
+			return nil
+		}
+		contents, err := sourceStateFile.Contents()
+		if err != nil {
+			return err
+		}
+		sourceRelPath := sourceStateFile.SourceRelPath().RelPath().String()
+		tmpl, err := ParseTemplate(sourceRelPath, contents, templateOptions)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sourceRelPath, err)
+		}
+		funcCalls, templateNames := tmpl.FuncCalls()
+		visited := chezmoiset.New[string]()
+		for _, funcCall := range slices.Clone(funcCalls) {
+			if funcCall.Name == "includeTemplate" && funcCall.Literal && len(funcCall.Args) > 0 {
+				funcCalls = addNamedTemplate(funcCalls, funcCall.Args[0], visited)
+			}
+		}
+		for _, templateName := range templateNames {
+			funcCalls = addNamedTemplate(funcCalls, templateName, visited)
+		}
+		if len(funcCalls) > 0 {
+			result[targetRelPath] = funcCalls
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
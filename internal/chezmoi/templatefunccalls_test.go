@@ -0,0 +1,85 @@
+package chezmoi
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestTemplateFuncCalls(t *testing.T) {
+	funcs := template.FuncMap{
+		"keepassxc": func(string) map[string]string { return nil },
+		"list":      func() []string { return nil },
+		"pass":      func(string) string { return "" },
+		"printf":    func(string, ...any) string { return "" },
+		"trim":      func(string) string { return "" },
+		"vault":     func(string) any { return nil },
+	}
+
+	for _, tc := range []struct {
+		name                  string
+		text                  string
+		expectedFuncCalls     []TemplateFuncCall
+		expectedTemplateNames []string
+	}{
+		{
+			name: "empty",
+			text: "contents",
+		},
+		{
+			name: "call",
+			text: `{{ pass "key" }}`,
+			expectedFuncCalls: []TemplateFuncCall{
+				{Name: "pass", Args: []string{"key"}, Literal: true},
+			},
+		},
+		{
+			name: "pipe",
+			text: `{{ "key" | pass | trim }}`,
+			expectedFuncCalls: []TemplateFuncCall{
+				{Name: "pass", Args: []string{"key"}, Literal: true},
+				{Name: "trim", Args: []string{}, Literal: true},
+			},
+		},
+		{
+			name: "field",
+			text: `{{ (keepassxc "entry").Password }}`,
+			expectedFuncCalls: []TemplateFuncCall{
+				{Name: "keepassxc", Args: []string{"entry"}, Literal: true},
+			},
+		},
+		{
+			name: "not_literal",
+			text: `{{ pass (printf "%s/key" .prefix) }}`,
+			expectedFuncCalls: []TemplateFuncCall{
+				{Name: "printf", Args: []string{"%s/key", ".prefix"}, Literal: false},
+				{Name: "pass", Args: []string{`printf "%s/key" .prefix`}, Literal: false},
+			},
+		},
+		{
+			name: "branches",
+			text: `{{ if true }}{{ pass "a" }}{{ else }}{{ range $x := list }}{{ vault "b" }}{{ end }}{{ end }}`,
+			expectedFuncCalls: []TemplateFuncCall{
+				{Name: "pass", Args: []string{"a"}, Literal: true},
+				{Name: "list", Args: []string{}, Literal: true},
+				{Name: "vault", Args: []string{"b"}, Literal: true},
+			},
+		},
+		{
+			name:                  "template",
+			text:                  `{{ template "name" . }}`,
+			expectedTemplateNames: []string{"name"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate(tc.name, []byte(tc.text), TemplateOptions{
+				Funcs: funcs,
+			})
+			assert.NoError(t, err)
+			actualFuncCalls, actualTemplateNames := tmpl.FuncCalls()
+			assert.Equal(t, tc.expectedFuncCalls, actualFuncCalls)
+			assert.Equal(t, tc.expectedTemplateNames, actualTemplateNames)
+		})
+	}
+}
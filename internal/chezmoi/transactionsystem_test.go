@@ -0,0 +1,165 @@
+package chezmoi
+
+import (
+	"io/fs"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/twpayne/go-vfs/v5"
+	"github.com/twpayne/go-vfs/v5/vfst"
+
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+var _ System = &TransactionSystem{}
+
+func TestTransactionSystem(t *testing.T) {
+	chezmoitest.WithTestFS(t, map[string]any{
+		"/home/user": map[string]any{
+			".dir": map[string]any{
+				"file": "# contents of .dir/file\n",
+			},
+			".file":    "# contents of .file\n",
+			".symlink": &vfst.Symlink{Target: ".file"},
+		},
+	}, func(fileSystem vfs.FS) {
+		system := NewRealSystem(fileSystem)
+		transactionSystem := NewTransactionSystem(system)
+
+		stage := func() {
+			assert.NoError(t, transactionSystem.WriteFile(NewAbsPath("/home/user/.file"), []byte("# new contents of .file\n"), 0o666))
+			assert.NoError(t, transactionSystem.RemoveAll(NewAbsPath("/home/user/.dir")))
+			assert.NoError(t, transactionSystem.WriteSymlink(".dir", NewAbsPath("/home/user/.symlink")))
+			assert.NoError(t, transactionSystem.Mkdir(NewAbsPath("/home/user/.newdir"), 0o777))
+			assert.NoError(t, transactionSystem.WriteFile(NewAbsPath("/home/user/.newdir/file"), []byte("# contents of .newdir/file\n"), 0o666))
+		}
+
+		unchanged := []vfst.Test{
+			vfst.TestPath("/home/user/.dir/file",
+				vfst.TestContentsString("# contents of .dir/file\n"),
+			),
+			vfst.TestPath("/home/user/.file",
+				vfst.TestContentsString("# contents of .file\n"),
+			),
+			vfst.TestPath("/home/user/.newdir",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.symlink",
+				vfst.TestModeType(fs.ModeSymlink),
+				vfst.TestSymlinkTarget(".file"),
+			),
+		}
+		assertNoTempFiles := func() {
+			dirEntries, err := system.ReadDir(NewAbsPath("/home/user"))
+			assert.NoError(t, err)
+			names := make([]string, 0, len(dirEntries))
+			for _, dirEntry := range dirEntries {
+				names = append(names, dirEntry.Name())
+			}
+			assert.Equal(t, []string{".dir", ".file", ".symlink"}, names)
+		}
+		// failCommit stages a directory, creates a file in its place, and
+		// checks that the commit fails.
+		failCommit := func() {
+			assert.NoError(t, transactionSystem.Mkdir(NewAbsPath("/home/user/.conflict"), 0o777))
+			assert.NoError(t, system.WriteFile(NewAbsPath("/home/user/.conflict"), nil, 0o666))
+			assert.Error(t, transactionSystem.Commit())
+			assert.NoError(t, system.Remove(NewAbsPath("/home/user/.conflict")))
+		}
+
+		// Test that reads reflect staged changes.
+		stage()
+		assert.NoError(t, transactionSystem.Chmod(NewAbsPath("/home/user/.file"), 0o700))
+		contents, err := transactionSystem.ReadFile(NewAbsPath("/home/user/.file"))
+		assert.NoError(t, err)
+		assert.Equal(t, "# new contents of .file\n", string(contents))
+		fileInfo, err := transactionSystem.Lstat(NewAbsPath("/home/user/.file"))
+		assert.NoError(t, err)
+		assert.Equal(t, ".file", fileInfo.Name())
+		if runtime.GOOS != "windows" {
+			assert.Equal(t, fs.FileMode(0o700), fileInfo.Mode())
+		}
+		_, err = transactionSystem.Lstat(NewAbsPath("/home/user/.dir/file"))
+		assert.IsError(t, err, fs.ErrNotExist)
+		linkname, err := transactionSystem.Readlink(NewAbsPath("/home/user/.symlink"))
+		assert.NoError(t, err)
+		assert.Equal(t, ".dir", linkname)
+		fileInfo, err = transactionSystem.Lstat(NewAbsPath("/home/user/.newdir"))
+		assert.NoError(t, err)
+		assert.True(t, fileInfo.IsDir())
+		contents, err = transactionSystem.ReadFile(NewAbsPath("/home/user/.newdir/file"))
+		assert.NoError(t, err)
+		assert.Equal(t, "# contents of .newdir/file\n", string(contents))
+		dirEntries, err := transactionSystem.ReadDir(NewAbsPath("/home/user"))
+		assert.NoError(t, err)
+		names := make([]string, 0, len(dirEntries))
+		for _, dirEntry := range dirEntries {
+			names = append(names, dirEntry.Name())
+		}
+		assert.Equal(t, []string{".file", ".newdir", ".symlink"}, names)
+		matches, err := transactionSystem.Glob("/home/user/.newdir/*")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/home/user/.newdir/file"}, matches)
+		assert.NoError(t, transactionSystem.Abort())
+
+		// Test that directories can only be created in existing directories.
+		assert.IsError(t, transactionSystem.Mkdir(NewAbsPath("/home/user/.missing/dir"), 0o777), fs.ErrNotExist)
+		assert.IsError(t, transactionSystem.Mkdir(NewAbsPath("/home/user/.file"), 0o777), fs.ErrExist)
+		assert.NoError(t, MkdirAll(transactionSystem, NewAbsPath("/home/user/.newdir/dir/subdir"), 0o777))
+		fileInfo, err = transactionSystem.Lstat(NewAbsPath("/home/user/.newdir/dir/subdir"))
+		assert.NoError(t, err)
+		assert.True(t, fileInfo.IsDir())
+		assert.NoError(t, transactionSystem.Abort())
+
+		// Test that aborted changes are not made.
+		stage()
+		vfst.RunTests(t, fileSystem, "", unchanged)
+		assert.NoError(t, transactionSystem.Abort())
+		vfst.RunTests(t, fileSystem, "", unchanged)
+		assertNoTempFiles()
+
+		// Test that changes already made are reverted if any change fails.
+		stage()
+		failCommit()
+		vfst.RunTests(t, fileSystem, "", unchanged)
+		assertNoTempFiles()
+
+		// Test that changes to times are reverted if any change fails.
+		fileInfo, err = system.Lstat(NewAbsPath("/home/user/.file"))
+		assert.NoError(t, err)
+		modTime := fileInfo.ModTime()
+		newModTime := modTime.Add(-time.Hour)
+		assert.NoError(t, transactionSystem.Chtimes(NewAbsPath("/home/user/.file"), newModTime, newModTime))
+		fileInfo, err = transactionSystem.Lstat(NewAbsPath("/home/user/.file"))
+		assert.NoError(t, err)
+		assert.Equal(t, newModTime, fileInfo.ModTime())
+		failCommit()
+		fileInfo, err = system.Lstat(NewAbsPath("/home/user/.file"))
+		assert.NoError(t, err)
+		assert.Equal(t, modTime, fileInfo.ModTime())
+
+		// Test that committed changes are made.
+		stage()
+		assert.NoError(t, transactionSystem.Commit())
+		vfst.RunTests(t, fileSystem, "",
+			vfst.TestPath("/home/user/.dir",
+				vfst.TestDoesNotExist(),
+			),
+			vfst.TestPath("/home/user/.file",
+				vfst.TestContentsString("# new contents of .file\n"),
+			),
+			vfst.TestPath("/home/user/.newdir/file",
+				vfst.TestContentsString("# contents of .newdir/file\n"),
+			),
+			vfst.TestPath("/home/user/.symlink",
+				vfst.TestModeType(fs.ModeSymlink),
+				vfst.TestSymlinkTarget(".dir"),
+			),
+		)
+		dirEntries, err = system.ReadDir(NewAbsPath("/home/user"))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(dirEntries))
+	})
+}
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"slices"
 
 	"github.com/spf13/cobra"
 
@@ -23,18 +25,21 @@ var severityValues = []string{
 }
 
 type addCmdConfig struct {
-	Encrypt          bool        `json:"encrypt"          mapstructure:"encrypt"          yaml:"encrypt"`
-	Secrets          *choiceFlag `json:"secrets"          mapstructure:"secrets"          yaml:"secrets"`
-	TemplateSymlinks bool        `json:"templateSymlinks" mapstructure:"templateSymlinks" yaml:"templateSymlinks"`
-	autoTemplate     bool
-	create           bool
-	exact            bool
-	filter           *chezmoi.EntryTypeFilter
-	follow           bool
-	prompt           bool
-	quiet            bool
-	recursive        bool
-	template         bool
+	Encrypt            bool        `json:"encrypt"            mapstructure:"encrypt"            yaml:"encrypt"`
+	Secrets            *choiceFlag `json:"secrets"            mapstructure:"secrets"            yaml:"secrets"`
+	StoreSecrets       string      `json:"storeSecrets"       mapstructure:"storeSecrets"       yaml:"storeSecrets"`
+	StoreSecretsPrefix string      `json:"storeSecretsPrefix" mapstructure:"storeSecretsPrefix" yaml:"storeSecretsPrefix"`
+	TemplateSymlinks   bool        `json:"templateSymlinks"   mapstructure:"templateSymlinks"   yaml:"templateSymlinks"`
+	autoTemplate       bool
+	create             bool
+	encryptSecrets     bool
+	exact              bool
+	filter             *chezmoi.EntryTypeFilter
+	follow             bool
+	prompt             bool
+	quiet              bool
+	recursive          bool
+	template           bool
 }
 
 func (c *Config) newAddCmd() *cobra.Command {
@@ -58,6 +63,8 @@ func (c *Config) newAddCmd() *cobra.Command {
 		BoolVarP(&c.Add.autoTemplate, "autotemplate", "a", c.Add.autoTemplate, "Generate the template when adding files as templates")
 	addCmd.Flags().BoolVar(&c.Add.create, "create", c.Add.create, "Add files that should exist, irrespective of their contents")
 	addCmd.Flags().BoolVar(&c.Add.Encrypt, "encrypt", c.Add.Encrypt, "Encrypt files")
+	addCmd.Flags().
+		BoolVar(&c.Add.encryptSecrets, "encrypt-secrets", c.Add.encryptSecrets, "Replace secrets with inline encrypted values")
 	addCmd.Flags().BoolVar(&c.Add.exact, "exact", c.Add.exact, "Add directories exactly")
 	addCmd.Flags().VarP(c.Add.filter.Exclude, "exclude", "x", "Exclude entry types")
 	addCmd.Flags().BoolVarP(&c.Add.follow, "follow", "f", c.Add.follow, "Add symlink targets instead of symlinks")
@@ -67,6 +74,9 @@ func (c *Config) newAddCmd() *cobra.Command {
 	addCmd.Flags().BoolVarP(&c.Add.recursive, "recursive", "r", c.Add.recursive, "Recurse into subdirectories")
 	addCmd.Flags().Var(c.Add.Secrets, "secrets", "Scan for secrets when adding unencrypted files")
 	must(addCmd.RegisterFlagCompletionFunc("secrets", c.Add.Secrets.FlagCompletionFunc()))
+	addCmd.Flags().
+		StringVar(&c.Add.StoreSecrets, "store-secrets", c.Add.StoreSecrets, "Store secrets in a password manager")
+	must(addCmd.RegisterFlagCompletionFunc("store-secrets", chezmoi.FlagCompletionFunc(storeSecretsValues)))
 	addCmd.Flags().BoolVarP(&c.Add.template, "template", "T", c.Add.template, "Add files as templates")
 	addCmd.Flags().
 		BoolVar(&c.Add.TemplateSymlinks, "template-symlinks", c.Add.TemplateSymlinks, "Add symlinks with target in source or home dirs as templates")
@@ -81,8 +91,10 @@ func (c *Config) defaultOnIgnoreFunc(targetRelPath chezmoi.RelPath) {
 }
 
 func (c *Config) defaultPreAddFunc(targetRelPath chezmoi.RelPath, fileInfo fs.FileInfo) error {
-	// Scan unencrypted files for secrets, if configured.
-	if c.Add.Secrets.String() != severityIgnore && fileInfo.Mode().Type() == 0 && !c.Add.Encrypt {
+	// Scan unencrypted files for secrets, if configured. Secrets are replaced
+	// later if --encrypt-secrets or --store-secrets is set.
+	if c.Add.Secrets.String() != severityIgnore && fileInfo.Mode().Type() == 0 && !c.Add.Encrypt &&
+		!c.Add.encryptSecrets && c.Add.StoreSecrets == storeSecretsNone {
 		absPath := c.DestDirAbsPath.Join(targetRelPath)
 		content, err := c.destSystem.ReadFile(absPath)
 		if err != nil {
@@ -125,6 +137,29 @@ func (c *Config) defaultPreAddFunc(targetRelPath chezmoi.RelPath, fileInfo fs.Fi
 	}
 }
 
+// encryptSecret returns a template action that evaluates to secret, encrypted
+// inline.
+func (c *Config) encryptSecret(targetRelPath chezmoi.RelPath, secret chezmoi.Secret) (string, error) {
+	return chezmoi.EncryptInline(c.encryption, []byte(secret.Value))
+}
+
+// findSecrets returns the secrets in contents found by gitleaks.
+func (c *Config) findSecrets(contents []byte) ([]chezmoi.Secret, error) {
+	gitleaksDetector, err := c.getGitleaksDetector()
+	if err != nil {
+		return nil, err
+	}
+	findings := gitleaksDetector.DetectBytes(contents)
+	secrets := make([]chezmoi.Secret, 0, len(findings))
+	for _, finding := range findings {
+		secrets = append(secrets, chezmoi.Secret{
+			Name:  finding.RuleID,
+			Value: finding.Secret,
+		})
+	}
+	return secrets, nil
+}
+
 // defaultReplaceFunc prompts the user for confirmation if the adding the entry
 // would remove any of the encrypted, private, or template attributes.
 func (c *Config) defaultReplaceFunc(
@@ -185,6 +220,18 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezm
 		return fmt.Errorf("%s: invalid severity", severity)
 	}
 
+	var replaceSecretFunc chezmoi.ReplaceSecretFunc
+	switch {
+	case c.Add.encryptSecrets && c.Add.StoreSecrets != storeSecretsNone:
+		return errors.New("--encrypt-secrets and --store-secrets are mutually exclusive")
+	case c.Add.encryptSecrets:
+		replaceSecretFunc = c.encryptSecret
+	case slices.Contains(storeSecretsValues, c.Add.StoreSecrets):
+		replaceSecretFunc = c.storeSecret
+	case c.Add.StoreSecrets != storeSecretsNone:
+		return fmt.Errorf("%s: invalid password manager", c.Add.StoreSecrets)
+	}
+
 	destAbsPathInfos, err := c.destAbsPathInfos(sourceState, args, destAbsPathInfosOptions{
 		follow:       c.Mode == chezmoi.ModeSymlink || c.Add.follow,
 		onIgnoreFunc: c.defaultOnIgnoreFunc,
@@ -233,9 +280,11 @@ func (c *Config) runAddCmd(cmd *cobra.Command, args []string, sourceState *chezm
 				c.sourceDirAbsPath,
 				chezmoi.NewAbsPath(executable),
 			},
-			ReplaceFunc:      c.defaultReplaceFunc,
-			Template:         c.Add.template,
-			TemplateSymlinks: c.Add.TemplateSymlinks,
+			ReplaceFunc:       c.defaultReplaceFunc,
+			ReplaceSecretFunc: replaceSecretFunc,
+			SecretsFunc:       c.findSecrets,
+			Template:          c.Add.template,
+			TemplateSymlinks:  c.Add.TemplateSymlinks,
 		},
 	)
 }
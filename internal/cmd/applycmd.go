@@ -1,16 +1,43 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/spf13/cobra"
 
 	"github.com/twpayne/chezmoi/internal/chezmoi"
 )
 
+const (
+	onConflictFail      = "fail"
+	onConflictKeep      = "keep"
+	onConflictMerge     = "merge"
+	onConflictOverwrite = "overwrite"
+)
+
+var onConflictValues = []string{
+	"",
+	onConflictFail,
+	onConflictKeep,
+	onConflictMerge,
+	onConflictOverwrite,
+}
+
 type applyCmdConfig struct {
-	filter     *chezmoi.EntryTypeFilter
-	init       bool
-	parentDirs bool
-	recursive  bool
+	atomic      bool
+	filter      *chezmoi.EntryTypeFilter
+	init        bool
+	onConflict  *choiceFlag
+	parentDirs  bool
+	patch       bool
+	plan        chezmoi.AbsPath
+	recursive   bool
+	retryFailed bool
 }
 
 func (c *Config) newApplyCmd() *cobra.Command {
@@ -28,23 +55,251 @@ func (c *Config) newApplyCmd() *cobra.Command {
 		),
 	}
 
+	applyCmd.Flags().BoolVar(&c.apply.atomic, "atomic", c.apply.atomic, "Apply all changes or none")
+	applyCmd.Flags().IntVar(&c.eventsFD, "events-fd", c.eventsFD, "Write JSON events to file descriptor")
 	applyCmd.Flags().VarP(c.apply.filter.Exclude, "exclude", "x", "Exclude entry types")
 	applyCmd.Flags().VarP(c.apply.filter.Include, "include", "i", "Include entry types")
 	applyCmd.Flags().BoolVar(&c.apply.init, "init", c.apply.init, "Recreate config file from template")
+	applyCmd.Flags().Var(c.apply.onConflict, "on-conflict", "Resolve conflicts with fail, keep, merge, or overwrite")
+	must(applyCmd.RegisterFlagCompletionFunc("on-conflict", c.apply.onConflict.FlagCompletionFunc()))
 	applyCmd.Flags().BoolVarP(&c.apply.parentDirs, "parent-dirs", "P", c.apply.parentDirs, "Apply all parent directories")
+	applyCmd.Flags().BoolVarP(&c.apply.patch, "patch", "p", c.apply.patch, "Choose changes to apply hunk by hunk")
+	applyCmd.Flags().Var(&c.apply.plan, "plan", "Apply the changes in a plan file")
 	applyCmd.Flags().BoolVarP(&c.apply.recursive, "recursive", "r", c.apply.recursive, "Recurse into subdirectories")
+	applyCmd.Flags().BoolVar(&c.apply.retryFailed, "retry-failed", c.apply.retryFailed, "Only apply targets that failed in the last apply")
 
 	return applyCmd
 }
 
 func (c *Config) runApplyCmd(cmd *cobra.Command, args []string) error {
+	if !c.apply.plan.IsEmpty() && c.apply.retryFailed {
+		return errors.New("--plan and --retry-failed are mutually exclusive")
+	}
+	if !c.apply.plan.IsEmpty() {
+		return c.runApplyPlan(cmd, args, c.apply.plan)
+	}
+	if c.apply.retryFailed {
+		return c.runApplyRetryFailed(cmd, args)
+	}
 	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
 		cmd:          cmd,
 		filter:       c.apply.filter,
 		init:         c.apply.init,
+		packages:     true,
 		parentDirs:   c.apply.parentDirs,
 		recursive:    c.apply.recursive,
 		umask:        c.Umask,
+		patchFunc:    c.applyPatchFunc(),
+		preApplyFunc: c.defaultPreApplyFunc,
+	})
+}
+
+// runApplyRetryFailed applies only the targets that failed in the last apply.
+// Records of targets that are no longer in the source state are removed.
+func (c *Config) runApplyRetryFailed(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errors.New("cannot specify targets with --retry-failed")
+	}
+	failedTargetAbsPaths, err := c.failedTargetAbsPaths()
+	if err != nil {
+		return err
+	}
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return err
+	}
+	var targetAbsPaths []string
+	for targetAbsPath := range failedTargetAbsPaths {
+		if targetRelPath, err := targetAbsPath.TrimDirPrefix(c.DestDirAbsPath); err == nil &&
+			sourceState.Get(targetRelPath) != nil {
+			targetAbsPaths = append(targetAbsPaths, targetAbsPath.String())
+			continue
+		}
+		if err := c.persistentState.Delete(chezmoi.FailedTargetStateBucket, targetAbsPath.Bytes()); err != nil {
+			return err
+		}
+	}
+	if len(targetAbsPaths) == 0 {
+		return nil
+	}
+	slices.Sort(targetAbsPaths)
+	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, targetAbsPaths, applyArgsOptions{
+		cmd:          cmd,
+		filter:       c.apply.filter,
+		init:         c.apply.init,
+		umask:        c.Umask,
+		patchFunc:    c.applyPatchFunc(),
 		preApplyFunc: c.defaultPreApplyFunc,
 	})
 }
+
+// isBeforeScript returns if sourceStateEntry is a run_before_ script.
+func isBeforeScript(sourceStateEntry chezmoi.SourceStateEntry) bool {
+	sourceStateFile, ok := sourceStateEntry.(*chezmoi.SourceStateFile)
+	return ok && sourceStateFile.Attr.Type == chezmoi.SourceFileTypeScript &&
+		sourceStateFile.Attr.Order == chezmoi.ScriptOrderBefore
+}
+
+// runsAfterCommit returns if sourceStateEntry is run after all other changes
+// are committed in an atomic apply.
+func runsAfterCommit(sourceStateEntry chezmoi.SourceStateEntry) bool {
+	switch sourceStateEntry := sourceStateEntry.(type) {
+	case *chezmoi.SourceStateCommand:
+		return true
+	case *chezmoi.SourceStateFile:
+		return sourceStateEntry.Attr.Type == chezmoi.SourceFileTypeScript &&
+			sourceStateEntry.Attr.Order != chezmoi.ScriptOrderBefore
+	default:
+		return false
+	}
+}
+
+// isConflict returns if both the actual state and the target state have
+// changed since chezmoi last wrote the target.
+func isConflict(targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState) bool {
+	switch {
+	case lastWrittenEntryState == nil:
+		return false
+	case targetEntryState.Type == chezmoi.EntryStateTypeScript:
+		return false
+	case targetEntryState.Overwrite():
+		return false
+	case lastWrittenEntryState.Equivalent(actualEntryState):
+		return false
+	case lastWrittenEntryState.Equivalent(targetEntryState):
+		return false
+	default:
+		return !targetEntryState.Equivalent(actualEntryState)
+	}
+}
+
+// applyPatchFunc returns the chezmoi.PatchFunc that chooses the changes to
+// apply hunk by hunk, or nil if --patch is not set.
+func (c *Config) applyPatchFunc() chezmoi.PatchFunc {
+	if !c.apply.patch {
+		return nil
+	}
+	return c.applyPatch
+}
+
+// applyPatch prompts the user to choose which hunks of the changes to the file
+// at targetRelPath to apply, and optionally writes the result back to the
+// source state so that rejected hunks are kept. It returns the contents to
+// apply, or nil if all hunks are accepted.
+func (c *Config) applyPatch(
+	targetRelPath chezmoi.RelPath,
+	targetEntryState, actualEntryState *chezmoi.EntryState,
+) ([]byte, error) {
+	actualContents := actualEntryState.Contents()
+	actualLines := chezmoi.SplitLines(string(actualContents))
+	hunks := chezmoi.DiffHunks(actualContents, targetEntryState.Contents())
+
+	acceptedHunks := make([]chezmoi.Hunk, 0, len(hunks))
+	allAccepted := true
+	offset := 0
+HUNK:
+	for i, hunk := range hunks {
+		if _, err := c.stdout.Write([]byte(formatHunk(actualLines, hunk, offset))); err != nil {
+			return nil, err
+		}
+		offset += len(hunk.Lines) - (hunk.End - hunk.Start)
+		prompt := fmt.Sprintf("Apply this hunk (%d/%d) to %s", i+1, len(hunks), targetRelPath)
+		switch choice, err := c.promptChoice(prompt, []string{"yes", "no", "edit", "all", "skip", "quit"}); {
+		case err != nil:
+			return nil, err
+		case choice == "yes":
+			acceptedHunks = append(acceptedHunks, hunk)
+		case choice == "no":
+			allAccepted = false
+		case choice == "edit":
+			if hunk.Lines, err = c.editHunk(hunk); err != nil {
+				return nil, err
+			}
+			acceptedHunks = append(acceptedHunks, hunk)
+			allAccepted = false
+		case choice == "all":
+			acceptedHunks = append(acceptedHunks, hunks[i:]...)
+			break HUNK
+		case choice == "skip":
+			allAccepted = false
+			break HUNK
+		case choice == "quit":
+			return nil, chezmoi.ExitCodeError(0)
+		default:
+			panic(choice + ": unexpected choice")
+		}
+	}
+	if allAccepted {
+		return nil, nil
+	}
+
+	contents := chezmoi.ApplyHunks(actualContents, acceptedHunks)
+
+	// Offer to write the result back to the source state, so that rejected
+	// hunks are not offered again.
+	if sourceStateFile, ok := c.sourceState.MustEntry(targetRelPath).(*chezmoi.SourceStateFile); ok &&
+		sourceStateFile.Attr.Type == chezmoi.SourceFileTypeFile && !sourceStateFile.Attr.Template {
+		prompt := fmt.Sprintf("Re-add rejected changes to %s to the source state", targetRelPath)
+		switch choice, err := c.promptChoice(prompt, []string{"yes", "no"}); {
+		case err != nil:
+			return nil, err
+		case choice == "yes":
+			if err := c.writeSourceFileContents(targetRelPath, sourceStateFile, contents); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(acceptedHunks) == 0 {
+		return nil, fs.SkipDir
+	}
+	return contents, nil
+}
+
+// editHunk opens hunk's new lines in the user's editor and returns the edited
+// lines.
+func (c *Config) editHunk(hunk chezmoi.Hunk) ([]string, error) {
+	tempDirAbsPath, err := c.tempDir("chezmoi-patch")
+	if err != nil {
+		return nil, err
+	}
+	hunkAbsPath := tempDirAbsPath.JoinString("hunk")
+	if err := c.baseSystem.WriteFile(hunkAbsPath, []byte(strings.Join(hunk.Lines, "")), 0o600); err != nil {
+		return nil, err
+	}
+	if err := c.runEditor([]string{hunkAbsPath.String()}); err != nil {
+		return nil, err
+	}
+	data, err := c.baseSystem.ReadFile(hunkAbsPath)
+	if err != nil {
+		return nil, err
+	}
+	return chezmoi.SplitLines(string(data)), nil
+}
+
+// formatHunk returns hunk, which applies to lines, formatted as a unified diff
+// hunk with context. offset is the difference between line numbers in the old
+// and new files at the start of the hunk.
+func formatHunk(lines []string, hunk chezmoi.Hunk, offset int) string {
+	contextStart := max(hunk.Start-diff.DefaultContextLines, 0)
+	contextEnd := min(hunk.End+diff.DefaultContextLines, len(lines))
+	fromLen := contextEnd - contextStart
+	toLen := fromLen - (hunk.End - hunk.Start) + len(hunk.Lines)
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "@@ -%d,%d +%d,%d @@\n", contextStart+1, fromLen, contextStart+1+offset, toLen)
+	writeHunkLines := func(prefix string, lines []string) {
+		for _, line := range lines {
+			builder.WriteString(prefix)
+			builder.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				builder.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	writeHunkLines(" ", lines[contextStart:hunk.Start])
+	writeHunkLines("-", lines[hunk.Start:hunk.End])
+	writeHunkLines("+", hunk.Lines)
+	writeHunkLines(" ", lines[hunk.End:contextEnd])
+	return builder.String()
+}
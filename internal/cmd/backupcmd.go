@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+	"github.com/twpayne/chezmoi/internal/chezmoierrors"
+)
+
+var backupDirRelPath = chezmoi.NewRelPath("backup")
+
+type backupConfig struct {
+	Enabled        bool          `json:"enabled"        mapstructure:"enabled"        yaml:"enabled"`
+	MaxAge         time.Duration `json:"maxAge"         mapstructure:"maxAge"         yaml:"maxAge"`
+	MaxCount       int           `json:"maxCount"       mapstructure:"maxCount"       yaml:"maxCount"`
+	MaxGenerations int           `json:"maxGenerations" mapstructure:"maxGenerations" yaml:"maxGenerations"`
+}
+
+func (c *Config) newBackupCmd() *cobra.Command {
+	backupCmd := &cobra.Command{
+		Use:     "backup",
+		Short:   "Manage backups of overwritten and removed targets",
+		Long:    mustLongHelp("backup"),
+		Example: example("backup"),
+		Annotations: newAnnotations(
+			persistentStateModeNone,
+		),
+	}
+
+	backupListCmd := &cobra.Command{
+		Use:               "list [target...]",
+		Short:             "List backups",
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runBackupListCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+	backupCmd.AddCommand(backupListCmd)
+
+	backupShowCmd := &cobra.Command{
+		Use:   "show id",
+		Short: "Print the contents of a backup",
+		Args:  cobra.ExactArgs(1),
+		RunE:  c.runBackupShowCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+	backupCmd.AddCommand(backupShowCmd)
+
+	backupRestoreCmd := &cobra.Command{
+		Use:               "restore id|target...",
+		Short:             "Restore backups",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runBackupRestoreCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeReadWrite,
+		),
+	}
+	backupCmd.AddCommand(backupRestoreCmd)
+
+	backupPruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove old backups",
+		Args:  cobra.NoArgs,
+		RunE:  c.runBackupPruneCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+		),
+	}
+	backupPruneCmd.Flags().DurationVar(&c.Backup.MaxAge, "max-age", c.Backup.MaxAge, "Remove backups older than max age")
+	backupPruneCmd.Flags().IntVar(&c.Backup.MaxCount, "max-count", c.Backup.MaxCount, "Maximum number of backups per target")
+	backupPruneCmd.Flags().IntVar(&c.Backup.MaxGenerations, "max-generations", c.Backup.MaxGenerations, "Maximum number of generations")
+	backupCmd.AddCommand(backupPruneCmd)
+
+	return backupCmd
+}
+
+func (c *Config) runBackupListCmd(cmd *cobra.Command, args []string) error {
+	targetAbsPaths, err := c.backupTargetAbsPaths(args)
+	if err != nil {
+		return err
+	}
+
+	backups, err := c.newBackupStore().Backups()
+	if err != nil {
+		return err
+	}
+
+	var builder strings.Builder
+	for _, backup := range backups {
+		if len(targetAbsPaths) != 0 && !targetAbsPaths[backup.TargetAbsPath] {
+			continue
+		}
+		fmt.Fprintf(&builder, "%s %s %s %s\n",
+			backup.ID, backup.Time.Local().Format(time.RFC3339), backup.Type, c.targetName(backup.TargetAbsPath))
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runBackupPruneCmd(cmd *cobra.Command, args []string) error {
+	return c.pruneBackups()
+}
+
+func (c *Config) runBackupRestoreCmd(cmd *cobra.Command, args []string) error {
+	backupStore := c.newBackupStore()
+
+	backups := make([]*chezmoi.Backup, 0, len(args))
+	for _, arg := range args {
+		if backup, err := backupStore.Get(arg); err == nil {
+			backups = append(backups, backup)
+			continue
+		}
+		targetAbsPath, err := chezmoi.NewAbsPathFromExtPath(arg, c.homeDirAbsPath)
+		if err != nil {
+			return err
+		}
+		switch backup, err := backupStore.Latest(targetAbsPath); {
+		case err != nil:
+			return err
+		case backup == nil:
+			return fmt.Errorf("%s: backup not found", arg)
+		default:
+			backups = append(backups, backup)
+		}
+	}
+
+	// Back up the current targets so that restores can be undone. Restore as
+	// many backups as possible, even if the contents of some are no longer
+	// available.
+	backupSystem := chezmoi.NewBackupSystem(c.destSystem, backupStore)
+	var errs []error
+	for _, backup := range backups {
+		if err := backupStore.Restore(backupSystem, backup); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return chezmoierrors.Combine(errs...)
+}
+
+func (c *Config) runBackupShowCmd(cmd *cobra.Command, args []string) error {
+	backupStore := c.newBackupStore()
+	backup, err := backupStore.Get(args[0])
+	if err != nil {
+		return err
+	}
+	switch backup.Type {
+	case chezmoi.EntryStateTypeFile:
+		contents, err := backupStore.Contents(backup)
+		if err != nil {
+			return err
+		}
+		return c.writeOutput(contents)
+	case chezmoi.EntryStateTypeSymlink:
+		return c.writeOutputString(backup.Linkname + "\n")
+	default:
+		return fmt.Errorf("%s: %s is a directory", backup.ID, c.targetName(backup.TargetAbsPath))
+	}
+}
+
+// backupTargetAbsPaths returns the absolute paths of args.
+func (c *Config) backupTargetAbsPaths(args []string) (map[chezmoi.AbsPath]bool, error) {
+	targetAbsPaths := make(map[chezmoi.AbsPath]bool, len(args))
+	for _, arg := range args {
+		targetAbsPath, err := chezmoi.NewAbsPathFromExtPath(arg, c.homeDirAbsPath)
+		if err != nil {
+			return nil, err
+		}
+		targetAbsPaths[targetAbsPath] = true
+	}
+	return targetAbsPaths, nil
+}
+
+// pruneBackups removes backups and generations older than c.Backup.MaxAge, all
+// but the most recent c.Backup.MaxCount backups of each target, and all but the
+// most recent c.Backup.MaxGenerations generations.
+func (c *Config) pruneBackups() error {
+	now := time.Now()
+	prunedGenerations, err := chezmoi.PruneGenerations(c.persistentState, chezmoi.PruneGenerationsOptions{
+		MaxAge:   c.Backup.MaxAge,
+		MaxCount: c.Backup.MaxGenerations,
+		Now:      now,
+	})
+	if err != nil {
+		return err
+	}
+	// Prune backups after generations so that contents only referenced by
+	// pruned generations are removed.
+	prunedBackups, err := c.newBackupStore().Prune(chezmoi.PruneBackupsOptions{
+		MaxAge:   c.Backup.MaxAge,
+		MaxCount: c.Backup.MaxCount,
+		Now:      now,
+	})
+	if err != nil {
+		return err
+	}
+	if c.Verbose {
+		for _, generation := range prunedGenerations {
+			c.errorf("removed generation %d\n", generation.Number)
+		}
+		for _, backup := range prunedBackups {
+			c.errorf("%s: removed backup of %s\n", backup.ID, c.targetName(backup.TargetAbsPath))
+		}
+	}
+	return nil
+}
+
+// newBackupStore returns a new BackupStore.
+func (c *Config) newBackupStore() *chezmoi.BackupStore {
+	system := c.baseSystem
+	if c.dryRun {
+		system = chezmoi.NewDryRunSystem(system)
+	}
+	return chezmoi.NewBackupStore(system, c.persistentState, c.CacheDirAbsPath.Join(backupDirRelPath))
+}
@@ -472,6 +472,7 @@ func (m *modifier) modifyFileAttr(fileAttr chezmoi.FileAttr) chezmoi.FileAttr {
 			Executable: m.executable.modify(fileAttr.Executable),
 			Private:    m.private.modify(fileAttr.Private),
 			ReadOnly:   m.readOnly.modify(fileAttr.ReadOnly),
+			SOPS:       fileAttr.SOPS,
 			Template:   m.template.modify(fileAttr.Template),
 		}
 	case chezmoi.SourceFileTypeModify:
@@ -492,6 +493,7 @@ func (m *modifier) modifyFileAttr(fileAttr chezmoi.FileAttr) chezmoi.FileAttr {
 			Executable: m.executable.modify(fileAttr.Executable),
 			Private:    m.private.modify(fileAttr.Private),
 			ReadOnly:   m.readOnly.modify(fileAttr.ReadOnly),
+			SOPS:       fileAttr.SOPS,
 			Template:   m.template.modify(fileAttr.Template),
 		}
 	case chezmoi.SourceFileTypeScript:
@@ -26,6 +26,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -78,9 +79,10 @@ type doPurgeOptions struct {
 }
 
 type commandConfig struct {
-	Command string   `json:"command" mapstructure:"command" yaml:"command"`
-	Script  string   `json:"script"  mapstructure:"script"  yaml:"script"`
-	Args    []string `json:"args"    mapstructure:"args"    yaml:"args"`
+	Command     string   `json:"command"     mapstructure:"command"     yaml:"command"`
+	Script      string   `json:"script"      mapstructure:"script"      yaml:"script"`
+	Args        []string `json:"args"        mapstructure:"args"        yaml:"args"`
+	PayloadFile bool     `json:"payloadFile" mapstructure:"payloadFile" yaml:"payloadFile"`
 }
 
 type hookConfig struct {
@@ -99,34 +101,40 @@ type warningsConfig struct {
 // ConfigFile contains all data settable in the config file.
 type ConfigFile struct {
 	// Global configuration.
-	CacheDirAbsPath        chezmoi.AbsPath                `json:"cacheDir"        mapstructure:"cacheDir"        yaml:"cacheDir"`
-	Color                  autoBool                       `json:"color"           mapstructure:"color"           yaml:"color"`
-	Data                   map[string]any                 `json:"data"            mapstructure:"data"            yaml:"data"`
-	Env                    map[string]string              `json:"env"             mapstructure:"env"             yaml:"env"`
-	Format                 *choiceFlag                    `json:"format"          mapstructure:"format"          yaml:"format"`
-	DestDirAbsPath         chezmoi.AbsPath                `json:"destDir"         mapstructure:"destDir"         yaml:"destDir"`
-	GitHub                 gitHubConfig                   `json:"gitHub"          mapstructure:"gitHub"          yaml:"gitHub"`
-	Hooks                  map[string]hookConfig          `json:"hooks"           mapstructure:"hooks"           yaml:"hooks"`
-	Interactive            bool                           `json:"interactive"     mapstructure:"interactive"     yaml:"interactive"`
-	Interpreters           map[string]chezmoi.Interpreter `json:"interpreters"    mapstructure:"interpreters"    yaml:"interpreters"`
-	Mode                   chezmoi.Mode                   `json:"mode"            mapstructure:"mode"            yaml:"mode"`
-	Pager                  string                         `json:"pager"           mapstructure:"pager"           yaml:"pager"`
-	PersistentStateAbsPath chezmoi.AbsPath                `json:"persistentState" mapstructure:"persistentState" yaml:"persistentState"`
-	PINEntry               pinEntryConfig                 `json:"pinentry"        mapstructure:"pinentry"        yaml:"pinentry"`
-	Progress               autoBool                       `json:"progress"        mapstructure:"progress"        yaml:"progress"`
-	Safe                   bool                           `json:"safe"            mapstructure:"safe"            yaml:"safe"`
-	ScriptEnv              map[string]string              `json:"scriptEnv"       mapstructure:"scriptEnv"       yaml:"scriptEnv"`
-	ScriptTempDir          chezmoi.AbsPath                `json:"scriptTempDir"   mapstructure:"scriptTempDir"   yaml:"scriptTempDir"`
-	SourceDirAbsPath       chezmoi.AbsPath                `json:"sourceDir"       mapstructure:"sourceDir"       yaml:"sourceDir"`
-	TempDir                chezmoi.AbsPath                `json:"tempDir"         mapstructure:"tempDir"         yaml:"tempDir"`
-	Template               templateConfig                 `json:"template"        mapstructure:"template"        yaml:"template"`
-	TextConv               textConv                       `json:"textConv"        mapstructure:"textConv"        yaml:"textConv"`
-	Umask                  fs.FileMode                    `json:"umask"           mapstructure:"umask"           yaml:"umask"`
-	UseBuiltinAge          autoBool                       `json:"useBuiltinAge"   mapstructure:"useBuiltinAge"   yaml:"useBuiltinAge"`
-	UseBuiltinGit          autoBool                       `json:"useBuiltinGit"   mapstructure:"useBuiltinGit"   yaml:"useBuiltinGit"`
-	Verbose                bool                           `json:"verbose"         mapstructure:"verbose"         yaml:"verbose"`
-	Warnings               warningsConfig                 `json:"warnings"        mapstructure:"warnings"        yaml:"warnings"`
-	WorkingTreeAbsPath     chezmoi.AbsPath                `json:"workingTree"     mapstructure:"workingTree"     yaml:"workingTree"`
+	Backup                 backupConfig                    `json:"backup"            mapstructure:"backup"            yaml:"backup"`
+	CacheDirAbsPath        chezmoi.AbsPath                 `json:"cacheDir"          mapstructure:"cacheDir"          yaml:"cacheDir"`
+	Color                  autoBool                        `json:"color"             mapstructure:"color"             yaml:"color"`
+	Data                   map[string]any                  `json:"data"              mapstructure:"data"              yaml:"data"`
+	Env                    map[string]string               `json:"env"               mapstructure:"env"               yaml:"env"`
+	Format                 *choiceFlag                     `json:"format"            mapstructure:"format"            yaml:"format"`
+	DestDirAbsPath         chezmoi.AbsPath                 `json:"destDir"           mapstructure:"destDir"           yaml:"destDir"`
+	GitHub                 gitHubConfig                    `json:"gitHub"            mapstructure:"gitHub"            yaml:"gitHub"`
+	Hooks                  map[string]hookConfig           `json:"hooks"             mapstructure:"hooks"             yaml:"hooks"`
+	Interactive            bool                            `json:"interactive"       mapstructure:"interactive"       yaml:"interactive"`
+	Interpreters           map[string]chezmoi.Interpreter  `json:"interpreters"      mapstructure:"interpreters"      yaml:"interpreters"`
+	Mode                   chezmoi.Mode                    `json:"mode"              mapstructure:"mode"              yaml:"mode"`
+	Packages               map[string]packageManagerConfig `json:"packages"          mapstructure:"packages"          yaml:"packages"`
+	Pager                  string                          `json:"pager"             mapstructure:"pager"             yaml:"pager"`
+	PersistentStateAbsPath chezmoi.AbsPath                 `json:"persistentState"   mapstructure:"persistentState"   yaml:"persistentState"`
+	PINEntry               pinEntryConfig                  `json:"pinentry"          mapstructure:"pinentry"          yaml:"pinentry"`
+	Progress               autoBool                        `json:"progress"          mapstructure:"progress"          yaml:"progress"`
+	Safe                   bool                            `json:"safe"              mapstructure:"safe"              yaml:"safe"`
+	ScriptEnv              map[string]string               `json:"scriptEnv"         mapstructure:"scriptEnv"         yaml:"scriptEnv"`
+	ScriptLog              scriptLogConfig                 `json:"scriptLog"         mapstructure:"scriptLog"         yaml:"scriptLog"`
+	ScriptParallelism      int                             `json:"scriptParallelism" mapstructure:"scriptParallelism" yaml:"scriptParallelism"`
+	ScriptTempDir          chezmoi.AbsPath                 `json:"scriptTempDir"     mapstructure:"scriptTempDir"     yaml:"scriptTempDir"`
+	SourceDirAbsPath       chezmoi.AbsPath                 `json:"sourceDir"         mapstructure:"sourceDir"         yaml:"sourceDir"`
+	TempDir                chezmoi.AbsPath                 `json:"tempDir"           mapstructure:"tempDir"           yaml:"tempDir"`
+	Template               templateConfig                  `json:"template"          mapstructure:"template"          yaml:"template"`
+	TextConv               textConv                        `json:"textConv"          mapstructure:"textConv"          yaml:"textConv"`
+	Umask                  fs.FileMode                     `json:"umask"             mapstructure:"umask"             yaml:"umask"`
+	UseBuiltinAge          autoBool                        `json:"useBuiltinAge"     mapstructure:"useBuiltinAge"     yaml:"useBuiltinAge"`
+	UseBuiltinGPG          autoBool                        `json:"useBuiltinGPG"     mapstructure:"useBuiltinGPG"     yaml:"useBuiltinGPG"`
+	UseBuiltinSOPS         autoBool                        `json:"useBuiltinSOPS"    mapstructure:"useBuiltinSOPS"    yaml:"useBuiltinSOPS"`
+	UseBuiltinGit          autoBool                        `json:"useBuiltinGit"     mapstructure:"useBuiltinGit"     yaml:"useBuiltinGit"`
+	Verbose                bool                            `json:"verbose"           mapstructure:"verbose"           yaml:"verbose"`
+	Warnings               warningsConfig                  `json:"warnings"          mapstructure:"warnings"          yaml:"warnings"`
+	WorkingTreeAbsPath     chezmoi.AbsPath                 `json:"workingTree"       mapstructure:"workingTree"       yaml:"workingTree"`
 
 	// Password manager configurations.
 	AWSSecretsManager awsSecretsManagerConfig `json:"awsSecretsManager" mapstructure:"awsSecretsManager" yaml:"awsSecretsManager"`
@@ -152,6 +160,7 @@ type ConfigFile struct {
 	Encryption string                `json:"encryption" mapstructure:"encryption" yaml:"encryption"`
 	Age        chezmoi.AgeEncryption `json:"age"        mapstructure:"age"        yaml:"age"`
 	GPG        chezmoi.GPGEncryption `json:"gpg"        mapstructure:"gpg"        yaml:"gpg"`
+	SOPS       chezmoi.SOPS          `json:"sops"       mapstructure:"sops"       yaml:"sops"`
 
 	// Command configurations.
 	Add        addCmdConfig        `json:"add"        mapstructure:"add"        yaml:"add"`
@@ -175,6 +184,7 @@ type Config struct {
 	cpuProfile       chezmoi.AbsPath
 	debug            bool
 	dryRun           bool
+	eventsFD         int
 	force            bool
 	homeDir          string
 	keepGoing        bool
@@ -200,12 +210,14 @@ type Config struct {
 	doctor          doctorCmdConfig
 	dump            dumpCmdConfig
 	dumpConfig      dumpConfigCmdConfig
+	encryptInline   encryptInlineCmdConfig
 	executeTemplate executeTemplateCmdConfig
 	ignored         ignoredCmdConfig
 	_import         importCmdConfig
 	init            initCmdConfig
 	managed         managedCmdConfig
 	mergeAll        mergeAllCmdConfig
+	plan            planCmdConfig
 	purge           purgeCmdConfig
 	reAdd           reAddCmdConfig
 	secret          secretCmdConfig
@@ -230,6 +242,7 @@ type Config struct {
 	baseSystem                  chezmoi.System
 	sourceSystem                chezmoi.System
 	destSystem                  chezmoi.System
+	transactionSystem           *chezmoi.TransactionSystem
 	persistentState             chezmoi.PersistentState
 	httpClient                  *http.Client
 	logger                      *slog.Logger
@@ -238,8 +251,14 @@ type Config struct {
 	commandDirAbsPath   chezmoi.AbsPath
 	homeDirAbsPath      chezmoi.AbsPath
 	encryption          chezmoi.Encryption
+	eventFunc           chezmoi.EventFunc
+	stagedEventsMutex   sync.Mutex
+	stagedEvents        []*chezmoi.Event
+	hookPayload         hookPayload
 	sourceDirAbsPath    chezmoi.AbsPath
 	sourceDirAbsPathErr error
+	sourceHooks         []*chezmoi.Hook
+	sourceHooksLoaded   bool
 	sourceState         *chezmoi.SourceState
 	sourceStateErr      error
 	templateData        *templateData
@@ -295,6 +314,12 @@ type configState struct {
 	ConfigTemplateContentsSHA256 chezmoi.HexBytes `json:"configTemplateContentsSHA256" yaml:"configTemplateContentsSHA256"` //nolint:tagliatelle
 }
 
+// A failedTargetState records a target that failed to apply.
+type failedTargetState struct {
+	Error string    `json:"error" yaml:"error"`
+	Time  time.Time `json:"time"  yaml:"time"`
+}
+
 var (
 	chezmoiRelPath             = chezmoi.NewRelPath("chezmoi")
 	persistentStateFileRelPath = chezmoi.NewRelPath("chezmoistate.boltdb")
@@ -347,8 +372,9 @@ func newConfig(options ...configOption) (*Config, error) {
 
 		// Command configurations.
 		apply: applyCmdConfig{
-			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
-			recursive: true,
+			filter:     chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			onConflict: newChoiceFlag("", onConflictValues),
+			recursive:  true,
 		},
 		archive: archiveCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
@@ -387,10 +413,19 @@ func newConfig(options ...configOption) (*Config, error) {
 		mergeAll: mergeAllCmdConfig{
 			recursive: true,
 		},
+		plan: planCmdConfig{
+			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			recursive: true,
+		},
 		reAdd: reAddCmdConfig{
 			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
 			recursive: true,
 		},
+		secret: secretCmdConfig{
+			refs: secretRefsCmdConfig{
+				format: newChoiceFlag(formatJSON, writeDataFormatValues),
+			},
+		},
 		state: stateCmdConfig{
 			data: stateDataCmdConfig{
 				format: newChoiceFlag(formatJSON, writeDataFormatValues),
@@ -585,9 +620,11 @@ type applyArgsOptions struct {
 	cmd          *cobra.Command
 	filter       *chezmoi.EntryTypeFilter
 	init         bool
+	packages     bool
 	parentDirs   bool
 	recursive    bool
 	umask        fs.FileMode
+	patchFunc    chezmoi.PatchFunc
 	preApplyFunc chezmoi.PreApplyFunc
 }
 
@@ -601,7 +638,7 @@ func (c *Config) applyArgs(
 	targetDirAbsPath chezmoi.AbsPath,
 	args []string,
 	options applyArgsOptions,
-) error {
+) (err error) {
 	if options.init {
 		if err := c.createAndReloadConfigFile(options.cmd); err != nil {
 			return err
@@ -678,30 +715,232 @@ func (c *Config) applyArgs(
 		targetRelPaths = prependParentRelPaths(targetRelPaths)
 	}
 
+	targetRelPaths, err = sourceState.SortTargetRelPaths(targetRelPaths)
+	if err != nil {
+		return err
+	}
+
+	committed := false
 	applyOptions := chezmoi.ApplyOptions{
 		Filter:       options.filter,
+		PatchFunc:    options.patchFunc,
 		PreApplyFunc: options.preApplyFunc,
 		Umask:        options.umask,
 	}
+	if c.eventFunc != nil {
+		applyOptions.PreApplyFunc = func(
+			targetRelPath chezmoi.RelPath,
+			targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState,
+		) error {
+			c.eventFunc(&chezmoi.Event{
+				Type:        chezmoi.EventTypeTargetEvaluated,
+				Path:        targetDirAbsPath.Join(targetRelPath).String(),
+				Actual:      actualEntryState,
+				LastWritten: lastWrittenEntryState,
+				Target:      targetEntryState,
+			})
+			if options.preApplyFunc == nil {
+				return nil
+			}
+			return options.preApplyFunc(targetRelPath, targetEntryState, lastWrittenEntryState, actualEntryState)
+		}
+	}
+	// Record which targets change so that they can be passed to hooks and
+	// matching handlers can be run at the end of the apply.
+	var handlers []*chezmoi.Handler
+	var changedTargetRelPaths []chezmoi.RelPath
+	if annotations := getAnnotations(options.cmd); annotations.hasTag(modifiesDestinationDirectory) &&
+		!annotations.hasTag(dryRun) {
+		handlers = sourceState.Handlers()
+		applyOptions.ChangedFunc = func(
+			targetRelPath chezmoi.RelPath,
+			targetEntryState, actualEntryState *chezmoi.EntryState,
+		) {
+			c.hookPayload.recordChange(targetDirAbsPath.Join(targetRelPath), targetEntryState, actualEntryState)
+			if targetEntryState.Type != chezmoi.EntryStateTypeScript {
+				changedTargetRelPaths = append(changedTargetRelPaths, targetRelPath)
+			}
+		}
+	}
+
+	// In atomic mode, stage all changes and changes to the persistent state
+	// and only make them if every target is applied successfully. Scripts that
+	// do not run before other entries and commands are run after the commit.
+	persistentState := c.persistentState
+	var afterCommitRelPaths []chezmoi.RelPath
+	if c.transactionSystem != nil {
+		persistentState = chezmoi.NewMockPersistentState()
+		if err := c.persistentState.CopyTo(persistentState); err != nil {
+			return err
+		}
+		defer func() {
+			if !committed {
+				err = chezmoierrors.Combine(err, c.transactionSystem.Abort())
+			}
+		}()
+	}
+
+	recordFailedTargets := false
+	runScriptsInParallel := false
+	if annotations := getAnnotations(options.cmd); !c.dryRun &&
+		annotations.hasTag(modifiesDestinationDirectory) && !annotations.hasTag(dryRun) {
+		recordFailedTargets = true
+		runScriptsInParallel = true
+		// The contents of overwritten files are only stored with the generation
+		// if backups are enabled. In atomic mode, backups are staged with the
+		// other changes so that they are only recorded if the changes are made.
+		var backupStore *chezmoi.BackupStore
+		switch {
+		case c.Backup.Enabled && c.transactionSystem != nil:
+			backupStore = chezmoi.NewBackupStore(c.transactionSystem, persistentState, c.CacheDirAbsPath.Join(backupDirRelPath))
+		case c.Backup.Enabled:
+			backupStore = c.newBackupStore()
+		}
+		applyOptions.BackupStore = backupStore
+		applyOptions.Generation = chezmoi.NewGeneration(options.cmd.Name(), c.sourceCommit(), backupStore)
+		defer chezmoierrors.CombineFunc(&err, func() error {
+			if c.transactionSystem != nil && !committed {
+				return nil
+			}
+			if err := applyOptions.Generation.Save(c.persistentState); err != nil {
+				return err
+			}
+			if c.Backup.MaxAge == 0 && c.Backup.MaxCount == 0 && c.Backup.MaxGenerations == 0 {
+				return nil
+			}
+			return c.pruneBackups()
+		})
+	}
 
 	keptGoingAfterErr := false
-	for _, targetRelPath := range targetRelPaths {
-		switch err := sourceState.Apply(targetSystem, c.destSystem, c.persistentState, targetDirAbsPath, targetRelPath, applyOptions); {
+
+	// Record which targets failed so that they can be retried. In atomic mode,
+	// a failure before the commit means that no changes are made, and targets
+	// are only known to have succeeded once the changes are committed.
+	var uncommittedRelPaths []chezmoi.RelPath
+	applyTargetRelPath := func(targetSystem chezmoi.System, targetRelPath chezmoi.RelPath) error {
+		err := sourceState.Apply(targetSystem, c.destSystem, persistentState, targetDirAbsPath, targetRelPath, applyOptions)
+		switch {
+		case !recordFailedTargets || errors.Is(err, fs.SkipDir):
+		case c.transactionSystem != nil && !committed:
+			if err == nil {
+				uncommittedRelPaths = append(uncommittedRelPaths, targetRelPath)
+			}
+		default:
+			if err := c.setFailedTargetState(targetDirAbsPath.Join(targetRelPath), err); err != nil {
+				return err
+			}
+		}
+		switch {
 		case errors.Is(err, fs.SkipDir):
-			continue
+			return nil
 		case err != nil:
+			c.emitErrorEvent(targetDirAbsPath.Join(targetRelPath), err)
 			err = fmt.Errorf("%s: %w", targetRelPath, err)
+			if !c.keepGoing || c.transactionSystem != nil && !committed {
+				return err
+			}
+			c.errorf("%v\n", err)
+			c.hookPayload.Errors = append(c.hookPayload.Errors, err.Error())
+			keptGoingAfterErr = true
+		}
+		return nil
+	}
+
+	applyTargetRelPaths := func(targetRelPaths []chezmoi.RelPath) error {
+		return c.applyParallelGroups(sourceState, targetSystem, targetRelPaths, runScriptsInParallel, applyTargetRelPath)
+	}
+
+	var beforeCommitRelPaths []chezmoi.RelPath
+	for _, targetRelPath := range targetRelPaths {
+		if c.transactionSystem != nil && runsAfterCommit(sourceState.Get(targetRelPath)) {
+			afterCommitRelPaths = append(afterCommitRelPaths, targetRelPath)
+			continue
+		}
+		beforeCommitRelPaths = append(beforeCommitRelPaths, targetRelPath)
+	}
+
+	// Missing packages are installed after run_before_ scripts and before all
+	// other targets, and only when all targets are applied. In atomic mode,
+	// they are installed after the commit so that they are not installed if no
+	// changes are made.
+	installPackages := options.packages && len(args) == 0 && options.filter.IncludeEntryTypeBits(chezmoi.EntryTypePackages)
+	installMissingPackages := func() error {
+		if err := c.installMissingPackages(sourceState); err != nil {
 			if !c.keepGoing {
 				return err
 			}
 			c.errorf("%v\n", err)
+			c.hookPayload.Errors = append(c.hookPayload.Errors, err.Error())
 			keptGoingAfterErr = true
 		}
+		return nil
+	}
+	if installPackages && c.transactionSystem == nil {
+		i := slices.IndexFunc(beforeCommitRelPaths, func(targetRelPath chezmoi.RelPath) bool {
+			return !isBeforeScript(sourceState.Get(targetRelPath))
+		})
+		if i == -1 {
+			i = len(beforeCommitRelPaths)
+		}
+		if err := applyTargetRelPaths(beforeCommitRelPaths[:i]); err != nil {
+			return err
+		}
+		if err := installMissingPackages(); err != nil {
+			return err
+		}
+		beforeCommitRelPaths = beforeCommitRelPaths[i:]
+	}
+	if err := applyTargetRelPaths(beforeCommitRelPaths); err != nil {
+		return err
 	}
 
-	switch err := sourceState.PostApply(targetSystem, c.persistentState, targetDirAbsPath, targetRelPaths); {
+	if c.transactionSystem != nil {
+		if err := c.commitTransaction(); err != nil {
+			return err
+		}
+		committed = true
+		if err := persistentState.CopyTo(c.persistentState); err != nil {
+			return err
+		}
+		persistentState = c.persistentState
+		for _, targetRelPath := range uncommittedRelPaths {
+			if err := c.setFailedTargetState(targetDirAbsPath.Join(targetRelPath), nil); err != nil {
+				return err
+			}
+		}
+		if installPackages {
+			if err := installMissingPackages(); err != nil {
+				return err
+			}
+		}
+		if err := applyTargetRelPaths(afterCommitRelPaths); err != nil {
+			return err
+		}
+	}
+
+	err = sourceState.PostApply(targetSystem, persistentState, targetDirAbsPath, targetRelPaths)
+	if err != nil {
+		c.emitErrorEvent(chezmoi.EmptyAbsPath, err)
+	}
+	switch {
+	case err != nil && c.keepGoing:
+		c.errorf("%v\n", err)
+		c.hookPayload.Errors = append(c.hookPayload.Errors, err.Error())
+		keptGoingAfterErr = true
+	case err != nil:
+		return err
+	}
+	if c.transactionSystem != nil {
+		if err := c.commitTransaction(); err != nil {
+			return err
+		}
+	}
+
+	switch err := c.runHandlers(handlers, targetDirAbsPath, changedTargetRelPaths); {
 	case err != nil && c.keepGoing:
 		c.errorf("%v\n", err)
+		c.hookPayload.Errors = append(c.hookPayload.Errors, err.Error())
 		keptGoingAfterErr = true
 	case err != nil:
 		return err
@@ -714,6 +953,77 @@ func (c *Config) applyArgs(
 	return nil
 }
 
+// applyParallelGroups applies targetRelPaths in order with applyFunc. If
+// parallel is true then scripts in the same parallel group, which are adjacent
+// in targetRelPaths, are run concurrently.
+func (c *Config) applyParallelGroups(
+	sourceState *chezmoi.SourceState,
+	targetSystem chezmoi.System,
+	targetRelPaths []chezmoi.RelPath,
+	parallel bool,
+	applyFunc func(chezmoi.System, chezmoi.RelPath) error,
+) error {
+	for len(targetRelPaths) > 0 {
+		var parallelGroup string
+		if parallel {
+			scriptOptions, err := sourceState.ScriptOptions(targetRelPaths[0])
+			if err != nil {
+				return err
+			}
+			if scriptOptions != nil {
+				parallelGroup = scriptOptions.ParallelGroup
+			}
+		}
+		if parallelGroup == "" {
+			if err := applyFunc(targetSystem, targetRelPaths[0]); err != nil {
+				return err
+			}
+			targetRelPaths = targetRelPaths[1:]
+			continue
+		}
+
+		n := 1
+		for ; n < len(targetRelPaths); n++ {
+			scriptOptions, err := sourceState.ScriptOptions(targetRelPaths[n])
+			if err != nil {
+				return err
+			}
+			if scriptOptions == nil || scriptOptions.ParallelGroup != parallelGroup {
+				break
+			}
+		}
+		if err := c.runParallelGroup(targetSystem, targetRelPaths[:n], applyFunc); err != nil {
+			return err
+		}
+		targetRelPaths = targetRelPaths[n:]
+	}
+	return nil
+}
+
+// runParallelGroup applies the scripts in targetRelPaths concurrently with
+// applyFunc. Everything except the scripts' processes is serialized by the
+// ParallelScriptSystem's lock.
+func (c *Config) runParallelGroup(
+	targetSystem chezmoi.System,
+	targetRelPaths []chezmoi.RelPath,
+	applyFunc func(chezmoi.System, chezmoi.RelPath) error,
+) error {
+	parallelScriptSystem := chezmoi.NewParallelScriptSystem(targetSystem, max(c.ScriptParallelism, 1), c.stdout, c.stderr)
+	errs := make([]error, len(targetRelPaths))
+	var wg sync.WaitGroup
+	for i, targetRelPath := range targetRelPaths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parallelScriptSystem.Lock()
+			defer parallelScriptSystem.Unlock()
+			errs[i] = applyFunc(parallelScriptSystem, targetRelPath)
+		}()
+	}
+	wg.Wait()
+	return chezmoierrors.Combine(errs...)
+}
+
 // checkVersion checks that chezmoi is at least the required version for the
 // source state.
 func (c *Config) checkVersion() error {
@@ -1017,11 +1327,29 @@ func (c *Config) defaultPreApplyFunc(
 		slog.Any("actualEntryState", actualEntryState),
 	)
 
+	if c.Verbose && targetEntryState.DependencySHA256s != nil {
+		reasons := onChangeReasons(targetEntryState, lastWrittenEntryState)
+		c.errorf("%s: running because %s\n", targetRelPath, strings.Join(reasons, ", "))
+	}
+
+	if isConflict(targetEntryState, lastWrittenEntryState, actualEntryState) {
+		switch onConflict := c.apply.onConflict.String(); {
+		case onConflict != "":
+			return c.resolveConflict(targetRelPath, onConflict, false)
+		case !c.force:
+			return c.promptConflict(targetRelPath, targetEntryState, actualEntryState)
+		}
+	}
+
 	switch {
-	case c.force:
-		return nil
 	case targetEntryState.Equivalent(actualEntryState):
 		return nil
+	case c.apply.patch && targetEntryState.Type == chezmoi.EntryStateTypeFile &&
+		actualEntryState != nil && actualEntryState.Type == chezmoi.EntryStateTypeFile:
+		// The hunks to apply are chosen by applyPatch.
+		return nil
+	case c.force:
+		return nil
 	}
 
 	if c.Interactive {
@@ -1099,6 +1427,67 @@ func (c *Config) defaultPreApplyFunc(
 	}
 }
 
+// promptConflict prompts the user to resolve the conflict at targetRelPath.
+func (c *Config) promptConflict(targetRelPath chezmoi.RelPath, targetEntryState, actualEntryState *chezmoi.EntryState) error {
+	prompt := fmt.Sprintf("%s has changed since chezmoi last wrote it and in the source state", targetRelPath)
+	var choices []string
+	actualContents := actualEntryState.Contents()
+	targetContents := targetEntryState.Contents()
+	if actualContents != nil || targetContents != nil {
+		choices = append(choices, "diff")
+	}
+	if targetEntryState.Type == chezmoi.EntryStateTypeFile {
+		choices = append(choices, onConflictMerge)
+	}
+	choices = append(choices, onConflictKeep, onConflictOverwrite, "all-overwrite", "quit")
+	for {
+		switch choice, err := c.promptChoice(prompt, choices); {
+		case err != nil:
+			return err
+		case choice == "diff":
+			if err := c.diffFile(targetRelPath, actualContents, actualEntryState.Mode, targetContents, targetEntryState.Mode); err != nil {
+				return err
+			}
+		case choice == "all-overwrite":
+			c.force = true
+			return nil
+		case choice == "quit":
+			return chezmoi.ExitCodeError(0)
+		default:
+			return c.resolveConflict(targetRelPath, choice, true)
+		}
+	}
+}
+
+// resolveConflict resolves the conflict at targetRelPath with onConflict. If
+// interactive is false then merges use the built-in merge without prompting.
+func (c *Config) resolveConflict(targetRelPath chezmoi.RelPath, onConflict string, interactive bool) error {
+	switch onConflict {
+	case onConflictFail:
+		return errors.New("conflict: changed since chezmoi last wrote it and in the source state")
+	case onConflictKeep:
+		return fs.SkipDir
+	case onConflictMerge:
+		// Merge the changes into the source state and keep the destination,
+		// so that the next apply writes the merged contents.
+		sourceStateEntry := c.sourceState.MustEntry(targetRelPath)
+		var err error
+		if interactive {
+			err = c.doMerge(targetRelPath, sourceStateEntry)
+		} else {
+			err = c.doBuiltinMerge(targetRelPath, sourceStateEntry, false)
+		}
+		if err != nil {
+			return err
+		}
+		return fs.SkipDir
+	case onConflictOverwrite:
+		return nil
+	default:
+		panic(onConflict + ": unexpected choice")
+	}
+}
+
 // defaultSourceDir returns the default source directory according to the XDG
 // Base Directory Specification.
 func (c *Config) defaultSourceDir(fileSystem vfs.Stater, bds *xdg.BaseDirectorySpecification) (chezmoi.AbsPath, error) {
@@ -1260,6 +1649,36 @@ func (c *Config) editor(args []string) (string, []string, error) {
 	return parseCommand(editCommand, append(editArgs, args...))
 }
 
+// commitTransaction commits c.transactionSystem and then emits the write
+// events of the committed changes.
+func (c *Config) commitTransaction() error {
+	err := c.transactionSystem.Commit()
+	c.stagedEventsMutex.Lock()
+	events := c.stagedEvents
+	c.stagedEvents = nil
+	c.stagedEventsMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		c.eventFunc(event)
+	}
+	return nil
+}
+
+// emitErrorEvent emits an error event for err at absPath, if events are
+// enabled.
+func (c *Config) emitErrorEvent(absPath chezmoi.AbsPath, err error) {
+	if c.eventFunc == nil {
+		return
+	}
+	c.eventFunc(&chezmoi.Event{
+		Type:  chezmoi.EventTypeError,
+		Path:  absPath.String(),
+		Error: err.Error(),
+	})
+}
+
 // errorf writes an error to stderr.
 func (c *Config) errorf(format string, args ...any) {
 	fmt.Fprintf(c.stderr, "chezmoi: "+format, args...)
@@ -1275,7 +1694,28 @@ func (c *Config) execute(args []string) error {
 
 	rootCmd.SetArgs(args)
 
-	return rootCmd.Execute()
+	err = rootCmd.Execute()
+
+	// Commands that keep going after errors fail without running their post
+	// hooks, so run them here so that the hooks receive the errors.
+	var exitCodeError chezmoi.ExitCodeError
+	if len(c.hookPayload.Errors) > 0 && errors.As(err, &exitCodeError) {
+		err = chezmoierrors.Combine(err, c.runHookPost(c.hookPayload.Command))
+	}
+
+	return err
+}
+
+// failedTargetAbsPaths returns the targets that failed in the last apply.
+func (c *Config) failedTargetAbsPaths() (chezmoiset.Set[chezmoi.AbsPath], error) {
+	failedTargetAbsPaths := chezmoiset.New[chezmoi.AbsPath]()
+	if err := c.persistentState.ForEach(chezmoi.FailedTargetStateBucket, func(k, v []byte) error {
+		failedTargetAbsPaths.Add(chezmoi.NewAbsPath(string(k)))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return failedTargetAbsPaths, nil
 }
 
 // filterInput reads from args (or the standard input if args is empty),
@@ -1719,7 +2159,9 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 	persistentFlags.BoolVar(&c.Safe, "safe", c.Safe, "Safely replace files and symlinks")
 	persistentFlags.VarP(&c.SourceDirAbsPath, "source", "S", "Set source directory")
 	persistentFlags.Var(&c.UseBuiltinAge, "use-builtin-age", "Use builtin age")
+	persistentFlags.Var(&c.UseBuiltinGPG, "use-builtin-gpg", "Use builtin gpg")
 	persistentFlags.Var(&c.UseBuiltinGit, "use-builtin-git", "Use builtin git")
+	persistentFlags.Var(&c.UseBuiltinSOPS, "use-builtin-sops", "Use builtin sops")
 	persistentFlags.BoolVarP(&c.Verbose, "verbose", "v", c.Verbose, "Make output more verbose")
 	persistentFlags.VarP(&c.WorkingTreeAbsPath, "working-tree", "W", "Set working tree directory")
 
@@ -1752,7 +2194,9 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		rootCmd.RegisterFlagCompletionFunc("progress", autoBoolFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("refresh-externals", chezmoi.RefreshExternalsFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("use-builtin-age", autoBoolFlagCompletionFunc),
+		rootCmd.RegisterFlagCompletionFunc("use-builtin-gpg", autoBoolFlagCompletionFunc),
 		rootCmd.RegisterFlagCompletionFunc("use-builtin-git", autoBoolFlagCompletionFunc),
+		rootCmd.RegisterFlagCompletionFunc("use-builtin-sops", autoBoolFlagCompletionFunc),
 		rootCmd.MarkPersistentFlagDirname("working-tree"),
 	); err != nil {
 		return nil, err
@@ -1764,6 +2208,7 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		c.newAgeCmd(),
 		c.newApplyCmd(),
 		c.newArchiveCmd(),
+		c.newBackupCmd(),
 		c.newCatCmd(),
 		c.newCatConfigCmd(),
 		c.newCDCmd(),
@@ -1780,9 +2225,11 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		c.newEditConfigCmd(),
 		c.newEditConfigTemplateCmd(),
 		c.newEncryptCommand(),
+		c.newEncryptInlineCmd(),
 		c.newExecuteTemplateCmd(),
 		c.newForgetCmd(),
 		c.newGenerateCmd(),
+		c.newGenerationsCmd(),
 		c.newGitCmd(),
 		c.newIgnoredCmd(),
 		c.newImportCmd(),
@@ -1793,9 +2240,12 @@ func (c *Config) newRootCmd() (*cobra.Command, error) {
 		c.newManagedCmd(),
 		c.newMergeCmd(),
 		c.newMergeAllCmd(),
+		c.newPlanCmd(),
 		c.newPurgeCmd(),
 		c.newReAddCmd(),
 		c.newRemoveCmd(),
+		c.newRollbackCmd(),
+		c.newScriptCmd(),
 		c.newSecretCmd(),
 		c.newSourcePathCmd(),
 		c.newStateCmd(),
@@ -1832,6 +2282,7 @@ func (c *Config) newDiffSystem(s chezmoi.System, w io.Writer, dirAbsPath chezmoi
 	if c.useBuiltinDiff || c.Diff.Command == "" {
 		options := &chezmoi.GitDiffSystemOptions{
 			Color:          c.Color.Value(c.colorAutoFunc),
+			EventFunc:      c.eventFunc,
 			Filter:         chezmoi.NewEntryTypeFilter(c.Diff.include.Bits(), c.Diff.Exclude.Bits()),
 			Reverse:        c.Diff.Reverse,
 			ScriptContents: c.Diff.ScriptContents,
@@ -1882,12 +2333,14 @@ func (c *Config) newSourceState(
 		}),
 		chezmoi.WithDestDir(c.DestDirAbsPath),
 		chezmoi.WithEncryption(c.encryption),
+		chezmoi.WithEventFunc(c.eventFunc),
 		chezmoi.WithHTTPClient(httpClient),
 		chezmoi.WithInterpreters(c.Interpreters),
 		chezmoi.WithLogger(sourceStateLogger),
 		chezmoi.WithMode(c.Mode),
 		chezmoi.WithPriorityTemplateData(c.Data),
 		chezmoi.WithScriptTempDir(c.ScriptTempDir),
+		chezmoi.WithSOPS(&c.SOPS),
 		chezmoi.WithSourceDir(c.SourceDirAbsPath),
 		chezmoi.WithSystem(c.sourceSystem),
 		chezmoi.WithTemplateFuncs(c.templateFuncs),
@@ -2017,6 +2470,15 @@ func (c *Config) pageDiffOutput(output string) error {
 func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error {
 	annotations := getAnnotations(cmd)
 
+	c.hookPayload = hookPayload{
+		Command: cmd.Name(),
+		Args:    append([]string{}, args...),
+		DryRun:  c.dryRun,
+		Targets: []hookPayloadTarget{},
+		Scripts: []string{},
+		Errors:  []string{},
+	}
+
 	// Add the completion template function. This needs cmd, so we can't do it
 	// in newConfig.
 	c.addTemplateFunc("completion", func(shell string) string {
@@ -2172,6 +2634,25 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 	// Set up the source and destination systems.
 	c.sourceSystem = c.baseSystem
 	c.destSystem = c.baseSystem
+	if annotations.hasTag(modifiesDestinationDirectory) && !c.dryRun {
+		c.destSystem = c.newScriptLogSystem(c.destSystem)
+	}
+	if c.apply.atomic && !c.dryRun && annotations.hasTag(modifiesDestinationDirectory) {
+		c.transactionSystem = chezmoi.NewTransactionSystem(c.destSystem)
+		c.destSystem = c.transactionSystem
+	}
+	if c.eventsFD != 0 {
+		if err := c.setEventFunc(); err != nil {
+			return err
+		}
+		eventFunc := c.eventFunc
+		if c.transactionSystem != nil {
+			// In atomic mode, changes are only made when they are committed, so
+			// write events are held until then.
+			eventFunc = c.stageWriteEvent
+		}
+		c.destSystem = chezmoi.NewEventSystem(c.destSystem, eventFunc)
+	}
 	if !annotations.hasTag(modifiesDestinationDirectory) {
 		c.destSystem = chezmoi.NewReadOnlySystem(c.destSystem)
 	}
@@ -2205,6 +2686,17 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 			c.diffPagerCmd = pagerCmd
 			c.diffPagerCmdStdin = lazyWriter
 		}
+		// Include the changes that scripts that support the dry run protocol
+		// would make.
+		diffFilter := chezmoi.NewEntryTypeFilter(c.Diff.include.Bits(), c.Diff.Exclude.Bits())
+		if (c.dryRun || annotations.hasTag(dryRun)) && diffFilter.IncludeEntryTypeBits(chezmoi.EntryTypeScripts) {
+			c.destSystem = chezmoi.NewDryRunScriptSystem(c.destSystem, c.baseSystem, func(
+				scriptName chezmoi.RelPath,
+				changes []chezmoi.ScriptChange,
+			) error {
+				return writeScriptChanges(writer, scriptName, changes)
+			})
+		}
 		c.sourceSystem = c.newDiffSystem(c.sourceSystem, writer, c.SourceDirAbsPath)
 		c.destSystem = c.newDiffSystem(c.destSystem, writer, c.DestDirAbsPath)
 	}
@@ -2330,6 +2822,13 @@ func (c *Config) persistentPreRunRootE(cmd *cobra.Command, args []string) error
 		return err
 	}
 
+	if annotations.hasTag(requiresSourceDirectory) || annotations.hasTag(modifiesSourceDirectory) ||
+		annotations.hasTag(modifiesDestinationDirectory) {
+		if err := c.loadSourceHooks(cmd); err != nil {
+			return err
+		}
+	}
+
 	return c.runHookPre(cmd.Name())
 }
 
@@ -2527,7 +3026,7 @@ func (c *Config) runEditor(args []string) error {
 }
 
 // runHook runs a command or script hook.
-func (c *Config) runHook(command commandConfig) error {
+func (c *Config) runHook(hook, phase string, command commandConfig) error {
 	var name string
 	var args []string
 	switch {
@@ -2548,22 +3047,116 @@ func (c *Config) runHook(command commandConfig) error {
 	default:
 		return nil
 	}
-	return c.run(c.homeDirAbsPath, name, args)
+
+	payload := c.hookPayload
+	payload.Event = hook
+	payload.Phase = phase
+	payloadJSON, err := chezmoi.FormatJSON.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(name, args...)
+	dirRawAbsPath, err := c.baseSystem.RawPath(c.homeDirAbsPath)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = dirRawAbsPath.String()
+	cmd.Env = append(os.Environ(), payload.environ()...)
+	if command.PayloadFile {
+		// Pass the payload in a file so that the hook keeps chezmoi's standard
+		// input, for example so that it can prompt the user.
+		tempDirAbsPath, err := c.tempDir("chezmoi-hook")
+		if err != nil {
+			return err
+		}
+		payloadAbsPath := tempDirAbsPath.JoinString("payload.json")
+		if err := c.baseSystem.WriteFile(payloadAbsPath, payloadJSON, 0o600); err != nil {
+			return err
+		}
+		cmd.Env = append(cmd.Env, "CHEZMOI_HOOK_PAYLOAD="+payloadAbsPath.String())
+		cmd.Stdin = c.stdin
+	} else {
+		cmd.Stdin = bytes.NewReader(payloadJSON)
+	}
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+	if err := chezmoilog.LogCmdRun(c.logger, cmd); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// runHandlers runs every handler in handlers that matches any of
+// changedTargetRelPaths, in order. Each handler is run at most once, with the
+// absolute paths of the changed targets that it matches in the
+// CHEZMOI_HANDLER_TARGETS environment variable, one per line.
+func (c *Config) runHandlers(
+	handlers []*chezmoi.Handler,
+	targetDirAbsPath chezmoi.AbsPath,
+	changedTargetRelPaths []chezmoi.RelPath,
+) error {
+	for _, handler := range handlers {
+		var targets []string
+		for _, targetRelPath := range changedTargetRelPaths {
+			if handler.Match(targetRelPath) {
+				targets = append(targets, targetDirAbsPath.Join(targetRelPath).String())
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		if c.dryRun || c.Verbose {
+			c.errorf("handler %s: %s\n", handler.Name, shellQuoteCommand(handler.Command, handler.Args))
+		}
+		cmd := exec.Command(handler.Command, handler.Args...)
+		dirRawAbsPath, err := c.baseSystem.RawPath(c.homeDirAbsPath)
+		if err != nil {
+			return err
+		}
+		cmd.Dir = dirRawAbsPath.String()
+		cmd.Env = append(os.Environ(), "CHEZMOI_HANDLER_TARGETS="+strings.Join(targets, "\n"))
+		cmd.Stdin = c.stdin
+		cmd.Stdout = c.stdout
+		cmd.Stderr = c.stderr
+		if err := c.destSystem.RunCmd(cmd); err != nil {
+			return fmt.Errorf("handler %s: %w", handler.Name, err)
+		}
+	}
+	return nil
 }
 
-// runHookPost runs the hook's post command, if it is set.
+// runHookPost runs the hook's post commands from the config file and the
+// source directory, if they are set.
 func (c *Config) runHookPost(hook string) error {
-	if err := c.runHook(c.Hooks[hook].Post); err != nil {
+	if err := c.runHook(hook, "post", c.Hooks[hook].Post); err != nil {
 		return fmt.Errorf("%s: post: %w", hook, err)
 	}
+	for _, sourceHook := range c.sourceHooks {
+		if sourceHook.Event != hook {
+			continue
+		}
+		if err := c.runHook(hook, "post", commandConfig(sourceHook.Post)); err != nil {
+			return fmt.Errorf("%s: %s: post: %w", sourceHook.SourceAbsPath(), hook, err)
+		}
+	}
 	return nil
 }
 
-// runHookPre runs the hook's pre command, if it is set.
+// runHookPre runs the hook's pre commands from the config file and the source
+// directory, if they are set.
 func (c *Config) runHookPre(hook string) error {
-	if err := c.runHook(c.Hooks[hook].Pre); err != nil {
+	if err := c.runHook(hook, "pre", c.Hooks[hook].Pre); err != nil {
 		return fmt.Errorf("%s: pre: %w", hook, err)
 	}
+	for _, sourceHook := range c.sourceHooks {
+		if sourceHook.Event != hook {
+			continue
+		}
+		if err := c.runHook(hook, "pre", commandConfig(sourceHook.Pre)); err != nil {
+			return fmt.Errorf("%s: %s: pre: %w", sourceHook.SourceAbsPath(), hook, err)
+		}
+	}
 	return nil
 }
 
@@ -2574,6 +3167,7 @@ func (c *Config) setEncryption() error {
 		c.Age.UseBuiltin = c.UseBuiltinAge.Value(c.useBuiltinAgeAutoFunc)
 		c.encryption = &c.Age
 	case "gpg":
+		c.setGPGUseBuiltin(&c.GPG)
 		c.encryption = &c.GPG
 	case "":
 		// Detect encryption if any non-default configuration is set, preferring
@@ -2584,6 +3178,7 @@ func (c *Config) setEncryption() error {
 				"warning: 'encryption' not set, using gpg configuration. " +
 					"Check if 'encryption' is correctly set as the top-level key.\n",
 			)
+			c.setGPGUseBuiltin(&c.GPG)
 			c.encryption = &c.GPG
 		case !reflect.DeepEqual(c.Age, defaultAgeEncryptionConfig):
 			c.errorf(
@@ -2599,6 +3194,16 @@ func (c *Config) setEncryption() error {
 		return fmt.Errorf("%s: unknown encryption", c.Encryption)
 	}
 
+	// sops data keys are decrypted with the age and gpg configurations,
+	// whichever encryption is selected, so give sops its own copies.
+	sopsAgeEncryption := c.Age
+	sopsAgeEncryption.UseBuiltin = c.UseBuiltinAge.Value(c.useBuiltinAgeAutoFunc)
+	sopsGPGEncryption := c.GPG
+	c.setGPGUseBuiltin(&sopsGPGEncryption)
+	c.SOPS.UseBuiltin = c.UseBuiltinSOPS.Value(c.useBuiltinSOPSAutoFunc)
+	c.SOPS.AgeEncryption = &sopsAgeEncryption
+	c.SOPS.GPGEncryption = &sopsGPGEncryption
+
 	if c.debug {
 		encryptionLogger := c.logger.With(logComponentKey, logComponentValueEncryption)
 		c.encryption = chezmoi.NewDebugEncryption(c.encryption, encryptionLogger)
@@ -2607,6 +3212,66 @@ func (c *Config) setEncryption() error {
 	return nil
 }
 
+// setEventFunc sets c.eventFunc to write each event as a line of JSON to the
+// file descriptor c.eventsFD.
+func (c *Config) setEventFunc() error {
+	var w io.Writer
+	switch {
+	case c.eventsFD < 0:
+		return fmt.Errorf("%d: invalid file descriptor", c.eventsFD)
+	case c.eventsFD == 1:
+		return fmt.Errorf("%d: cannot write events to stdout", c.eventsFD)
+	case c.eventsFD == 2:
+		w = c.stderr
+	default:
+		w = os.NewFile(uintptr(c.eventsFD), "events")
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	var mutex sync.Mutex
+	c.eventFunc = func(event *chezmoi.Event) {
+		event.Version = chezmoi.EventSchemaVersion
+		event.Time = time.Now().UTC()
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err := encoder.Encode(event); err != nil {
+			c.logger.Error("Encode", slog.Any("err", err))
+		}
+	}
+	return nil
+}
+
+// setFailedTargetState records that the target at targetAbsPath failed to
+// apply with applyErr, or removes any record if applyErr is nil.
+func (c *Config) setFailedTargetState(targetAbsPath chezmoi.AbsPath, applyErr error) error {
+	if applyErr == nil {
+		// Only delete existing records to avoid writing to the persistent
+		// state when nothing has changed.
+		switch value, err := c.persistentState.Get(chezmoi.FailedTargetStateBucket, targetAbsPath.Bytes()); {
+		case err != nil:
+			return err
+		case value == nil:
+			return nil
+		default:
+			return c.persistentState.Delete(chezmoi.FailedTargetStateBucket, targetAbsPath.Bytes())
+		}
+	}
+	return chezmoi.PersistentStateSet(c.persistentState, chezmoi.FailedTargetStateBucket, targetAbsPath.Bytes(), &failedTargetState{
+		Error: applyErr.Error(),
+		Time:  time.Now().UTC(),
+	})
+}
+
+// setGPGUseBuiltin configures gpgEncryption to use the builtin gpg, if needed.
+func (c *Config) setGPGUseBuiltin(gpgEncryption *chezmoi.GPGEncryption) {
+	gpgEncryption.UseBuiltin = c.UseBuiltinGPG.Value(c.useBuiltinGPGAutoFunc)
+	if gpgEncryption.UseBuiltin {
+		gpgEncryption.PassphraseFunc = func(prompt string) (string, error) {
+			return c.readPassword(prompt, "passphrase")
+		}
+	}
+}
+
 // setEnvironmentVariables sets all environment variables defined in c.
 func (c *Config) setEnvironmentVariables() error {
 	var env map[string]string
@@ -2629,6 +3294,18 @@ func (c *Config) setEnvironmentVariables() error {
 	return nil
 }
 
+// stageWriteEvent holds write events until the changes that they describe are
+// committed, and emits all other events immediately.
+func (c *Config) stageWriteEvent(event *chezmoi.Event) {
+	if event.Type != chezmoi.EventTypeWrite {
+		c.eventFunc(event)
+		return
+	}
+	c.stagedEventsMutex.Lock()
+	defer c.stagedEventsMutex.Unlock()
+	c.stagedEvents = append(c.stagedEvents, event)
+}
+
 // sourceAbsPaths returns the source absolute paths for each target path in
 // args.
 func (c *Config) sourceAbsPaths(sourceState *chezmoi.SourceState, args []string) ([]chezmoi.AbsPath, error) {
@@ -2654,6 +3331,15 @@ func (c *Config) targetRelPath(absPath chezmoi.AbsPath) (chezmoi.RelPath, error)
 	return relPath, err
 }
 
+// targetName returns the name of absPath, relative to the destination
+// directory if possible.
+func (c *Config) targetName(absPath chezmoi.AbsPath) string {
+	if targetRelPath, err := absPath.TrimDirPrefix(c.DestDirAbsPath); err == nil {
+		return targetRelPath.String()
+	}
+	return absPath.String()
+}
+
 type targetRelPathsOptions struct {
 	mustBeInSourceState bool
 	mustNotBeExternal   bool
@@ -2825,6 +3511,22 @@ func (c *Config) useBuiltinAgeAutoFunc() bool {
 	return true
 }
 
+// useBuiltinGPGAutoFunc detects whether the builtin gpg should be used.
+func (c *Config) useBuiltinGPGAutoFunc() bool {
+	if _, err := chezmoi.LookPath(c.GPG.Command); err == nil {
+		return false
+	}
+	return true
+}
+
+// useBuiltinSOPSAutoFunc detects whether the builtin sops should be used.
+func (c *Config) useBuiltinSOPSAutoFunc() bool {
+	if _, err := chezmoi.LookPath(c.SOPS.Command); err == nil {
+		return false
+	}
+	return true
+}
+
 // useBuiltinGitAutoFunc detects whether the builtin git should be used.
 func (c *Config) useBuiltinGitAutoFunc() bool {
 	if _, err := chezmoi.LookPath(c.Git.Command); err == nil {
@@ -2873,6 +3575,12 @@ func (c *Config) writeOutputString(data string) error {
 func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 	return ConfigFile{
 		// Global configuration.
+		Backup: backupConfig{
+			Enabled:        true,
+			MaxAge:         30 * 24 * time.Hour,
+			MaxCount:       10,
+			MaxGenerations: 100,
+		},
 		CacheDirAbsPath: chezmoi.NewAbsPath(bds.CacheHome).Join(chezmoiRelPath),
 		Color: autoBool{
 			auto: true,
@@ -2886,8 +3594,13 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		PINEntry: pinEntryConfig{
 			Options: pinEntryDefaultOptions,
 		},
-		Safe:    true,
-		TempDir: chezmoi.NewAbsPath(os.TempDir()),
+		Safe: true,
+		ScriptLog: scriptLogConfig{
+			MaxOutputSize: 64 << 10,
+			MaxRuns:       10,
+		},
+		ScriptParallelism: runtime.NumCPU(),
+		TempDir:           chezmoi.NewAbsPath(os.TempDir()),
 		Template: templateConfig{
 			Options: chezmoi.DefaultTemplateOptions,
 		},
@@ -2895,9 +3608,15 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		UseBuiltinAge: autoBool{
 			auto: true,
 		},
+		UseBuiltinGPG: autoBool{
+			auto: true,
+		},
 		UseBuiltinGit: autoBool{
 			auto: true,
 		},
+		UseBuiltinSOPS: autoBool{
+			auto: true,
+		},
 		Warnings: warningsConfig{
 			ConfigFileTemplateHasChanged: true,
 		},
@@ -2957,12 +3676,16 @@ func newConfigFile(bds *xdg.BaseDirectorySpecification) ConfigFile {
 		// Encryption configurations.
 		Age: defaultAgeEncryptionConfig,
 		GPG: defaultGPGEncryptionConfig,
+		SOPS: chezmoi.SOPS{
+			Command: "sops",
+		},
 
 		// Command configurations.
 		Add: addCmdConfig{
-			Secrets:   newChoiceFlag("warning", severityValues),
-			filter:    chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
-			recursive: true,
+			Secrets:            newChoiceFlag("warning", severityValues),
+			StoreSecretsPrefix: "chezmoi",
+			filter:             chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+			recursive:          true,
 		},
 		Diff: diffCmdConfig{
 			Exclude:        chezmoi.NewEntryTypeSet(chezmoi.EntryTypesNone),
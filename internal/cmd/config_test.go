@@ -125,6 +125,9 @@ func TestConfigFileFormatRoundTrip(t *testing.T) {
 					Args:       []string{},
 					Recipients: []string{},
 				},
+				SOPS: chezmoi.SOPS{
+					Args: []string{},
+				},
 				Add: addCmdConfig{
 					Secrets: newChoiceFlag(severityWarning, nil),
 				},
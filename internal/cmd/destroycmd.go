@@ -96,6 +96,12 @@ func (c *Config) runDestroyCmd(cmd *cobra.Command, args []string, sourceState *c
 		if err := c.persistentState.Delete(chezmoi.EntryStateBucket, destAbsPath.Bytes()); err != nil {
 			return err
 		}
+		if err := c.persistentState.Delete(chezmoi.FailedTargetStateBucket, destAbsPath.Bytes()); err != nil {
+			return err
+		}
+		if err := c.persistentState.Delete(chezmoi.MergeBaseStateBucket, destAbsPath.Bytes()); err != nil {
+			return err
+		}
 	}
 	return nil
 }
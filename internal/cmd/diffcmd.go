@@ -35,6 +35,7 @@ func (c *Config) newDiffCmd() *cobra.Command {
 		),
 	}
 
+	diffCmd.Flags().IntVar(&c.eventsFD, "events-fd", c.eventsFD, "Write JSON events to file descriptor")
 	diffCmd.Flags().VarP(c.Diff.Exclude, "exclude", "x", "Exclude entry types")
 	diffCmd.Flags().VarP(c.Diff.include, "include", "i", "Include entry types")
 	diffCmd.Flags().BoolVar(&c.Diff.init, "init", c.Diff.init, "Recreate config file from template")
@@ -89,6 +89,7 @@ func (c *Config) runEditCmd(cmd *cobra.Command, args []string) error {
 		sourceAbsPath    chezmoi.AbsPath
 		decryptedAbsPath chezmoi.AbsPath
 		preEditPlaintext []byte
+		sourceStateFile  *chezmoi.SourceStateFile
 	}
 	var transparentlyDecryptedFiles []transparentlyDecryptedFile
 TARGET_REL_PATH:
@@ -96,7 +97,7 @@ TARGET_REL_PATH:
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
 		sourceRelPath := sourceStateEntry.SourceRelPath()
 		switch sourceStateFile, ok := sourceStateEntry.(*chezmoi.SourceStateFile); {
-		case ok && sourceStateFile.Attr.Encrypted:
+		case ok && (sourceStateFile.Attr.Encrypted || sourceStateFile.Attr.SOPS):
 			// FIXME in the case that the file is an encrypted template then we
 			// should first decrypt the file to a temporary directory and
 			// secondly add a hardlink from the edit directory to the temporary
@@ -122,6 +123,7 @@ TARGET_REL_PATH:
 				sourceAbsPath:    c.SourceDirAbsPath.Join(sourceRelPath.RelPath()),
 				decryptedAbsPath: decryptedAbsPath,
 				preEditPlaintext: contents,
+				sourceStateFile:  sourceStateFile,
 			}
 			transparentlyDecryptedFiles = append(transparentlyDecryptedFiles, transparentlyDecryptedFile)
 			editorArgs = append(editorArgs, decryptedAbsPath.String())
@@ -175,6 +177,14 @@ TARGET_REL_PATH:
 			if bytes.Equal(postEditPlaintext, transparentlyDecryptedFile.preEditPlaintext) {
 				return nil
 			}
+			if transparentlyDecryptedFile.sourceStateFile.Attr.SOPS {
+				// Re-encrypt only the changed values, keeping the existing
+				// data key and metadata, and re-apply any outer encryption.
+				if err := c.replaceSourceFileContents(transparentlyDecryptedFile.sourceStateFile, postEditPlaintext); err != nil {
+					return err
+				}
+				continue
+			}
 			contents, err := c.encryption.EncryptFile(transparentlyDecryptedFile.decryptedAbsPath)
 			if err != nil {
 				return err
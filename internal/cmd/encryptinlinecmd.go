@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+type encryptInlineCmdConfig struct {
+	placeholder string
+}
+
+func (c *Config) newEncryptInlineCmd() *cobra.Command {
+	encryptInlineCmd := &cobra.Command{
+		Use:               "encrypt-inline [target]",
+		Short:             "Insert an inline encrypted value into a template",
+		Long:              mustLongHelp("encrypt-inline"),
+		Example:           example("encrypt-inline"),
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runEncryptInlineCmd,
+		Annotations: newAnnotations(
+			modifiesSourceDirectory,
+			persistentStateModeReadMockWrite,
+		),
+	}
+
+	encryptInlineCmd.Flags().
+		StringVar(&c.encryptInline.placeholder, "placeholder", c.encryptInline.placeholder, "Replace placeholder instead of the secret")
+
+	return encryptInlineCmd
+}
+
+func (c *Config) runEncryptInlineCmd(cmd *cobra.Command, args []string) error {
+	secret, err := c.readPassword("Secret? ", "secret")
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return errors.New("empty secret")
+	}
+
+	inline, err := chezmoi.EncryptInline(c.encryption, []byte(secret))
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return c.writeOutputString(inline + "\n")
+	}
+
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return err
+	}
+	targetRelPaths, err := c.targetRelPaths(sourceState, args, targetRelPathsOptions{
+		mustBeInSourceState: true,
+	})
+	if err != nil {
+		return err
+	}
+	sourceStateFile, ok := sourceState.MustEntry(targetRelPaths[0]).(*chezmoi.SourceStateFile)
+	switch {
+	case !ok:
+		return fmt.Errorf("%s: not a file", args[0])
+	case sourceStateFile.Attr.Encrypted:
+		return fmt.Errorf("%s: encrypted", args[0])
+	case !sourceStateFile.Attr.Template:
+		return fmt.Errorf("%s: not a template", args[0])
+	}
+
+	old := secret
+	if c.encryptInline.placeholder != "" {
+		old = c.encryptInline.placeholder
+	}
+	sourceAbsPath := c.SourceDirAbsPath.Join(sourceStateFile.SourceRelPath().RelPath())
+	contents, err := c.sourceSystem.ReadFile(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(contents, []byte(old)) {
+		if c.encryptInline.placeholder != "" {
+			return fmt.Errorf("%s: placeholder not found", args[0])
+		}
+		return fmt.Errorf("%s: secret not found", args[0])
+	}
+	contents = bytes.ReplaceAll(contents, []byte(old), []byte(inline))
+	return c.sourceSystem.WriteFile(sourceAbsPath, contents, 0o666&^c.Umask)
+}
@@ -76,6 +76,12 @@ TARGET_REL_PATH:
 		if err := c.persistentState.Delete(chezmoi.EntryStateBucket, targetAbsPath.Bytes()); err != nil {
 			return err
 		}
+		if err := c.persistentState.Delete(chezmoi.FailedTargetStateBucket, targetAbsPath.Bytes()); err != nil {
+			return err
+		}
+		if err := c.persistentState.Delete(chezmoi.MergeBaseStateBucket, targetAbsPath.Bytes()); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+func (c *Config) newGenerationsCmd() *cobra.Command {
+	generationsCmd := &cobra.Command{
+		Use:     "generations",
+		Short:   "List generations",
+		Long:    mustLongHelp("generations"),
+		Example: example("generations"),
+		Args:    cobra.NoArgs,
+		RunE:    c.runGenerationsCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+
+	return generationsCmd
+}
+
+func (c *Config) runGenerationsCmd(cmd *cobra.Command, args []string) error {
+	generations, err := chezmoi.Generations(c.persistentState)
+	if err != nil {
+		return err
+	}
+
+	var builder strings.Builder
+	for _, generation := range generations {
+		sourceCommit := "-"
+		if generation.SourceCommit != "" {
+			sourceCommit = generation.SourceCommit[:min(len(generation.SourceCommit), 7)]
+		}
+		fmt.Fprintf(&builder, "%d %s %s %s %d\n",
+			generation.Number,
+			generation.Time.Local().Format(time.RFC3339),
+			generation.Command,
+			sourceCommit,
+			len(generation.Entries),
+		)
+	}
+	return c.writeOutputString(builder.String())
+}
+
+// sourceCommit returns the commit checked out in the working tree, or the
+// empty string if it cannot be determined.
+func (c *Config) sourceCommit() string {
+	rawWorkingTreeAbsPath, err := c.baseSystem.RawPath(c.WorkingTreeAbsPath)
+	if err != nil {
+		return ""
+	}
+	repo, err := git.PlainOpen(rawWorkingTreeAbsPath.String())
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
@@ -24,12 +24,15 @@ var helps = map[string]*help{
 			"  chezmoi add ~/.bashrc\n" +
 			"  chezmoi add ~/.gitconfig --template\n" +
 			"  chezmoi add ~/.ssh/id_rsa --encrypt\n" +
+			"  chezmoi add ~/.aws/credentials --encrypt-secrets\n" +
+			"  chezmoi add ~/.aws/credentials --store-secrets=pass\n" +
 			"  chezmoi add ~/.vim --recursive\n" +
 			"  chezmoi add ~/.oh-my-zsh --exact --recursive",
 		longFlags: chezmoiset.New(
 			"autotemplate",
 			"create",
 			"encrypt",
+			"encrypt-secrets",
 			"exact",
 			"exclude",
 			"follow",
@@ -39,6 +42,7 @@ var helps = map[string]*help{
 			"quiet",
 			"recursive",
 			"secrets",
+			"store-secrets",
 			"template",
 			"template-symlinks",
 		),
@@ -71,18 +75,31 @@ var helps = map[string]*help{
 		example: "" +
 			"  chezmoi apply\n" +
 			"  chezmoi apply --dry-run --verbose\n" +
-			"  chezmoi apply ~/.bashrc",
+			"  chezmoi apply ~/.bashrc\n" +
+			"  chezmoi apply --atomic\n" +
+			"  chezmoi apply --on-conflict=fail\n" +
+			"  chezmoi apply --patch ~/.bashrc\n" +
+			"  chezmoi apply --plan plan.json\n" +
+			"  chezmoi apply --keep-going\n" +
+			"  chezmoi apply --retry-failed",
 		longFlags: chezmoiset.New(
+			"atomic",
+			"events-fd",
 			"exclude",
 			"include",
 			"init",
+			"on-conflict",
 			"parent-dirs",
+			"patch",
+			"plan",
 			"recursive",
+			"retry-failed",
 			"source-path",
 		),
 		shortFlags: chezmoiset.New(
 			"P",
 			"i",
+			"p",
 			"r",
 			"x",
 		),
@@ -114,6 +131,27 @@ var helps = map[string]*help{
 			"z",
 		),
 	},
+	"backup": {
+		longHelp: "" +
+			"Description:\n" +
+			"  Manage backups of overwritten and removed targets.\n" +
+			"\n" +
+			"  When backup.enabled is true, which is the default, chezmoi backs up every\n" +
+			"  file, directory, and symlink in the destination directory before apply,\n" +
+			"  update, and other commands overwrite or remove it, for example because the\n" +
+			"  target had local modifications or because it is not in an exact_ directory.\n" +
+			"  Backups include the target's contents, mode, and symlink target. Contents\n" +
+			"  are stored in the backup subdirectory of the cache directory, named by their\n" +
+			"  SHA256 sums, so identical contents are only stored once. Backups are not\n" +
+			"  made when chezmoi is run with --dry-run.",
+		example: "" +
+			"  chezmoi backup list\n" +
+			"  chezmoi backup list ~/.bashrc\n" +
+			"  chezmoi backup show $ID\n" +
+			"  chezmoi backup restore ~/.bashrc\n" +
+			"  chezmoi backup restore $ID\n" +
+			"  chezmoi backup prune --max-age=168h",
+	},
 	"cat": {
 		longHelp: "" +
 			"Description:\n" +
@@ -266,6 +304,7 @@ var helps = map[string]*help{
 			"  chezmoi diff\n" +
 			"  chezmoi diff ~/.bashrc",
 		longFlags: chezmoiset.New(
+			"events-fd",
 			"exclude",
 			"include",
 			"init",
@@ -386,6 +425,26 @@ var helps = map[string]*help{
 			"  encrypt the standard input. The encrypted result is written to the standard\n" +
 			"  output or a file if the --output flag is set.",
 	},
+	"encrypt-inline": {
+		longHelp: "" +
+			"Description:\n" +
+			"  Read a secret from the terminal, encrypt it using chezmoi's configured\n" +
+			"  encryption, and print a template action that decrypts it, for example {{\n" +
+			"  decrypt \"-----BEGIN AGE ENCRYPTED FILE-----\\n...\" }}. This allows a single\n" +
+			"  secret to\n" +
+			"  be stored in an otherwise plaintext template.\n" +
+			"\n" +
+			"  If target is given, then instead of printing the template action, replace\n" +
+			"  every occurrence of the secret in target's source template with it. target\n" +
+			"  must be a template and must not be encrypted.",
+		example: "" +
+			"  chezmoi encrypt-inline\n" +
+			"  chezmoi encrypt-inline ~/.netrc\n" +
+			"  chezmoi encrypt-inline --placeholder=GITHUB_TOKEN ~/.config/gh/hosts.yml",
+		longFlags: chezmoiset.New(
+			"placeholder",
+		),
+	},
 	"execute-template": {
 		longHelp: "" +
 			"Description:\n" +
@@ -441,6 +500,20 @@ var helps = map[string]*help{
 			"  chezmoi generate install.sh > install.sh\n" +
 			"  chezmoi git commit -m \"$(chezmoi generate git-commit-message)\"",
 	},
+	"generations": {
+		longHelp: "" +
+			"Description:\n" +
+			"  List generations. Every run of a command that modifies the destination\n" +
+			"  directory, for example apply or update, that changes at least one target is\n" +
+			"  recorded as a generation. Each generation records the time, the command, the\n" +
+			"  commit checked out in the source directory, and the state of each changed\n" +
+			"  target before and after the command.\n" +
+			"\n" +
+			"  Each line of output contains the generation's number, time, command, source\n" +
+			"  commit, and number of changed targets.\n" +
+			"\n" +
+			"  Generations can be rolled back with rollback /rollback.md.",
+	},
 	"git": {
 		longHelp: "" +
 			"Description:\n" +
@@ -650,7 +723,13 @@ var helps = map[string]*help{
 			"  .Destination }}, {{ .Source }}, and {{ .Target }} will be appended\n" +
 			"  automatically.",
 		example: "" +
-			"  chezmoi merge ~/.bashrc",
+			"  chezmoi merge ~/.bashrc\n" +
+			"  chezmoi merge --builtin ~/.bashrc\n" +
+			"  chezmoi merge --non-interactive ~/.bashrc",
+		longFlags: chezmoiset.New(
+			"builtin",
+			"non-interactive",
+		),
 	},
 	"merge-all": {
 		longHelp: "" +
@@ -658,15 +737,48 @@ var helps = map[string]*help{
 			"  Perform a three-way merge for file whose actual state does not match its\n" +
 			"  target state. The merge is performed with chezmoi merge.",
 		example: "" +
-			"  chezmoi merge-all",
+			"  chezmoi merge-all\n" +
+			"  chezmoi merge-all --non-interactive",
 		longFlags: chezmoiset.New(
+			"builtin",
 			"init",
+			"non-interactive",
 			"recursive",
 		),
 		shortFlags: chezmoiset.New(
 			"r",
 		),
 	},
+	"plan": {
+		longHelp: "" +
+			"Description:\n" +
+			"  Record the changes that chezmoi apply would make to target..., or to all\n" +
+			"  targets if no targets are given, as a JSON plan. The plan can be reviewed\n" +
+			"  and then applied later with chezmoi apply --plan, which applies exactly the\n" +
+			"  changes in the plan.\n" +
+			"\n" +
+			"  For each target that would change, the plan records the target's current\n" +
+			"  state (actual) and its state after the change (target), as a type, mode, and\n" +
+			"  SHA256 sum of its contents. Scripts that would run are recorded with their\n" +
+			"  contents' SHA256 sum. Targets from externals record the external that they\n" +
+			"  are fetched from.\n" +
+			"\n" +
+			"  Use the -o/--output option to write the plan to a file.",
+		example: "" +
+			"  chezmoi plan -o plan.json\n" +
+			"  chezmoi apply --plan plan.json",
+		longFlags: chezmoiset.New(
+			"exclude",
+			"include",
+			"init",
+			"recursive",
+		),
+		shortFlags: chezmoiset.New(
+			"i",
+			"r",
+			"x",
+		),
+	},
 	"purge": {
 		longHelp: "" +
 			"Description:\n" +
@@ -687,8 +799,15 @@ var helps = map[string]*help{
 		longHelp: "" +
 			"Description:\n" +
 			"  Re-add modified files in the target state, preserving any encrypted_\n" +
-			"  attributes. chezmoi will not overwrite templates, and all entries that are\n" +
-			"  not files are ignored. Directories are recursed into by default.\n" +
+			"  attributes. All entries that are not files are ignored. Directories are\n" +
+			"  recursed into by default.\n" +
+			"\n" +
+			"  For templates, chezmoi compares the destination file with the template's\n" +
+			"  output. Changes that fall entirely within the template's literal text are\n" +
+			"  applied to the template automatically. Changes that touch template actions\n" +
+			"  are printed and chezmoi prompts you to edit the template to resolve them. If --\n" +
+			"  force is given, these changes are not re-added. Templates containing\n" +
+			"  chezmoi:template: directives are always resolved by editing.\n" +
 			"\n" +
 			"  If no targets are specified then all modified files are re-added. If one or\n" +
 			"  more targets are given then only those targets are re-added.",
@@ -719,6 +838,40 @@ var helps = map[string]*help{
 			"  The rm command has been removed. Use the forget command or the destroy\n" +
 			"  command instead.",
 	},
+	"rollback": {
+		longHelp: "" +
+			"Description:\n" +
+			"  Restore every target changed since generation to its state after generation.\n" +
+			"  If generation is not given, undo the most recent generation. Generation 0 is\n" +
+			"  the state before the first generation. See generations /generations.md for a\n" +
+			"  list of generations.\n" +
+			"\n" +
+			"  The contents of files are restored from backups /backup.md, so files can\n" +
+			"  only be rolled back while their backups are kept.\n" +
+			"\n" +
+			"  Targets that have been changed outside chezmoi since the most recent\n" +
+			"  generation, and directories that contain them, are reported and not rolled\n" +
+			"  back, unless --force is given. In this case, chezmoi exits with a non-zero\n" +
+			"  status.\n" +
+			"\n" +
+			"  The rollback is itself recorded as a new generation, so it can also be\n" +
+			"  rolled back.",
+		example: "" +
+			"  chezmoi rollback\n" +
+			"  chezmoi rollback 3\n" +
+			"  chezmoi rollback --force 0",
+	},
+	"script": {
+		longHelp: "" +
+			"Description:\n" +
+			"  Manage scripts.",
+		example: "" +
+			"  chezmoi script list\n" +
+			"  chezmoi script log\n" +
+			"  chezmoi script log install-packages.sh\n" +
+			"  chezmoi script mark-not-run install-packages.sh\n" +
+			"  chezmoi script mark-run install-packages.sh",
+	},
 	"secret": {
 		longHelp: "" +
 			"Description:\n" +
@@ -729,7 +882,10 @@ var helps = map[string]*help{
 		example: "" +
 			"  chezmoi secret keyring set --service=service --user=user --value=password\n" +
 			"  chezmoi secret keyring get --service=service --user=user\n" +
-			"  chezmoi secret keyring delete --service=service --user=user",
+			"  chezmoi secret keyring delete --service=service --user=user\n" +
+			"  chezmoi secret refs\n" +
+			"  chezmoi secret refs onepassword\n" +
+			"  chezmoi secret reapply pass work/github-token",
 	},
 	"source-path": {
 		longHelp: "" +
@@ -771,10 +927,21 @@ var helps = map[string]*help{
 			"   A            | Added       | Entry was created  | Entry will be created\n" +
 			"   D            | Deleted     | Entry was deleted  | Entry will be deleted\n" +
 			"   M            | Modified    | Entry was modified | Entry will be modified\n" +
-			"   R            | Run         | Not applicable     | Script will be run",
+			"   R            | Run         | Not applicable     | Script will be run\n" +
+			"   C            | Conflict    | Not applicable     | Entry has a conflict\n" +
+			"   F            | Failed      | Last apply failed  | Not applicable\n" +
+			"\n" +
+			"  An entry has a conflict if it was changed in the destination directory and\n" +
+			"  its target state has also changed since chezmoi last wrote it. See chezmoi\n" +
+			"  apply --on-conflict.\n" +
+			"\n" +
+			"  Targets that failed to apply in the last run of chezmoi apply are marked\n" +
+			"  with F in the first column and can be retried with chezmoi apply --retry-\n" +
+			"  failed.",
 		example: "" +
 			"  chezmoi status",
 		longFlags: chezmoiset.New(
+			"events-fd",
 			"exclude",
 			"include",
 			"init",
@@ -838,6 +1005,7 @@ var helps = map[string]*help{
 			"  chezmoi update",
 		longFlags: chezmoiset.New(
 			"apply",
+			"events-fd",
 			"exclude",
 			"include",
 			"init",
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// A hookPayload describes what happened during a command. It is passed to
+// hooks as JSON on their standard input, or in the file named by
+// $CHEZMOI_HOOK_PAYLOAD, and summarized in environment variables.
+type hookPayload struct {
+	Event   string              `json:"event"`
+	Phase   string              `json:"phase"`
+	Command string              `json:"command"`
+	Args    []string            `json:"args"`
+	DryRun  bool                `json:"dryRun"`
+	Targets []hookPayloadTarget `json:"targets"`
+	Scripts []string            `json:"scripts"`
+	Errors  []string            `json:"errors"`
+}
+
+// A hookPayloadTarget describes a target that was created, modified, or
+// removed.
+type hookPayloadTarget struct {
+	Path    string                 `json:"path"`
+	Action  string                 `json:"action"`
+	OldType chezmoi.EntryStateType `json:"oldType,omitempty"`
+	OldMode string                 `json:"oldMode,omitempty"`
+	NewType chezmoi.EntryStateType `json:"newType,omitempty"`
+	NewMode string                 `json:"newMode,omitempty"`
+}
+
+// Hook payload target actions.
+const (
+	hookPayloadActionCreated  = "created"
+	hookPayloadActionModified = "modified"
+	hookPayloadActionRemoved  = "removed"
+)
+
+// recordChange records that the target at targetAbsPath was changed from
+// actualEntryState to targetEntryState.
+func (p *hookPayload) recordChange(targetAbsPath chezmoi.AbsPath, targetEntryState, actualEntryState *chezmoi.EntryState) {
+	if targetEntryState.Type == chezmoi.EntryStateTypeScript {
+		p.Scripts = append(p.Scripts, targetAbsPath.String())
+		return
+	}
+	target := hookPayloadTarget{
+		Path:   targetAbsPath.String(),
+		Action: hookPayloadActionModified,
+	}
+	if actualEntryState == nil || actualEntryState.Type == chezmoi.EntryStateTypeRemove {
+		target.Action = hookPayloadActionCreated
+	} else {
+		target.OldType = actualEntryState.Type
+		target.OldMode = hookPayloadMode(actualEntryState.Mode)
+	}
+	if targetEntryState.Type == chezmoi.EntryStateTypeRemove {
+		target.Action = hookPayloadActionRemoved
+	} else {
+		target.NewType = targetEntryState.Type
+		target.NewMode = hookPayloadMode(targetEntryState.Mode)
+	}
+	p.Targets = append(p.Targets, target)
+}
+
+// environ returns the environment variables that summarize p.
+func (p *hookPayload) environ() []string {
+	var created, modified, removed []string
+	for _, target := range p.Targets {
+		switch target.Action {
+		case hookPayloadActionCreated:
+			created = append(created, target.Path)
+		case hookPayloadActionModified:
+			modified = append(modified, target.Path)
+		case hookPayloadActionRemoved:
+			removed = append(removed, target.Path)
+		}
+	}
+	return []string{
+		"CHEZMOI_HOOK_EVENT=" + p.Event,
+		"CHEZMOI_HOOK_PHASE=" + p.Phase,
+		"CHEZMOI_HOOK_CREATED=" + strings.Join(created, "\n"),
+		"CHEZMOI_HOOK_MODIFIED=" + strings.Join(modified, "\n"),
+		"CHEZMOI_HOOK_REMOVED=" + strings.Join(removed, "\n"),
+		"CHEZMOI_HOOK_SCRIPTS=" + strings.Join(p.Scripts, "\n"),
+		"CHEZMOI_HOOK_ERRORS=" + strings.Join(p.Errors, "\n"),
+	}
+}
+
+// hookPayloadMode returns mode's permission bits as an octal string, or the
+// empty string if mode has no permission bits.
+func hookPayloadMode(mode fs.FileMode) string {
+	if mode.Perm() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04o", mode.Perm())
+}
@@ -197,6 +197,13 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Re-read the source directory's hooks, as they might have been read
+	// before the source directory was cloned or the config file was created.
+	c.sourceHooksLoaded = false
+	if err := c.loadSourceHooks(cmd); err != nil {
+		return err
+	}
+
 	if c.Git.LFS && !useBuiltinGit {
 		args := []string{"lfs", "pull"}
 		if err := c.run(chezmoi.EmptyAbsPath, c.Git.Command, args); err != nil {
@@ -209,6 +216,7 @@ func (c *Config) runInitCmd(cmd *cobra.Command, args []string) error {
 		if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, noArgs, applyArgsOptions{
 			cmd:          cmd,
 			filter:       c.init.filter,
+			packages:     true,
 			recursive:    false,
 			umask:        c.Umask,
 			preApplyFunc: c.defaultPreApplyFunc,
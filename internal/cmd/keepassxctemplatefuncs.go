@@ -194,6 +194,39 @@ func (c *Config) keepassxcOutputCachePassword(command string, args ...string) ([
 	return output, nil
 }
 
+// keepassxcAdd adds entry with password to the database, prompting the user for
+// the database password if needed.
+func (c *Config) keepassxcAdd(entry, password string) error {
+	if c.Keepassxc.Database.IsEmpty() {
+		return errors.New("keepassxc.database not set")
+	}
+
+	cmdArgs := []string{"add"}
+	cmdArgs = append(cmdArgs, c.Keepassxc.Args...)
+	cmdArgs = append(cmdArgs, c.Keepassxc.Database.String(), "--password-prompt", entry)
+	cmd := exec.Command(c.Keepassxc.Command, cmdArgs...)
+	if c.Keepassxc.password == "" && c.Keepassxc.Prompt {
+		databasePassword, err := c.readPassword(fmt.Sprintf("Enter password to unlock %s: ", c.Keepassxc.Database), "password")
+		if err != nil {
+			return err
+		}
+		c.Keepassxc.password = databasePassword
+	}
+	stdin := &bytes.Buffer{}
+	if c.Keepassxc.password != "" {
+		stdin.WriteString(c.Keepassxc.password + "\n")
+	}
+	stdin.WriteString(password + "\n")
+	cmd.Stdin = stdin
+	cmd.Stderr = os.Stderr
+
+	output, err := chezmoilog.LogCmdOutput(c.logger, cmd)
+	if err != nil {
+		return newCmdOutputError(cmd, output, err)
+	}
+	return nil
+}
+
 // keepassxcOutputOpen returns the output of command and args using an
 // interactive connection via keepassxc-cli open command's interactive console.
 func (c *Config) keepassxcOutputOpen(command string, args ...string) ([]byte, error) {
@@ -37,3 +37,10 @@ func (c *Config) keyringTemplateFunc(service, user string) string {
 	c.keyring.cache[key] = password
 	return password
 }
+
+func (c *Config) keyringSet(service, user, password string) error {
+	if err := keyring.Set(service, user, password); err != nil {
+		return fmt.Errorf("%s %s: %w", service, user, err)
+	}
+	return nil
+}
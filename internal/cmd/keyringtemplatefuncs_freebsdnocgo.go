@@ -2,8 +2,14 @@
 
 package cmd
 
+import "errors"
+
 type keyringData struct{}
 
 func (c *Config) keyringTemplateFunc(service, user string) string {
 	return ""
 }
+
+func (c *Config) keyringSet(service, user, password string) error {
+	return errors.New("keyring not supported")
+}
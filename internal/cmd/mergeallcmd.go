@@ -28,7 +28,10 @@ func (c *Config) newMergeAllCmd() *cobra.Command {
 		),
 	}
 
+	mergeAllCmd.Flags().BoolVar(&c.Merge.Builtin, "builtin", c.Merge.Builtin, "Use the built-in merge")
 	mergeAllCmd.Flags().BoolVar(&c.mergeAll.init, "init", c.mergeAll.init, "Recreate config file from template")
+	mergeAllCmd.Flags().
+		BoolVar(&c.Merge.nonInteractive, "non-interactive", c.Merge.nonInteractive, "Use the built-in merge without prompting")
 	mergeAllCmd.Flags().BoolVarP(&c.mergeAll.recursive, "recursive", "r", c.mergeAll.recursive, "Recurse into subdirectories")
 
 	return mergeAllCmd
@@ -58,12 +61,5 @@ func (c *Config) runMergeAllCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	for _, targetRelPath := range targetRelPaths {
-		sourceStateEntry := sourceState.MustEntry(targetRelPath)
-		if err := c.doMerge(targetRelPath, sourceStateEntry); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return c.mergeTargets(sourceState, targetRelPaths)
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -14,8 +16,21 @@ import (
 )
 
 type mergeCmdConfig struct {
-	Command string   `json:"command" mapstructure:"command" yaml:"command"`
-	Args    []string `json:"args"    mapstructure:"args"    yaml:"args"`
+	Command        string   `json:"command" mapstructure:"command" yaml:"command"`
+	Args           []string `json:"args"    mapstructure:"args"    yaml:"args"`
+	Builtin        bool     `json:"builtin" mapstructure:"builtin" yaml:"builtin"`
+	nonInteractive bool
+}
+
+// A mergeConflictError is returned when a built-in merge has conflicts that
+// cannot be resolved automatically.
+type mergeConflictError struct {
+	targetRelPath chezmoi.RelPath
+	conflicts     int
+}
+
+func (e *mergeConflictError) Error() string {
+	return fmt.Sprintf("%s: %d unresolved conflicts", e.targetRelPath, e.conflicts)
 }
 
 func (c *Config) newMergeCmd() *cobra.Command {
@@ -34,6 +49,10 @@ func (c *Config) newMergeCmd() *cobra.Command {
 		),
 	}
 
+	mergeCmd.Flags().BoolVar(&c.Merge.Builtin, "builtin", c.Merge.Builtin, "Use the built-in merge")
+	mergeCmd.Flags().
+		BoolVar(&c.Merge.nonInteractive, "non-interactive", c.Merge.nonInteractive, "Use the built-in merge without prompting")
+
 	return mergeCmd
 }
 
@@ -46,13 +65,28 @@ func (c *Config) runMergeCmd(cmd *cobra.Command, args []string, sourceState *che
 		return err
 	}
 
+	return c.mergeTargets(sourceState, targetRelPaths)
+}
+
+// mergeTargets merges each of targetRelPaths. Unresolved conflicts from the
+// built-in merge are reported and do not stop later targets from being
+// merged.
+func (c *Config) mergeTargets(sourceState *chezmoi.SourceState, targetRelPaths []chezmoi.RelPath) error {
+	unresolved := false
 	for _, targetRelPath := range targetRelPaths {
 		sourceStateEntry := sourceState.MustEntry(targetRelPath)
-		if err := c.doMerge(targetRelPath, sourceStateEntry); err != nil {
+		var conflictErr *mergeConflictError
+		switch err := c.doMerge(targetRelPath, sourceStateEntry); {
+		case errors.As(err, &conflictErr):
+			c.errorf("%v\n", err)
+			unresolved = true
+		case err != nil:
 			return err
 		}
 	}
-
+	if unresolved {
+		return chezmoi.ExitCodeError(1)
+	}
 	return nil
 }
 
@@ -60,6 +94,10 @@ func (c *Config) runMergeCmd(cmd *cobra.Command, args []string, sourceState *che
 // three-way merge between the destination, source, and target, including
 // transparently decrypting the file in the source state.
 func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi.SourceStateEntry) (err error) {
+	if c.Merge.Builtin || c.Merge.nonInteractive {
+		return c.doBuiltinMerge(targetRelPath, sourceStateEntry, !c.Merge.nonInteractive)
+	}
+
 	sourceAbsPath := c.SourceDirAbsPath.Join(sourceStateEntry.SourceRelPath().RelPath())
 
 	// If the source state entry is an encrypted file, then decrypt it to a
@@ -190,3 +228,181 @@ func (c *Config) doMerge(targetRelPath chezmoi.RelPath, sourceStateEntry chezmoi
 
 	return nil
 }
+
+// doBuiltinMerge performs a three-way merge between the destination and the
+// target using the contents that chezmoi last wrote as the base, and writes
+// the result to the source state. If there are conflicts and interactive is
+// true then the user is asked to resolve them in their editor, otherwise a
+// *mergeConflictError is returned.
+func (c *Config) doBuiltinMerge(
+	targetRelPath chezmoi.RelPath,
+	sourceStateEntry chezmoi.SourceStateEntry,
+	interactive bool,
+) (err error) {
+	sourceStateFile, ok := sourceStateEntry.(*chezmoi.SourceStateFile)
+	switch {
+	case !ok || sourceStateFile.Attr.Type != chezmoi.SourceFileTypeFile:
+		return fmt.Errorf("%s: not a file", targetRelPath)
+	case sourceStateFile.Attr.Template:
+		return fmt.Errorf("%s: cannot merge into a template", targetRelPath)
+	}
+	targetAbsPath := c.DestDirAbsPath.Join(targetRelPath)
+	targetStateEntry, err := sourceStateEntry.TargetStateEntry(c.destSystem, targetAbsPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+	targetStateFile, ok := targetStateEntry.(*chezmoi.TargetStateFile)
+	if !ok {
+		return fmt.Errorf("%s: not a file", targetRelPath)
+	}
+	targetContents, err := targetStateFile.Contents()
+	if err != nil {
+		return err
+	}
+
+	actualStateEntry, err := chezmoi.NewActualStateEntry(c.destSystem, targetAbsPath, nil, nil)
+	if err != nil {
+		return err
+	}
+	actualStateFile, ok := actualStateEntry.(*chezmoi.ActualStateFile)
+	if !ok {
+		return fmt.Errorf("%s: not a file", targetRelPath)
+	}
+	destContents, err := actualStateFile.Contents()
+	if err != nil {
+		return err
+	}
+
+	var lastWrittenEntryState *chezmoi.EntryState
+	var entryState chezmoi.EntryState
+	switch ok, err := chezmoi.PersistentStateGet(c.persistentState, chezmoi.EntryStateBucket, targetAbsPath.Bytes(), &entryState); {
+	case err != nil:
+		return err
+	case ok:
+		lastWrittenEntryState = &entryState
+	}
+	baseContents, err := chezmoi.MergeBase(c.persistentState, targetAbsPath, lastWrittenEntryState, c.encryption)
+	if err != nil {
+		return err
+	}
+
+	mergedContents, conflicts := chezmoi.ThreeWayMerge(baseContents, destContents, targetContents, "destination", "target")
+	if conflicts > 0 {
+		if !interactive {
+			return &mergeConflictError{
+				targetRelPath: targetRelPath,
+				conflicts:     conflicts,
+			}
+		}
+		var tempDirAbsPath chezmoi.AbsPath
+		if tempDirAbsPath, err = c.tempDir("chezmoi-merge"); err != nil {
+			return err
+		}
+		mergedAbsPath := tempDirAbsPath.JoinString(targetRelPath.Base())
+		if err := c.baseSystem.WriteFile(mergedAbsPath, mergedContents, 0o600); err != nil {
+			return err
+		}
+		if err := c.runEditor([]string{mergedAbsPath.String()}); err != nil {
+			return err
+		}
+		if mergedContents, err = c.baseSystem.ReadFile(mergedAbsPath); err != nil {
+			return err
+		}
+		if chezmoi.HasConflictMarkers(mergedContents) {
+			return fmt.Errorf("%s: conflict markers remain", targetRelPath)
+		}
+	}
+
+	if !bytes.Equal(mergedContents, targetContents) {
+		if err := c.writeSourceFileContents(targetRelPath, sourceStateFile, mergedContents); err != nil {
+			return err
+		}
+	}
+
+	// The source state now includes the changes in the destination, so
+	// record the destination as the last written state.
+	if c.dryRun {
+		return nil
+	}
+	actualEntryState, err := actualStateEntry.EntryState()
+	if err != nil {
+		return err
+	}
+	if err := chezmoi.PersistentStateSet(c.persistentState, chezmoi.EntryStateBucket, targetAbsPath.Bytes(), actualEntryState); err != nil {
+		return err
+	}
+	storeMergeBase, encryptMergeBase := chezmoi.CanStoreMergeBase(sourceStateEntry)
+	if !storeMergeBase {
+		return c.persistentState.Delete(chezmoi.MergeBaseStateBucket, targetAbsPath.Bytes())
+	}
+	var mergeBaseEncryption chezmoi.Encryption
+	if encryptMergeBase {
+		mergeBaseEncryption = c.encryption
+	}
+	return chezmoi.SetMergeBase(c.persistentState, targetAbsPath, destContents, mergeBaseEncryption)
+}
+
+// writeSourceFileContents replaces the contents of sourceStateFile with
+// contents, encrypting them if sourceStateFile is encrypted.
+func (c *Config) writeSourceFileContents(
+	targetRelPath chezmoi.RelPath,
+	sourceStateFile *chezmoi.SourceStateFile,
+	contents []byte,
+) error {
+	if sourceStateFile.Attr.Template {
+		return fmt.Errorf("%s: cannot merge into a template", targetRelPath)
+	}
+	return c.replaceSourceFileContents(sourceStateFile, contents)
+}
+
+// replaceSourceFileContents replaces the contents of sourceStateFile with
+// contents, encrypting them if sourceStateFile is encrypted or re-encrypting
+// them with sops if sourceStateFile is a SOPS file. Unlike
+// writeSourceFileContents, it also replaces the contents of templates.
+func (c *Config) replaceSourceFileContents(sourceStateFile *chezmoi.SourceStateFile, contents []byte) error {
+	system := c.baseSystem
+	if c.dryRun {
+		system = chezmoi.NewDryRunSystem(system)
+	}
+
+	sourceAbsPath := c.SourceDirAbsPath.Join(sourceStateFile.SourceRelPath().RelPath())
+	fileInfo, err := system.Stat(sourceAbsPath)
+	if err != nil {
+		return err
+	}
+	if sourceStateFile.Attr.SOPS {
+		if contents, err = c.reencryptSOPS(system, sourceAbsPath, sourceStateFile, contents); err != nil {
+			return err
+		}
+	}
+	if sourceStateFile.Attr.Encrypted {
+		if contents, err = c.encryption.Encrypt(contents); err != nil {
+			return err
+		}
+	}
+	return system.WriteFile(sourceAbsPath, contents, fileInfo.Mode().Perm())
+}
+
+// reencryptSOPS returns the existing SOPS-encrypted contents of
+// sourceStateFile, at sourceAbsPath, re-encrypted with plaintext.
+func (c *Config) reencryptSOPS(
+	system chezmoi.System,
+	sourceAbsPath chezmoi.AbsPath,
+	sourceStateFile *chezmoi.SourceStateFile,
+	plaintext []byte,
+) ([]byte, error) {
+	ciphertext, err := system.ReadFile(sourceAbsPath)
+	if err != nil {
+		return nil, err
+	}
+	if sourceStateFile.Attr.Encrypted {
+		if ciphertext, err = c.encryption.Decrypt(ciphertext); err != nil {
+			return nil, err
+		}
+	}
+	contents, err := c.SOPS.Reencrypt(sourceStateFile.Attr.TargetName, ciphertext, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", sourceAbsPath, err)
+	}
+	return contents, nil
+}
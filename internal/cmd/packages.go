@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+	"github.com/twpayne/chezmoi/internal/chezmoilog"
+)
+
+type packageCmdConfig struct {
+	Command string   `json:"command" mapstructure:"command" yaml:"command"`
+	Args    []string `json:"args"    mapstructure:"args"    yaml:"args"`
+}
+
+type packageManagerConfig struct {
+	List    packageCmdConfig `json:"list"    mapstructure:"list"    yaml:"list"`
+	Install packageCmdConfig `json:"install" mapstructure:"install" yaml:"install"`
+}
+
+// installMissingPackages installs the packages in sourceState that are not
+// already installed, one package manager at a time in order of name.
+func (c *Config) installMissingPackages(sourceState *chezmoi.SourceState) error {
+	missingPackages, err := c.missingPackages(sourceState)
+	if err != nil {
+		return err
+	}
+	dirRawAbsPath, err := c.baseSystem.RawPath(c.homeDirAbsPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(missingPackages)) {
+		cmd := c.packageManager(name).InstallCmd(missingPackages[name])
+		if c.dryRun || c.Verbose {
+			c.errorf("packages %s: %s\n", name, shellQuoteCommand(cmd.Args[0], cmd.Args[1:]))
+		}
+		cmd.Dir = dirRawAbsPath.String()
+		cmd.Stdin = c.stdin
+		cmd.Stdout = c.stdout
+		cmd.Stderr = c.stderr
+		if err := c.destSystem.RunCmd(cmd); err != nil {
+			return fmt.Errorf("packages %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// missingPackages returns the packages in sourceState that are not installed,
+// indexed by package manager name. Each package manager is queried for its
+// installed packages, and package managers with no missing packages are
+// omitted.
+func (c *Config) missingPackages(sourceState *chezmoi.SourceState) (map[string][]string, error) {
+	missingPackages := make(map[string][]string)
+	for name, packages := range sourceState.Packages() {
+		if len(packages) == 0 {
+			continue
+		}
+		packageManager := c.packageManager(name)
+		output, err := chezmoilog.LogCmdOutput(c.logger, packageManager.ListCmd())
+		if err != nil {
+			return nil, fmt.Errorf("packages %s: %w", name, err)
+		}
+		installedPackages, err := packageManager.ParseListCmdOutput(output)
+		if err != nil {
+			return nil, fmt.Errorf("packages %w", err)
+		}
+		for _, pkg := range packages {
+			if !installedPackages.Contains(pkg) {
+				missingPackages[name] = append(missingPackages[name], pkg)
+			}
+		}
+	}
+	return missingPackages, nil
+}
+
+// packageManager returns the package manager with the given name, with the list
+// and install commands from the config file, if any.
+func (c *Config) packageManager(name string) *chezmoi.PackageManager {
+	packageManager := chezmoi.PackageManagerByName(name)
+	packageManagerConfig := c.Packages[name]
+	if packageManagerConfig.List.Command != "" {
+		packageManager = packageManager.WithListCmd(packageManagerConfig.List.Command, packageManagerConfig.List.Args)
+	}
+	if packageManagerConfig.Install.Command != "" {
+		packageManager = packageManager.WithInstallCmd(
+			packageManagerConfig.Install.Command,
+			packageManagerConfig.Install.Args,
+		)
+	}
+	return packageManager
+}
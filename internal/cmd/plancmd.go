@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// planVersion is the version of the plan file format.
+const planVersion = 1
+
+type planCmdConfig struct {
+	filter    *chezmoi.EntryTypeFilter
+	init      bool
+	recursive bool
+}
+
+// A plan records the changes that chezmoi apply would make so that exactly
+// those changes can be applied later.
+type plan struct {
+	Version      int          `json:"version"`
+	Time         time.Time    `json:"time"`
+	SourceCommit string       `json:"sourceCommit,omitempty"`
+	DestDir      string       `json:"destDir"`
+	Entries      []*planEntry `json:"entries"`
+}
+
+// A planEntry records a single change in a plan. Actual is the expected state
+// of the target before the change and Target is its state after the change.
+// Scripts have no expected state. External is the origin of targets from
+// externals.
+type planEntry struct {
+	Path     string              `json:"path"`
+	Actual   *chezmoi.EntryState `json:"actual,omitempty"`
+	Target   *chezmoi.EntryState `json:"target"`
+	External string              `json:"external,omitempty"`
+}
+
+// A planMismatchError is returned when a target no longer matches its plan.
+type planMismatchError struct {
+	targetRelPath chezmoi.RelPath
+	what          string
+}
+
+func (e *planMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s has changed since the plan was created", e.targetRelPath, e.what)
+}
+
+func (c *Config) newPlanCmd() *cobra.Command {
+	planCmd := &cobra.Command{
+		Use:               "plan [target]...",
+		Short:             "Record the changes that apply would make",
+		Long:              mustLongHelp("plan"),
+		Example:           example("plan"),
+		ValidArgsFunction: c.targetValidArgs,
+		RunE:              c.runPlanCmd,
+		Annotations: newAnnotations(
+			dryRun,
+			persistentStateModeReadMockWrite,
+			requiresSourceDirectory,
+		),
+	}
+
+	planCmd.Flags().VarP(c.plan.filter.Exclude, "exclude", "x", "Exclude entry types")
+	planCmd.Flags().VarP(c.plan.filter.Include, "include", "i", "Include entry types")
+	planCmd.Flags().BoolVar(&c.plan.init, "init", c.plan.init, "Recreate config file from template")
+	planCmd.Flags().BoolVarP(&c.plan.recursive, "recursive", "r", c.plan.recursive, "Recurse into subdirectories")
+
+	return planCmd
+}
+
+func (c *Config) runPlanCmd(cmd *cobra.Command, args []string) error {
+	p := &plan{
+		Version:      planVersion,
+		Time:         time.Now().UTC(),
+		SourceCommit: c.sourceCommit(),
+		DestDir:      c.DestDirAbsPath.String(),
+		Entries:      []*planEntry{},
+	}
+	preApplyFunc := func(targetRelPath chezmoi.RelPath, targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState) error {
+		entry := &planEntry{
+			Path:   targetRelPath.String(),
+			Target: targetEntryState,
+		}
+		switch {
+		case targetEntryState.Type == chezmoi.EntryStateTypeScript:
+		case targetEntryState.Equivalent(actualEntryState):
+			return fs.SkipDir
+		default:
+			entry.Actual = actualEntryState
+		}
+		if external, ok := c.sourceState.Get(targetRelPath).Origin().(*chezmoi.External); ok {
+			entry.External = external.OriginString()
+		}
+		p.Entries = append(p.Entries, entry)
+		return fs.SkipDir
+	}
+	if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
+		cmd:          cmd,
+		filter:       c.plan.filter,
+		init:         c.plan.init,
+		recursive:    c.plan.recursive,
+		umask:        c.Umask,
+		preApplyFunc: preApplyFunc,
+	}); err != nil {
+		return err
+	}
+	return c.marshal(formatJSON, p)
+}
+
+// readPlan reads the plan from the file at planAbsPath.
+func (c *Config) readPlan(planAbsPath chezmoi.AbsPath) (map[chezmoi.RelPath]*planEntry, error) {
+	data, err := c.baseSystem.ReadFile(planAbsPath)
+	if err != nil {
+		return nil, err
+	}
+	var p plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", planAbsPath, err)
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("%s: unsupported plan version %d", planAbsPath, p.Version)
+	}
+	if p.DestDir != c.DestDirAbsPath.String() {
+		return nil, fmt.Errorf("%s: plan is for destination directory %s", planAbsPath, p.DestDir)
+	}
+	if sourceCommit := c.sourceCommit(); p.SourceCommit != sourceCommit {
+		return nil, fmt.Errorf("%s: plan is for source commit %s, not %s", planAbsPath, cmp.Or(p.SourceCommit, "(none)"), cmp.Or(sourceCommit, "(none)"))
+	}
+	entries := make(map[chezmoi.RelPath]*planEntry, len(p.Entries))
+	for _, entry := range p.Entries {
+		if entry.Target == nil {
+			return nil, fmt.Errorf("%s: %s: missing target state", planAbsPath, entry.Path)
+		}
+		entries[chezmoi.NewRelPath(entry.Path)] = entry
+	}
+	return entries, nil
+}
+
+// checkPlanEntry returns an error if the target or actual entry states of
+// targetRelPath do not match entry.
+func checkPlanEntry(targetRelPath chezmoi.RelPath, entry *planEntry, targetEntryState, actualEntryState *chezmoi.EntryState) error {
+	if !entry.Target.Equivalent(targetEntryState) {
+		return &planMismatchError{
+			targetRelPath: targetRelPath,
+			what:          "source state",
+		}
+	}
+	if entry.Target.Type != chezmoi.EntryStateTypeScript && !entry.Actual.Equivalent(actualEntryState) {
+		return &planMismatchError{
+			targetRelPath: targetRelPath,
+			what:          "destination",
+		}
+	}
+	return nil
+}
+
+// runApplyPlan applies exactly the changes recorded in the plan at
+// planAbsPath. Every target in the plan is checked before any change is made.
+func (c *Config) runApplyPlan(cmd *cobra.Command, args []string, planAbsPath chezmoi.AbsPath) error {
+	if len(args) > 0 {
+		return errors.New("cannot specify targets with --plan")
+	}
+	planEntries, err := c.readPlan(planAbsPath)
+	if err != nil {
+		return err
+	}
+
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return err
+	}
+	targetRelPaths := slices.SortedFunc(maps.Keys(planEntries), chezmoi.CompareRelPaths)
+	for _, targetRelPath := range targetRelPaths {
+		sourceStateEntry := sourceState.Get(targetRelPath)
+		if sourceStateEntry == nil {
+			return &planMismatchError{
+				targetRelPath: targetRelPath,
+				what:          "source state",
+			}
+		}
+		targetAbsPath := c.DestDirAbsPath.Join(targetRelPath)
+		targetStateEntry, err := sourceStateEntry.TargetStateEntry(c.destSystem, targetAbsPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		targetEntryState, err := targetStateEntry.EntryState(c.Umask)
+		if err != nil {
+			return fmt.Errorf("%s: %w", targetRelPath, err)
+		}
+		actualStateEntry, err := chezmoi.NewActualStateEntry(c.destSystem, targetAbsPath, nil, nil)
+		if err != nil {
+			return err
+		}
+		actualEntryState, err := actualStateEntry.EntryState()
+		if err != nil {
+			return err
+		}
+		if err := checkPlanEntry(targetRelPath, planEntries[targetRelPath], targetEntryState, actualEntryState); err != nil {
+			return err
+		}
+	}
+
+	preApplyFunc := func(targetRelPath chezmoi.RelPath, targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState) error {
+		entry, ok := planEntries[targetRelPath]
+		if !ok {
+			return fs.SkipDir
+		}
+		return checkPlanEntry(targetRelPath, entry, targetEntryState, actualEntryState)
+	}
+	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, nil, applyArgsOptions{
+		cmd:          cmd,
+		filter:       chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+		recursive:    true,
+		umask:        c.Umask,
+		preApplyFunc: preApplyFunc,
+	})
+}
@@ -89,10 +89,12 @@ TARGET_REL_PATH:
 		if !ok {
 			continue
 		}
-		if sourceStateFile.Attr.Template {
+		if sourceStateFile.Attr.Type != chezmoi.SourceFileTypeFile {
 			continue
 		}
-		if sourceStateFile.Attr.Type != chezmoi.SourceFileTypeFile {
+		// Re-adding would replace SOPS files with plaintext, so do not re-add
+		// them. They can be edited with chezmoi edit.
+		if sourceStateFile.Attr.SOPS {
 			continue
 		}
 
@@ -125,12 +127,14 @@ TARGET_REL_PATH:
 			return err
 		}
 		if bytes.Equal(actualContents, targetContents) {
-			// On Windows, ignore permission changes as they are not preserved
-			// by the filesystem. On other systems, if there are no permission
-			// changes, continue.
+			// Only the contents of templates are re-added, so ignore
+			// permission changes to templates. On Windows, ignore permission
+			// changes as they are not preserved by the filesystem. On other
+			// systems, if there are no permission changes, continue.
 			//
 			// See https://github.com/twpayne/chezmoi/issues/3891.
-			if runtime.GOOS == "windows" || actualStateFile.Perm() == targetStateFile.Perm(c.Umask) {
+			if sourceStateFile.Attr.Template || runtime.GOOS == "windows" ||
+				actualStateFile.Perm() == targetStateFile.Perm(c.Umask) {
 				continue
 			}
 		}
@@ -166,6 +170,13 @@ TARGET_REL_PATH:
 			}
 		}
 
+		if sourceStateFile.Attr.Template {
+			if err := c.reAddTemplate(sourceState, targetRelPath, sourceStateFile, actualContents); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// On Windows, as the file mode is not preserved by the filesystem, copy
 		// the existing mode from the target file. Hack this in by replacing the
 		// io/fs.FileInfo of the destination file with a new io/fs.FileInfo with
@@ -196,3 +207,79 @@ TARGET_REL_PATH:
 
 	return nil
 }
+
+// reAddTemplate re-adds actualContents to the template sourceStateFile.
+// Changes to the template's literal text are applied automatically. Changes
+// that touch template actions are shown and the user can edit the template to
+// resolve them.
+func (c *Config) reAddTemplate(
+	sourceState *chezmoi.SourceState,
+	targetRelPath chezmoi.RelPath,
+	sourceStateFile *chezmoi.SourceStateFile,
+	actualContents []byte,
+) error {
+	data, err := sourceStateFile.Contents()
+	if err != nil {
+		return err
+	}
+	result, err := sourceState.ReAddTemplateData(chezmoi.ExecuteTemplateDataOptions{
+		Name:        sourceStateFile.SourceRelPath().String(),
+		Destination: c.DestDirAbsPath.Join(targetRelPath).String(),
+		Data:        data,
+	}, actualContents)
+	if err != nil {
+		return fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+	contents := result.Data
+
+	if len(result.Unresolved) > 0 {
+		renderedLines := chezmoi.SplitLines(string(result.Rendered))
+		offset := 0
+		for _, hunk := range result.Unresolved {
+			if err := c.writeOutputString(formatHunk(renderedLines, hunk, offset)); err != nil {
+				return err
+			}
+			offset += len(hunk.Lines) - (hunk.End - hunk.Start)
+		}
+		if c.force {
+			c.errorf("warning: %s: %d changes touch template actions, not re-adding them\n", targetRelPath, len(result.Unresolved))
+		} else {
+			prompt := fmt.Sprintf("%s: %d changes touch template actions, edit template", targetRelPath, len(result.Unresolved))
+			switch choice, err := c.promptChoice(prompt, []string{"edit", "skip", "quit"}); {
+			case err != nil:
+				return err
+			case choice == "edit":
+				if contents, err = c.editTemplate(targetRelPath, contents); err != nil {
+					return err
+				}
+			case choice == "skip":
+			case choice == "quit":
+				return chezmoi.ExitCodeError(0)
+			default:
+				panic(choice + ": unexpected choice")
+			}
+		}
+	}
+
+	if bytes.Equal(contents, data) {
+		return nil
+	}
+	return c.replaceSourceFileContents(sourceStateFile, contents)
+}
+
+// editTemplate lets the user edit data, the template for targetRelPath, and
+// returns the result.
+func (c *Config) editTemplate(targetRelPath chezmoi.RelPath, data []byte) ([]byte, error) {
+	tempDirAbsPath, err := c.tempDir("chezmoi-re-add")
+	if err != nil {
+		return nil, err
+	}
+	templateAbsPath := tempDirAbsPath.JoinString(targetRelPath.Base())
+	if err := c.baseSystem.WriteFile(templateAbsPath, data, 0o600); err != nil {
+		return nil, err
+	}
+	if err := c.runEditor([]string{templateAbsPath.String()}); err != nil {
+		return nil, err
+	}
+	return c.baseSystem.ReadFile(templateAbsPath)
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+// errContentsNotAvailable is returned when the contents of a file to roll back
+// to are no longer stored.
+var errContentsNotAvailable = errors.New("contents no longer available")
+
+func (c *Config) newRollbackCmd() *cobra.Command {
+	rollbackCmd := &cobra.Command{
+		Use:     "rollback [generation]",
+		Short:   "Roll back targets to a previous generation",
+		Long:    mustLongHelp("rollback"),
+		Example: example("rollback"),
+		Args:    cobra.MaximumNArgs(1),
+		RunE:    c.runRollbackCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeReadWrite,
+		),
+	}
+
+	return rollbackCmd
+}
+
+func (c *Config) runRollbackCmd(cmd *cobra.Command, args []string) error {
+	generations, err := chezmoi.Generations(c.persistentState)
+	if err != nil {
+		return err
+	}
+	if len(generations) == 0 {
+		return errors.New("no generations")
+	}
+	latestNumber := generations[len(generations)-1].Number
+
+	// Generations before the oldest generation may have been pruned, so the
+	// state after them is no longer known.
+	number := latestNumber - 1
+	if len(args) > 0 {
+		if number, err = strconv.Atoi(args[0]); err != nil || number < generations[0].Number-1 || number >= latestNumber {
+			return fmt.Errorf("%s: invalid generation", args[0])
+		}
+	}
+
+	// Combine all generations after number into a single set of changes from
+	// the state after generation number to the current state.
+	changes := chezmoi.NewGeneration("", "", nil)
+	for _, generation := range generations {
+		if generation.Number <= number {
+			continue
+		}
+		for targetAbsPath, entry := range generation.Entries {
+			entry := *entry
+			changes.Record(targetAbsPath, &entry)
+		}
+	}
+	targetAbsPaths := slices.Sorted(maps.Keys(changes.Entries))
+
+	// Find targets that were changed outside chezmoi, and the targets that
+	// contain them.
+	actualStateEntries := make(map[chezmoi.AbsPath]chezmoi.ActualStateEntry, len(targetAbsPaths))
+	var changedTargetAbsPaths []chezmoi.AbsPath
+	for _, targetAbsPath := range targetAbsPaths {
+		actualStateEntry, err := chezmoi.NewActualStateEntry(c.destSystem, targetAbsPath, nil, nil)
+		if err != nil {
+			return err
+		}
+		actualEntryState, err := actualStateEntry.EntryState()
+		if err != nil {
+			return err
+		}
+		if !c.force && !changes.Entries[targetAbsPath].After.Equivalent(actualEntryState) {
+			changedTargetAbsPaths = append(changedTargetAbsPaths, targetAbsPath)
+		}
+		actualStateEntries[targetAbsPath] = actualStateEntry
+	}
+	isChanged := func(targetAbsPath chezmoi.AbsPath) bool {
+		prefix := targetAbsPath.String() + "/"
+		return slices.ContainsFunc(changedTargetAbsPaths, func(changedTargetAbsPath chezmoi.AbsPath) bool {
+			return changedTargetAbsPath == targetAbsPath || strings.HasPrefix(changedTargetAbsPath.String(), prefix)
+		})
+	}
+
+	backupStore := c.newBackupStore()
+	system := c.destSystem
+	var rollbackBackupStore *chezmoi.BackupStore
+	if c.Backup.Enabled {
+		system = chezmoi.NewBackupSystem(system, backupStore)
+		rollbackBackupStore = backupStore
+	}
+
+	rollback := chezmoi.NewGeneration(cmd.Name(), c.sourceCommit(), rollbackBackupStore)
+	skipped := false
+	for _, targetAbsPath := range targetAbsPaths {
+		entry := changes.Entries[targetAbsPath]
+		if isChanged(targetAbsPath) {
+			c.errorf("%s: changed outside chezmoi since generation %d, skipping\n", c.targetName(targetAbsPath), latestNumber)
+			skipped = true
+			continue
+		}
+		actualStateEntry := actualStateEntries[targetAbsPath]
+		actualEntryState, err := actualStateEntry.EntryState()
+		if err != nil {
+			return err
+		}
+		if entry.Before.Equivalent(actualEntryState) {
+			continue
+		}
+		if err := rollback.StoreContents(actualStateEntry); err != nil {
+			return err
+		}
+
+		switch err := rollbackTarget(system, backupStore, actualStateEntry, entry.Before, entry.BeforeLinkname); {
+		case errors.Is(err, errContentsNotAvailable):
+			c.errorf("%s: %v, skipping\n", c.targetName(targetAbsPath), err)
+			skipped = true
+			continue
+		case err != nil:
+			return fmt.Errorf("%s: %w", c.targetName(targetAbsPath), err)
+		}
+		rollback.Record(targetAbsPath, &chezmoi.GenerationEntry{
+			Before:         entry.After,
+			BeforeLinkname: entry.AfterLinkname,
+			After:          entry.Before,
+			AfterLinkname:  entry.BeforeLinkname,
+		})
+
+		if entry.Before == nil {
+			err = c.persistentState.Delete(chezmoi.EntryStateBucket, targetAbsPath.Bytes())
+		} else {
+			err = chezmoi.PersistentStateSet(c.persistentState, chezmoi.EntryStateBucket, targetAbsPath.Bytes(), entry.Before)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := rollback.Save(c.persistentState); err != nil {
+		return err
+	}
+
+	if skipped {
+		return chezmoi.ExitCodeError(1)
+	}
+	return nil
+}
+
+// rollbackTarget replaces actualStateEntry in system with entryState. If
+// entryState is a symlink then linkname is its target.
+func rollbackTarget(
+	system chezmoi.System,
+	backupStore *chezmoi.BackupStore,
+	actualStateEntry chezmoi.ActualStateEntry,
+	entryState *chezmoi.EntryState,
+	linkname string,
+) error {
+	targetAbsPath := actualStateEntry.Path()
+	_, isAbsent := actualStateEntry.(*chezmoi.ActualStateAbsent)
+
+	if entryState == nil || entryState.Type == chezmoi.EntryStateTypeRemove {
+		return actualStateEntry.Remove(system)
+	}
+
+	switch entryState.Type {
+	case chezmoi.EntryStateTypeDir:
+		if _, ok := actualStateEntry.(*chezmoi.ActualStateDir); ok {
+			return system.Chmod(targetAbsPath, entryState.Mode.Perm())
+		}
+		if !isAbsent {
+			if err := actualStateEntry.Remove(system); err != nil {
+				return err
+			}
+		}
+		return system.Mkdir(targetAbsPath, entryState.Mode.Perm())
+	case chezmoi.EntryStateTypeFile:
+		var contents []byte
+		if emptySHA256 := sha256.Sum256(nil); !slices.Equal(entryState.ContentsSHA256, emptySHA256[:]) {
+			var err error
+			switch contents, err = backupStore.ReadContents(entryState.ContentsSHA256); {
+			case errors.Is(err, fs.ErrNotExist):
+				return errContentsNotAvailable
+			case err != nil:
+				return err
+			}
+		}
+		if _, ok := actualStateEntry.(*chezmoi.ActualStateFile); !ok && !isAbsent {
+			if err := actualStateEntry.Remove(system); err != nil {
+				return err
+			}
+		}
+		return system.WriteFile(targetAbsPath, contents, entryState.Mode.Perm())
+	case chezmoi.EntryStateTypeSymlink:
+		if !isAbsent {
+			if err := actualStateEntry.Remove(system); err != nil {
+				return err
+			}
+		}
+		return system.WriteSymlink(linkname, targetAbsPath)
+	default:
+		return fmt.Errorf("%s: unsupported type", entryState.Type)
+	}
+}
@@ -0,0 +1,386 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+)
+
+type scriptLogConfig struct {
+	MaxOutputSize int `json:"maxOutputSize" mapstructure:"maxOutputSize" yaml:"maxOutputSize"`
+	MaxRuns       int `json:"maxRuns"       mapstructure:"maxRuns"       yaml:"maxRuns"`
+}
+
+func (c *Config) newScriptCmd() *cobra.Command {
+	scriptCmd := &cobra.Command{
+		Use:     "script",
+		Short:   "Manage scripts",
+		Long:    mustLongHelp("script"),
+		Example: example("script"),
+		Annotations: newAnnotations(
+			persistentStateModeNone,
+		),
+	}
+
+	scriptListCmd := &cobra.Command{
+		Use:               "list [name...]",
+		Short:             "List scripts",
+		ValidArgsFunction: c.scriptValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runScriptListCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+			requiresSourceDirectory,
+		),
+	}
+	scriptCmd.AddCommand(scriptListCmd)
+
+	scriptLogCmd := &cobra.Command{
+		Use:               "log [name...]",
+		Short:             "Show recent script runs",
+		ValidArgsFunction: c.scriptValidArgs,
+		RunE:              c.runScriptLogCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadOnly,
+		),
+	}
+	scriptCmd.AddCommand(scriptLogCmd)
+
+	scriptMarkNotRunCmd := &cobra.Command{
+		Use:               "mark-not-run name...",
+		Short:             "Mark scripts as not run",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: c.scriptValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runScriptMarkNotRunCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+	scriptCmd.AddCommand(scriptMarkNotRunCmd)
+
+	scriptMarkRunCmd := &cobra.Command{
+		Use:               "mark-run name...",
+		Short:             "Mark scripts as run",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: c.scriptValidArgs,
+		RunE:              c.makeRunEWithSourceState(c.runScriptMarkRunCmd),
+		Annotations: newAnnotations(
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+	scriptCmd.AddCommand(scriptMarkRunCmd)
+
+	return scriptCmd
+}
+
+func (c *Config) runScriptListCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	scriptTargetRelPaths, err := c.scriptTargetRelPaths(sourceState, args)
+	if err != nil {
+		return err
+	}
+
+	lastRunTimes, err := chezmoi.ScriptLastRunTimes(c.persistentState)
+	if err != nil {
+		return err
+	}
+
+	var builder strings.Builder
+	for _, targetRelPath := range scriptTargetRelPaths {
+		sourceStateFile, targetStateScript, err := c.scriptEntries(sourceState, targetRelPath)
+		if err != nil {
+			return err
+		}
+
+		lastRun := "never"
+		if lastRunTime, ok := lastRunTimes[targetRelPath]; ok {
+			lastRun = lastRunTime.Local().Format(time.RFC3339)
+		}
+
+		skipApply, err := targetStateScript.SkipApply(c.persistentState, c.DestDirAbsPath.Join(targetRelPath))
+		if err != nil {
+			return err
+		}
+		runNow := "run"
+		if skipApply {
+			runNow = "skip"
+		}
+
+		fmt.Fprintf(&builder, "%s %s %s %s %s\n",
+			sourceStateFile.Attr.Condition, scriptOrderString(sourceStateFile.Attr.Order), lastRun, runNow, targetRelPath)
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runScriptLogCmd(cmd *cobra.Command, args []string) error {
+	scriptRuns, err := chezmoi.ScriptRuns(c.persistentState)
+	if err != nil {
+		return err
+	}
+
+	var builder strings.Builder
+	for _, scriptRun := range scriptRuns {
+		if len(args) != 0 && !scriptRunMatches(scriptRun, args) {
+			continue
+		}
+		result := "succeeded"
+		if scriptRun.Error != "" {
+			result = "failed: " + scriptRun.Error
+		}
+		duration := time.Duration(scriptRun.Duration * float64(time.Second)).Round(time.Millisecond)
+		fmt.Fprintf(&builder, "%s %s %s in %s\n",
+			scriptRun.Time.Local().Format(time.RFC3339), scriptRun.Name, result, duration)
+		if scriptRun.OutputTruncated {
+			builder.WriteString("[output truncated]\n")
+		}
+		if scriptRun.Output != "" {
+			builder.WriteString(scriptRun.Output)
+			if !strings.HasSuffix(scriptRun.Output, "\n") {
+				builder.WriteByte('\n')
+			}
+		}
+	}
+	return c.writeOutputString(builder.String())
+}
+
+func (c *Config) runScriptMarkNotRunCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	return c.markScripts(sourceState, args, func(targetStateScript *chezmoi.TargetStateScript, targetAbsPath chezmoi.AbsPath) error {
+		return targetStateScript.MarkNotRun(c.persistentState, targetAbsPath)
+	})
+}
+
+func (c *Config) runScriptMarkRunCmd(cmd *cobra.Command, args []string, sourceState *chezmoi.SourceState) error {
+	runAt := time.Now().UTC()
+	return c.markScripts(sourceState, args, func(targetStateScript *chezmoi.TargetStateScript, targetAbsPath chezmoi.AbsPath) error {
+		return targetStateScript.MarkRun(c.persistentState, targetAbsPath, runAt)
+	})
+}
+
+// markScripts calls markFunc for each of the run_once_ or run_onchange_
+// scripts named by args.
+func (c *Config) markScripts(
+	sourceState *chezmoi.SourceState,
+	args []string,
+	markFunc func(*chezmoi.TargetStateScript, chezmoi.AbsPath) error,
+) error {
+	scriptTargetRelPaths, err := c.scriptTargetRelPaths(sourceState, args)
+	if err != nil {
+		return err
+	}
+	for _, targetRelPath := range scriptTargetRelPaths {
+		sourceStateFile, targetStateScript, err := c.scriptEntries(sourceState, targetRelPath)
+		if err != nil {
+			return err
+		}
+		if sourceStateFile.Attr.Condition == chezmoi.ScriptConditionAlways {
+			return fmt.Errorf("%s: not a run_once_ or run_onchange_ script", targetRelPath)
+		}
+		if err := markFunc(targetStateScript, c.DestDirAbsPath.Join(targetRelPath)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newScriptLogSystem returns a new ScriptLogSystem that records the runs of
+// scripts on system.
+func (c *Config) newScriptLogSystem(system chezmoi.System) *chezmoi.ScriptLogSystem {
+	return chezmoi.NewScriptLogSystem(system, c.persistentState, chezmoi.ScriptLogSystemOptions{
+		MaxOutputSize: c.ScriptLog.MaxOutputSize,
+		MaxRuns:       c.ScriptLog.MaxRuns,
+		RedactFunc:    c.redactSecrets,
+	})
+}
+
+// onChangeReasons returns the reasons why a run_onchange_ script with
+// onchange dependencies and targetEntryState will run, given the entry state
+// recorded when it last ran.
+func onChangeReasons(targetEntryState, lastWrittenEntryState *chezmoi.EntryState) []string {
+	if lastWrittenEntryState == nil || lastWrittenEntryState.Type != chezmoi.EntryStateTypeScript {
+		return []string{"it has not run before"}
+	}
+	var reasons []string
+	for _, targetName := range slices.Sorted(maps.Keys(targetEntryState.DependencySHA256s)) {
+		switch lastDependencySHA256, ok := lastWrittenEntryState.DependencySHA256s[targetName]; {
+		case !ok:
+			reasons = append(reasons, targetName+" was added")
+		case !bytes.Equal(lastDependencySHA256, targetEntryState.DependencySHA256s[targetName]):
+			reasons = append(reasons, targetName+" changed")
+		}
+	}
+	for _, targetName := range slices.Sorted(maps.Keys(lastWrittenEntryState.DependencySHA256s)) {
+		if _, ok := targetEntryState.DependencySHA256s[targetName]; !ok {
+			reasons = append(reasons, targetName+" was removed")
+		}
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "its contents changed")
+	}
+	return reasons
+}
+
+// redactSecrets returns data with all secrets found by gitleaks replaced.
+func (c *Config) redactSecrets(data []byte) ([]byte, error) {
+	secrets, err := c.findSecrets(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		if secret.Value == "" {
+			continue
+		}
+		data = bytes.ReplaceAll(data, []byte(secret.Value), []byte("REDACTED"))
+	}
+	return data, nil
+}
+
+// scriptEntries returns the source state entry and target state entry of the
+// script at targetRelPath.
+func (c *Config) scriptEntries(
+	sourceState *chezmoi.SourceState,
+	targetRelPath chezmoi.RelPath,
+) (*chezmoi.SourceStateFile, *chezmoi.TargetStateScript, error) {
+	sourceStateFile, ok := sourceState.Get(targetRelPath).(*chezmoi.SourceStateFile)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: not a script", targetRelPath)
+	}
+	targetStateEntry, err := sourceStateFile.TargetStateEntry(c.destSystem, c.DestDirAbsPath.Join(targetRelPath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", targetRelPath, err)
+	}
+	targetStateScript, ok := targetStateEntry.(*chezmoi.TargetStateScript)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: not a script", targetRelPath)
+	}
+	return sourceStateFile, targetStateScript, nil
+}
+
+// scriptTargetRelPaths returns the target relative paths of the scripts named
+// by args, or of all scripts if args is empty, in the order in which they are
+// run.
+func (c *Config) scriptTargetRelPaths(sourceState *chezmoi.SourceState, args []string) ([]chezmoi.RelPath, error) {
+	targetRelPaths, err := sourceState.SortTargetRelPaths(sourceState.TargetRelPaths())
+	if err != nil {
+		return nil, err
+	}
+
+	var scriptTargetRelPaths []chezmoi.RelPath
+	scriptTargetRelPathSet := chezmoiset.New[chezmoi.RelPath]()
+	for _, targetRelPath := range targetRelPaths {
+		if sourceStateFile, ok := sourceState.Get(targetRelPath).(*chezmoi.SourceStateFile); ok &&
+			sourceStateFile.Attr.Type == chezmoi.SourceFileTypeScript {
+			scriptTargetRelPaths = append(scriptTargetRelPaths, targetRelPath)
+			scriptTargetRelPathSet.Add(targetRelPath)
+		}
+	}
+	if len(args) == 0 {
+		return scriptTargetRelPaths, nil
+	}
+
+	argTargetRelPaths := chezmoiset.New[chezmoi.RelPath]()
+	for _, arg := range args {
+		targetRelPath := chezmoi.NewRelPath(arg)
+		if filepath.IsAbs(arg) || strings.HasPrefix(arg, "~") {
+			targetAbsPath, err := chezmoi.NewAbsPathFromExtPath(arg, c.homeDirAbsPath)
+			if err != nil {
+				return nil, err
+			}
+			if targetRelPath, err = targetAbsPath.TrimDirPrefix(c.DestDirAbsPath); err != nil {
+				return nil, err
+			}
+		}
+		if !scriptTargetRelPathSet.Contains(targetRelPath) {
+			return nil, fmt.Errorf("%s: script not found", arg)
+		}
+		argTargetRelPaths.Add(targetRelPath)
+	}
+	return slices.DeleteFunc(scriptTargetRelPaths, func(targetRelPath chezmoi.RelPath) bool {
+		return !argTargetRelPaths.Contains(targetRelPath)
+	}), nil
+}
+
+// scriptValidArgs returns the target names of scripts that start with
+// toComplete.
+func (c *Config) scriptValidArgs(
+	cmd *cobra.Command,
+	args []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
+	if !c.Completion.Custom {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var completions []string
+	for _, targetRelPath := range sourceState.TargetRelPaths() {
+		sourceStateFile, ok := sourceState.Get(targetRelPath).(*chezmoi.SourceStateFile)
+		if !ok || sourceStateFile.Attr.Type != chezmoi.SourceFileTypeScript {
+			continue
+		}
+		if completion := targetRelPath.String(); strings.HasPrefix(completion, toComplete) {
+			completions = append(completions, completion)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// scriptOrderString returns a string representation of order.
+func scriptOrderString(order chezmoi.ScriptOrder) string {
+	switch order {
+	case chezmoi.ScriptOrderBefore:
+		return "before"
+	case chezmoi.ScriptOrderAfter:
+		return "after"
+	default:
+		return "during"
+	}
+}
+
+// scriptRunMatches returns true if scriptRun is a run of any of the scripts
+// named by args, either by their target name or source path.
+func scriptRunMatches(scriptRun *chezmoi.ScriptRun, args []string) bool {
+	for _, arg := range args {
+		if arg == scriptRun.Name || arg == scriptRun.SourcePath {
+			return true
+		}
+	}
+	return false
+}
+
+// writeScriptChanges writes the changes that the script scriptName reported
+// that it would make when run in dry run mode to w.
+func writeScriptChanges(w io.Writer, scriptName chezmoi.RelPath, changes []chezmoi.ScriptChange) error {
+	var builder strings.Builder
+	if len(changes) == 0 {
+		fmt.Fprintf(&builder, "dry run of %s: no changes\n", scriptName)
+	} else {
+		fmt.Fprintf(&builder, "dry run of %s:\n", scriptName)
+	}
+	for _, change := range changes {
+		builder.WriteString("  " + change.Action)
+		if change.Target != "" {
+			builder.WriteString(" " + change.Target)
+		}
+		if change.Description != "" {
+			builder.WriteString(": " + change.Description)
+		}
+		builder.WriteByte('\n')
+	}
+	_, err := w.Write([]byte(builder.String()))
+	return err
+}
@@ -4,6 +4,7 @@ import "github.com/spf13/cobra"
 
 type secretCmdConfig struct {
 	keyring secretKeyringCmdConfig
+	refs    secretRefsCmdConfig
 }
 
 func (c *Config) newSecretCmd() *cobra.Command {
@@ -21,6 +22,8 @@ func (c *Config) newSecretCmd() *cobra.Command {
 	if secretKeyringCmd := c.newSecretKeyringCmd(); secretKeyringCmd != nil {
 		secretCmd.AddCommand(secretKeyringCmd)
 	}
+	secretCmd.AddCommand(c.newSecretReapplyCmd())
+	secretCmd.AddCommand(c.newSecretRefsCmd())
 
 	return secretCmd
 }
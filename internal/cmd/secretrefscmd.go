@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+)
+
+// secretTemplateFuncProviders maps the names of template functions that
+// retrieve secrets to their providers. TestSecretTemplateFuncProviders checks
+// that every template function is either listed here or known not to retrieve
+// secrets.
+var secretTemplateFuncProviders = map[string]string{
+	"awsSecretsManager":        "awsSecretsManager",
+	"awsSecretsManagerRaw":     "awsSecretsManager",
+	"azureKeyVault":            "azureKeyVault",
+	"bitwarden":                "bitwarden",
+	"bitwardenAttachment":      "bitwarden",
+	"bitwardenAttachmentByRef": "bitwarden",
+	"bitwardenFields":          "bitwarden",
+	"bitwardenSecrets":         "bitwardenSecrets",
+	"dashlaneNote":             "dashlane",
+	"dashlanePassword":         "dashlane",
+	"decrypt":                  "encryption",
+	"doppler":                  "doppler",
+	"dopplerProjectJson":       "doppler",
+	"ejsonDecrypt":             "ejson",
+	"ejsonDecryptWithKey":      "ejson",
+	"gopass":                   "gopass",
+	"gopassRaw":                "gopass",
+	"hcpVaultSecret":           "hcpVaultSecrets",
+	"hcpVaultSecretJson":       "hcpVaultSecrets",
+	"keepassxc":                "keepassxc",
+	"keepassxcAttachment":      "keepassxc",
+	"keepassxcAttribute":       "keepassxc",
+	"keeper":                   "keeper",
+	"keeperDataFields":         "keeper",
+	"keeperFindPassword":       "keeper",
+	"keyring":                  "keyring",
+	"lastpass":                 "lastpass",
+	"lastpassRaw":              "lastpass",
+	"onepassword":              "onepassword",
+	"onepasswordDetailsFields": "onepassword",
+	"onepasswordDocument":      "onepassword",
+	"onepasswordItemFields":    "onepassword",
+	"onepasswordRead":          "onepassword",
+	"pass":                     "pass",
+	"passFields":               "pass",
+	"passRaw":                  "pass",
+	"passhole":                 "passhole",
+	"rbw":                      "rbw",
+	"rbwFields":                "rbw",
+	"secret":                   "secret",
+	"secretJSON":               "secret",
+	"vault":                    "vault",
+}
+
+type secretRefsCmdConfig struct {
+	format *choiceFlag
+}
+
+// A secretRef is a reference to a secret in a template.
+type secretRef struct {
+	Provider string   `json:"provider" yaml:"provider"`
+	Function string   `json:"function" yaml:"function"`
+	Args     []string `json:"args"     yaml:"args"`
+	Literal  bool     `json:"literal"  yaml:"literal"`
+	Targets  []string `json:"targets"  yaml:"targets"`
+}
+
+func (c *Config) newSecretRefsCmd() *cobra.Command {
+	secretRefsCmd := &cobra.Command{
+		Use:               "refs [provider [arg...]]",
+		Short:             "Print references to secrets in templates",
+		ValidArgsFunction: c.secretRefsValidArgs,
+		RunE:              c.runSecretRefsCmd,
+		Annotations: newAnnotations(
+			persistentStateModeReadMockWrite,
+		),
+	}
+
+	secretRefsCmd.Flags().VarP(c.secret.refs.format, "format", "f", "Output format")
+	must(secretRefsCmd.RegisterFlagCompletionFunc("format", c.secret.refs.format.FlagCompletionFunc()))
+
+	return secretRefsCmd
+}
+
+func (c *Config) newSecretReapplyCmd() *cobra.Command {
+	secretReapplyCmd := &cobra.Command{
+		Use:               "reapply provider [arg...]",
+		Short:             "Apply targets that reference a secret",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: c.secretRefsValidArgs,
+		RunE:              c.runSecretReapplyCmd,
+		Annotations: newAnnotations(
+			modifiesDestinationDirectory,
+			persistentStateModeReadWrite,
+			requiresSourceDirectory,
+		),
+	}
+
+	return secretReapplyCmd
+}
+
+func (c *Config) runSecretRefsCmd(cmd *cobra.Command, args []string) error {
+	secretRefs, err := c.secretRefs(cmd, args)
+	if err != nil {
+		return err
+	}
+	return c.marshal(c.secret.refs.format.String(), secretRefs)
+}
+
+func (c *Config) runSecretReapplyCmd(cmd *cobra.Command, args []string) error {
+	secretRefs, err := c.secretRefs(cmd, args)
+	if err != nil {
+		return err
+	}
+	if len(secretRefs) == 0 {
+		return fmt.Errorf("%s: no references found", strings.Join(args, " "))
+	}
+
+	targets := chezmoiset.New[string]()
+	for _, secretRef := range secretRefs {
+		targets.Add(secretRef.Targets...)
+	}
+	targetAbsPaths := make([]string, 0, len(targets))
+	for _, target := range slices.Sorted(maps.Keys(targets)) {
+		targetAbsPaths = append(targetAbsPaths, c.DestDirAbsPath.JoinString(target).String())
+	}
+
+	return c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, targetAbsPaths, applyArgsOptions{
+		cmd:          cmd,
+		filter:       chezmoi.NewEntryTypeFilter(chezmoi.EntryTypesAll, chezmoi.EntryTypesNone),
+		umask:        c.Umask,
+		preApplyFunc: c.defaultPreApplyFunc,
+	})
+}
+
+// secretRefs returns all references to secrets in the source state's templates
+// that match args. If args is not empty then its first element must match the
+// provider or function and the remaining elements must match the first
+// arguments of the reference.
+func (c *Config) secretRefs(cmd *cobra.Command, args []string) ([]*secretRef, error) {
+	sourceState, err := c.getSourceState(cmd.Context(), cmd)
+	if err != nil {
+		return nil, err
+	}
+	templateFuncCalls, err := sourceState.TemplateFuncCalls()
+	if err != nil {
+		return nil, err
+	}
+
+	secretRefsByKey := make(map[string]*secretRef)
+	for targetRelPath, funcCalls := range templateFuncCalls {
+		for _, funcCall := range funcCalls {
+			provider, ok := secretTemplateFuncProviders[funcCall.Name]
+			if !ok {
+				continue
+			}
+			if len(args) > 0 {
+				if args[0] != provider && args[0] != funcCall.Name {
+					continue
+				}
+				if len(args)-1 > len(funcCall.Args) || !slices.Equal(args[1:], funcCall.Args[:len(args)-1]) {
+					continue
+				}
+			}
+			key := strings.Join(append([]string{funcCall.Name}, funcCall.Args...), "\x00")
+			ref, ok := secretRefsByKey[key]
+			if !ok {
+				ref = &secretRef{
+					Provider: provider,
+					Function: funcCall.Name,
+					Args:     funcCall.Args,
+					Literal:  funcCall.Literal,
+				}
+				secretRefsByKey[key] = ref
+			}
+			if !slices.Contains(ref.Targets, targetRelPath.String()) {
+				ref.Targets = append(ref.Targets, targetRelPath.String())
+			}
+		}
+	}
+
+	secretRefs := make([]*secretRef, 0, len(secretRefsByKey))
+	for _, ref := range secretRefsByKey {
+		slices.Sort(ref.Targets)
+		secretRefs = append(secretRefs, ref)
+	}
+	slices.SortFunc(secretRefs, func(a, b *secretRef) int {
+		return cmp.Or(
+			strings.Compare(a.Provider, b.Provider),
+			strings.Compare(a.Function, b.Function),
+			slices.Compare(a.Args, b.Args),
+		)
+	})
+	return secretRefs, nil
+}
+
+// secretRefsValidArgs completes providers.
+func (c *Config) secretRefsValidArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	providers := chezmoiset.New[string]()
+	for _, provider := range secretTemplateFuncProviders {
+		if strings.HasPrefix(provider, toComplete) {
+			providers.Add(provider)
+		}
+	}
+	return slices.Sorted(maps.Keys(providers)), cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/twpayne/go-vfs/v5"
+
+	"github.com/twpayne/chezmoi/internal/chezmoiset"
+	"github.com/twpayne/chezmoi/internal/chezmoitest"
+)
+
+func TestSecretTemplateFuncProviders(t *testing.T) {
+	nonSecretTemplateFuncs := chezmoiset.New(
+		"comment",
+		"deleteValueAtPath",
+		"encrypt",
+		"eqFold",
+		"findExecutable",
+		"findOneExecutable",
+		"fromIni",
+		"fromJson",
+		"fromJsonc",
+		"fromToml",
+		"fromYaml",
+		"gitHubKeys",
+		"gitHubLatestRelease",
+		"gitHubLatestReleaseAssetURL",
+		"gitHubLatestTag",
+		"gitHubRelease",
+		"gitHubReleaseAssetURL",
+		"gitHubReleases",
+		"gitHubTags",
+		"glob",
+		"hexDecode",
+		"hexEncode",
+		"include",
+		"includeTemplate",
+		"ioreg",
+		"isExecutable",
+		"joinPath",
+		"jq",
+		"lookPath",
+		"lstat",
+		"mozillaInstallHash",
+		"output",
+		"outputList",
+		"pruneEmptyDicts",
+		"quote",
+		"quoteList",
+		"replaceAllRegex",
+		"setValueAtPath",
+		"splitList",
+		"squote",
+		"stat",
+		"toIni",
+		"toPrettyJson",
+		"toString",
+		"toStrings",
+		"toToml",
+		"toYaml",
+		"warnf",
+	)
+	sprigTemplateFuncs := sprig.TxtFuncMap()
+
+	chezmoitest.WithTestFS(t, nil, func(fileSystem vfs.FS) {
+		c := newTestConfig(t, fileSystem)
+		for name := range c.templateFuncs {
+			if _, ok := secretTemplateFuncProviders[name]; ok {
+				continue
+			}
+			if nonSecretTemplateFuncs.Contains(name) {
+				continue
+			}
+			if _, ok := sprigTemplateFuncs[name]; ok {
+				continue
+			}
+			t.Errorf("%s: template function is neither a secret template function nor a known non-secret template function", name)
+		}
+		for name := range secretTemplateFuncProviders {
+			if _, ok := c.templateFuncs[name]; !ok {
+				t.Errorf("%s: not a template function", name)
+			}
+		}
+	})
+}
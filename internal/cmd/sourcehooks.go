@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+)
+
+var hookTrustStateBucket = []byte("hookTrustState")
+
+// A hookTrustState records that the user trusted the hooks in a source
+// directory.
+type hookTrustState struct {
+	SHA256    chezmoi.HexBytes `json:"sha256"`
+	TrustedAt time.Time        `json:"trustedAt"`
+}
+
+// loadSourceHooks reads the hooks defined in the source directory, if it
+// exists. If the hooks have changed since the user last trusted them, then
+// the user is prompted to trust them before they are run.
+func (c *Config) loadSourceHooks(cmd *cobra.Command) error {
+	if c.sourceHooksLoaded {
+		return nil
+	}
+
+	sourceDirAbsPath, err := c.getSourceDirAbsPath(nil)
+	if err != nil {
+		return err
+	}
+	switch fileInfo, err := c.baseSystem.Stat(sourceDirAbsPath); {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case !fileInfo.IsDir():
+		return fmt.Errorf("%s: not a directory", sourceDirAbsPath)
+	}
+	c.sourceHooksLoaded = true
+	c.sourceHooks = nil
+
+	sourceState := chezmoi.NewSourceState(
+		chezmoi.WithBaseSystem(c.baseSystem),
+		chezmoi.WithDefaultTemplateDataFunc(func() map[string]any {
+			return c.getTemplateDataMap(cmd)
+		}),
+		chezmoi.WithDestDir(c.DestDirAbsPath),
+		chezmoi.WithEncryption(c.encryption),
+		chezmoi.WithHooksOnly(true),
+		chezmoi.WithLogger(c.logger.With(logComponentKey, logComponentValueSourceState)),
+		chezmoi.WithMode(c.Mode),
+		chezmoi.WithPriorityTemplateData(c.Data),
+		chezmoi.WithSOPS(&c.SOPS),
+		chezmoi.WithSourceDir(sourceDirAbsPath),
+		chezmoi.WithSystem(c.sourceSystem),
+		chezmoi.WithTemplateFuncs(c.templateFuncs),
+		chezmoi.WithTemplateOptions(c.Template.Options),
+		chezmoi.WithVersion(c.version),
+		chezmoi.WithWarnFunc(c.errorf),
+	)
+	if err := sourceState.Read(cmd.Context(), nil); err != nil {
+		return err
+	}
+	hooks := sourceState.Hooks()
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	hooksSHA256, err := c.sourceHooksSHA256(sourceDirAbsPath, hooks)
+	if err != nil {
+		return err
+	}
+	var trustState hookTrustState
+	switch ok, err := chezmoi.PersistentStateGet(c.persistentState, hookTrustStateBucket, sourceDirAbsPath.Bytes(), &trustState); {
+	case err != nil:
+		return err
+	case ok && string(trustState.SHA256) == string(hooksSHA256):
+		c.sourceHooks = hooks
+		return nil
+	}
+
+	// Show the hooks and ask the user whether to trust them.
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s defines hooks that have not been trusted:\n", sourceDirAbsPath)
+	for _, hook := range hooks {
+		for _, hookCommand := range []struct {
+			when string
+			chezmoi.HookCommand
+		}{
+			{"pre", hook.Pre},
+			{"post", hook.Post},
+		} {
+			if name := cmp.Or(hookCommand.Command, hookCommand.Script); name != "" {
+				fmt.Fprintf(&builder, "  %s.%s: %s\n", hook.Event, hookCommand.when, shellQuoteCommand(name, hookCommand.Args))
+			}
+		}
+	}
+	if _, err := c.stderr.Write([]byte(builder.String())); err != nil {
+		return err
+	}
+	switch choice, err := c.promptChoice("Trust and run these hooks", []string{"yes", "no"}, "no"); {
+	case err != nil:
+		return err
+	case choice != "yes":
+		c.errorf("warning: %s: not running untrusted hooks\n", sourceDirAbsPath)
+		return nil
+	}
+	if err := chezmoi.PersistentStateSet(c.persistentState, hookTrustStateBucket, sourceDirAbsPath.Bytes(), &hookTrustState{
+		SHA256:    chezmoi.HexBytes(hooksSHA256),
+		TrustedAt: time.Now().UTC(),
+	}); err != nil {
+		return err
+	}
+	c.sourceHooks = hooks
+	return nil
+}
+
+// sourceHooksSHA256 returns the SHA256 of hooks, defined in sourceDirAbsPath,
+// including the contents of the scripts that they run, so that changing a
+// script requires the user to trust the hooks again.
+func (c *Config) sourceHooksSHA256(sourceDirAbsPath chezmoi.AbsPath, hooks []*chezmoi.Hook) ([]byte, error) {
+	hooksJSON, err := chezmoi.FormatJSON.Marshal(hooks)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(sourceDirAbsPath.String() + "\x00" + string(hooksJSON)))
+	for _, hook := range hooks {
+		for _, hookCommand := range []chezmoi.HookCommand{hook.Pre, hook.Post} {
+			if hookCommand.Script == "" {
+				continue
+			}
+			// A missing script is hashed as empty, and running it will fail.
+			contents, err := c.baseSystem.ReadFile(chezmoi.NewAbsPath(hookCommand.Script))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			hash.Write([]byte("\x00"))
+			hash.Write(contents)
+		}
+	}
+	return hash.Sum(nil), nil
+}
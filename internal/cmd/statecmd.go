@@ -190,14 +190,20 @@ func (c *Config) runStateDeleteBucketCmd(cmd *cobra.Command, args []string) erro
 
 func (c *Config) runStateDumpCmd(cmd *cobra.Command, args []string) error {
 	data, err := chezmoi.PersistentStateData(c.persistentState, map[string][]byte{
+		"backupState":               chezmoi.BackupStateBucket,
 		"configState":               chezmoi.ConfigStateBucket,
 		"entryState":                chezmoi.EntryStateBucket,
+		"failedTargetState":         chezmoi.FailedTargetStateBucket,
+		"generationState":           chezmoi.GenerationStateBucket,
 		"gitHubKeysState":           gitHubKeysStateBucket,
 		"gitHubLatestReleaseState":  gitHubLatestReleaseStateBucket,
 		"gitHubReleasesState":       gitHubReleasesStateBucket,
 		"gitHubTagsState":           gitHubTagsStateBucket,
 		"gitHubVersionReleaseState": gitHubVersionReleaseStateBucket,
 		"gitRepoExternalState":      chezmoi.GitRepoExternalStateBucket,
+		"hookTrustState":            hookTrustStateBucket,
+		"mergeBaseState":            chezmoi.MergeBaseStateBucket,
+		"scriptRunState":            chezmoi.ScriptRunStateBucket,
 		"scriptState":               chezmoi.ScriptStateBucket,
 	})
 	if err != nil {
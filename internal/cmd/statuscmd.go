@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -36,6 +38,7 @@ func (c *Config) newStatusCmd() *cobra.Command {
 		),
 	}
 
+	statusCmd.Flags().IntVar(&c.eventsFD, "events-fd", c.eventsFD, "Write JSON events to file descriptor")
 	statusCmd.Flags().VarP(c.Status.Exclude, "exclude", "x", "Exclude entry types")
 	statusCmd.Flags().VarP(c.Status.PathStyle, "path-style", "p", "Path style")
 	must(statusCmd.RegisterFlagCompletionFunc("path-style", c.Status.PathStyle.FlagCompletionFunc()))
@@ -49,6 +52,11 @@ func (c *Config) newStatusCmd() *cobra.Command {
 }
 
 func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
+	failedTargetAbsPaths, err := c.failedTargetAbsPaths()
+	if err != nil {
+		return err
+	}
+
 	builder := strings.Builder{}
 	preApplyFunc := func(targetRelPath chezmoi.RelPath, targetEntryState, lastWrittenEntryState, actualEntryState *chezmoi.EntryState) error {
 		c.logger.Info("statusPreApplyFunc",
@@ -65,10 +73,16 @@ func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
 		switch {
 		case targetEntryState.Type == chezmoi.EntryStateTypeScript:
 			y = 'R'
+		case isConflict(targetEntryState, lastWrittenEntryState, actualEntryState):
+			x = statusRune(lastWrittenEntryState, actualEntryState)
+			y = 'C'
 		case !targetEntryState.Equivalent(actualEntryState):
 			x = statusRune(lastWrittenEntryState, actualEntryState)
 			y = statusRune(actualEntryState, targetEntryState)
 		}
+		if failedTargetAbsPaths.Contains(c.DestDirAbsPath.Join(targetRelPath)) {
+			x = 'F'
+		}
 
 		if x != ' ' || y != ' ' {
 			var path string
@@ -85,9 +99,10 @@ func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
 		}
 		return fs.SkipDir
 	}
+	filter := chezmoi.NewEntryTypeFilter(c.Status.include.Bits(), c.Status.Exclude.Bits())
 	if err := c.applyArgs(cmd.Context(), c.destSystem, c.DestDirAbsPath, args, applyArgsOptions{
 		cmd:          cmd,
-		filter:       chezmoi.NewEntryTypeFilter(c.Status.include.Bits(), c.Status.Exclude.Bits()),
+		filter:       filter,
 		init:         c.Status.init,
 		parentDirs:   c.Status.parentDirs,
 		recursive:    c.Status.recursive,
@@ -96,6 +111,25 @@ func (c *Config) runStatusCmd(cmd *cobra.Command, args []string) error {
 	}); err != nil {
 		return err
 	}
+
+	// Report missing packages, which would be installed by apply, with a P in
+	// the second column.
+	if len(args) == 0 && filter.IncludeEntryTypeBits(chezmoi.EntryTypePackages) {
+		sourceState, err := c.getSourceState(cmd.Context(), cmd)
+		if err != nil {
+			return err
+		}
+		missingPackages, err := c.missingPackages(sourceState)
+		if err != nil {
+			return err
+		}
+		for _, name := range slices.Sorted(maps.Keys(missingPackages)) {
+			for _, pkg := range missingPackages[name] {
+				fmt.Fprintf(&builder, " P %s:%s\n", name, pkg)
+			}
+		}
+	}
+
 	return c.writeOutputString(builder.String())
 }
 
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/twpayne/chezmoi/internal/chezmoi"
+	"github.com/twpayne/chezmoi/internal/chezmoilog"
+)
+
+const (
+	storeSecretsNone      = ""
+	storeSecretsGopass    = "gopass"
+	storeSecretsKeepassxc = "keepassxc"
+	storeSecretsKeyring   = "keyring"
+	storeSecretsPass      = "pass"
+	storeSecretsVault     = "vault"
+)
+
+var storeSecretsValues = []string{
+	storeSecretsGopass,
+	storeSecretsKeepassxc,
+	storeSecretsKeyring,
+	storeSecretsPass,
+	storeSecretsVault,
+}
+
+// storeSecret stores secret, found in targetRelPath, in the password manager
+// configured by add.storeSecrets and returns a template action that retrieves
+// it.
+func (c *Config) storeSecret(targetRelPath chezmoi.RelPath, secret chezmoi.Secret) (string, error) {
+	key := path.Join(c.Add.StoreSecretsPrefix, targetRelPath.String(), secret.Name)
+
+	var action string
+	var storeFunc func() error
+	switch c.Add.StoreSecrets {
+	case storeSecretsGopass:
+		action = "{{ gopass " + strconv.Quote(key) + " }}"
+		storeFunc = func() error {
+			return c.storeSecretCmd(c.Gopass.Command, []string{"insert", "--force", key}, secret.Value)
+		}
+	case storeSecretsKeepassxc:
+		// keepassxc-cli add does not create groups, so add entries to the root
+		// group.
+		entry := strings.ReplaceAll(key, "/", "-")
+		action = "{{ (keepassxc " + strconv.Quote(entry) + ").Password }}"
+		storeFunc = func() error {
+			return c.keepassxcAdd(entry, secret.Value)
+		}
+	case storeSecretsKeyring:
+		service := c.Add.StoreSecretsPrefix
+		user := path.Join(targetRelPath.String(), secret.Name)
+		action = "{{ keyring " + strconv.Quote(service) + " " + strconv.Quote(user) + " }}"
+		storeFunc = func() error {
+			return c.keyringSet(service, user, secret.Value)
+		}
+	case storeSecretsPass:
+		action = "{{ pass " + strconv.Quote(key) + " }}"
+		storeFunc = func() error {
+			return c.storeSecretCmd(c.Pass.Command, []string{"insert", "--multiline", "--force", key}, secret.Value+"\n")
+		}
+	case storeSecretsVault:
+		action = "{{ (vault " + strconv.Quote(key) + ").data.data.value }}"
+		storeFunc = func() error {
+			return c.storeSecretCmd(c.Vault.Command, []string{"kv", "put", key, "value=-"}, secret.Value)
+		}
+	default:
+		return "", fmt.Errorf("%s: invalid password manager", c.Add.StoreSecrets)
+	}
+
+	if !c.dryRun {
+		if err := storeFunc(); err != nil {
+			return "", err
+		}
+	}
+	if c.Verbose {
+		c.errorf("%s: stored %s in %s\n", targetRelPath, secret.Name, c.Add.StoreSecrets)
+	}
+	return action, nil
+}
+
+// storeSecretCmd runs name with args, writing stdin to its standard input.
+func (c *Config) storeSecretCmd(name string, args []string, stdin string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewBufferString(stdin)
+	cmd.Stderr = os.Stderr
+	output, err := chezmoilog.LogCmdOutput(c.logger, cmd)
+	if err != nil {
+		return newCmdOutputError(cmd, output, err)
+	}
+	return nil
+}
@@ -39,6 +39,7 @@ func (c *Config) newUpdateCmd() *cobra.Command {
 	}
 
 	updateCmd.Flags().BoolVarP(&c.Update.Apply, "apply", "a", c.Update.Apply, "Apply after pulling")
+	updateCmd.Flags().IntVar(&c.eventsFD, "events-fd", c.eventsFD, "Write JSON events to file descriptor")
 	updateCmd.Flags().VarP(c.Update.filter.Exclude, "exclude", "x", "Exclude entry types")
 	updateCmd.Flags().VarP(c.Update.filter.Include, "include", "i", "Include entry types")
 	updateCmd.Flags().BoolVar(&c.Update.init, "init", c.Update.init, "Recreate config file from template")
@@ -95,6 +96,7 @@ func (c *Config) runUpdateCmd(cmd *cobra.Command, args []string) error {
 			cmd:          cmd,
 			filter:       c.Update.filter,
 			init:         c.Update.init,
+			packages:     true,
 			parentDirs:   c.Update.parentDirs,
 			recursive:    c.Update.recursive,
 			umask:        c.Umask,